@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/processor"
+)
+
+// runCheck checks that the database and the filesystem agree, repairing issues if requested
+func runCheck(proc *processor.Processor, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "Repair the issues found: retire, re-queue, relink or import")
+	stale := fs.Duration("stale", time.Hour, "Files processing without a lease and without an update for this long have no live worker")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	issues, err := proc.Check(processor.CheckOptions{Repair: *repair, StaleAfter: *stale})
+	if len(issues) == 0 {
+		if err == nil {
+			fmt.Println("No issues found")
+		}
+		return err
+	}
+
+	unresolved := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tID\tPATH\tDETAIL\tREPAIR")
+	for _, issue := range issues {
+		id := "-"
+		if issue.MediaFile != nil {
+			id = fmt.Sprintf("%d", issue.MediaFile.ID)
+		}
+		repairStatus := "-"
+		switch {
+		case issue.Err != nil:
+			unresolved++
+			repairStatus = fmt.Sprintf("FAILED: %v", issue.Err)
+		case issue.Repair != "":
+			repairStatus = issue.Repair
+		default:
+			unresolved++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", issue.Kind, id, issue.Path, issue.Detail, repairStatus)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+	if unresolved > 0 {
+		return fmt.Errorf("%d of %d issues are unresolved", unresolved, len(issues))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/processor"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+// usage prints the command line usage
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [-config file] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command MediaScanner runs as a service, scanning and organising media files.")
+	fmt.Fprintln(out, "\nCommands:")
+	fmt.Fprintln(out, "  review list                      List files awaiting manual review")
+	fmt.Fprintln(out, "  review show <id>                 Show a file and its candidates")
+	fmt.Fprintln(out, "  review accept <id> [rank]        Organise a file with a candidate (default 1)")
+	fmt.Fprintln(out, "  review correct <id> [flags]      Organise a file with given TMDB/TVDB/Bangumi IDs")
+	fmt.Fprintln(out, "  undo file <id>                   Undo the organisation of a file")
+	fmt.Fprintln(out, "  undo batch <id>                  Undo the organisation of a batch")
+	fmt.Fprintln(out, "  undo since <time|duration>       Undo everything since a time (RFC 3339, 2006-01-02) or duration (24h)")
+	fmt.Fprintln(out, "  plan [-o file] [-json] [dir...]  Show how new files would be organised without touching them")
+	fmt.Fprintln(out, "  apply <plan.json>                Organise files as planned, without calling the LLM")
+	fmt.Fprintln(out, "  check [-repair] [-stale 1h]      Check that the database and the library agree, optionally repairing")
+	fmt.Fprintln(out, "  usage [-by day] [-since 720h]    Report LLM requests, tokens and cost by day, provider, model or file")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// commandEnv holds the components used by commands
+type commandEnv struct {
+	cfg  *config.Config
+	proc *processor.Processor
+	scan *scanner.Scanner
+}
+
+// commandNeedsLLM reports whether a command identifies files with the LLM.
+// The service and plan do, the other commands do not.
+func commandNeedsLLM(args []string) bool {
+	return len(args) == 0 || args[0] == "plan"
+}
+
+// runCommand runs a command given on the command line and returns the exit code
+func runCommand(ctx context.Context, env *commandEnv, args []string) int {
+	var err error
+	switch args[0] {
+	case "review":
+		err = runReview(ctx, env.proc, args[1:])
+	case "undo":
+		err = runUndo(env.proc, args[1:])
+	case "plan":
+		err = runPlan(ctx, env, args[1:])
+	case "apply":
+		err = runApply(ctx, env.proc, args[1:])
+	case "check":
+		err = runCheck(env.proc, args[1:])
+	case "usage":
+		err = runUsage(env.proc, args[1:])
+	case "help":
+		usage()
+	default:
+		err = fmt.Errorf("unknown command: %s", args[0])
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/sleepstars/mediascanner/internal/api"
 	"github.com/sleepstars/mediascanner/internal/config"
 	"github.com/sleepstars/mediascanner/internal/database"
+	"github.com/sleepstars/mediascanner/internal/dispatcher"
 	"github.com/sleepstars/mediascanner/internal/fileops"
 	"github.com/sleepstars/mediascanner/internal/llm"
 	"github.com/sleepstars/mediascanner/internal/logger"
@@ -30,11 +31,14 @@ func main() {
 
 	// Parse command line flags
 	configFile := flag.String("config", "", "Path to configuration file")
+	flag.Usage = usage
 	flag.Parse()
 
-	// Print banner
-	fmt.Println("MediaScanner - LLM-based Media Information Scraper")
-	fmt.Println("=================================================")
+	// Print banner, commands keep stdout for their output
+	if flag.NArg() == 0 {
+		fmt.Println("MediaScanner - LLM-based Media Information Scraper")
+		fmt.Println("=================================================")
+	}
 
 	// Load configuration
 	var cfg *config.Config
@@ -53,6 +57,11 @@ func main() {
 		log.Info().Msg("Using default configuration")
 	}
 
+	// Commands print their output to stdout, so they log to stderr instead
+	if flag.NArg() > 0 && cfg.Logger.Output == "stdout" {
+		cfg.Logger.Output = "stderr"
+	}
+
 	// Initialize logger with configuration
 	loggerConfig := &logger.Config{
 		Level:      logger.LogLevel(cfg.Logger.Level),
@@ -85,7 +94,7 @@ func main() {
 	log.Info().Msg("Database migration completed successfully")
 
 	// Create worker pool semaphores
-	var llmSemaphore worker.Semaphore
+	var llmSemaphore, apiSemaphore worker.Semaphore
 
 	// Initialize worker pool if enabled
 	if cfg.WorkerPool.Enabled {
@@ -94,17 +103,22 @@ func main() {
 
 		// Create semaphores
 		llmSemaphore = worker.NewLLMSemaphore(pool)
+		apiSemaphore = worker.NewAPISemaphore(pool)
 	} else {
 		// Use no-op semaphores
 		llmSemaphore = worker.NewNoOpSemaphore()
+		apiSemaphore = worker.NewNoOpSemaphore()
 	}
 
-	// Initialize LLM client
-	llmClient, err := llm.New(&cfg.LLM, llmSemaphore)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to initialize LLM client")
+	// Initialize LLM client, commands that do not identify files run without one
+	var llmClient *llm.LLM
+	if commandNeedsLLM(flag.Args()) {
+		llmClient, err = llm.New(&cfg.LLM, llmSemaphore, apiSemaphore)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize LLM client")
+		}
+		log.Info().Str("provider", cfg.LLM.Provider).Str("model", cfg.LLM.Model).Msg("LLM client initialized successfully")
 	}
-	log.Info().Str("provider", cfg.LLM.Provider).Str("model", cfg.LLM.Model).Msg("LLM client initialized successfully")
 
 	// Initialize API clients
 	apiClient, err := api.New(&cfg.APIs, db)
@@ -129,6 +143,24 @@ func main() {
 	scan := scanner.New(&cfg.Scanner, db)
 	log.Info().Int("media_dirs", len(cfg.Scanner.MediaDirs)).Bool("use_watcher", cfg.Scanner.UseWatcher).Msg("Scanner initialized successfully")
 
+	// Keep the claims on files being processed alive
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	defer stopHeartbeat()
+	go proc.RunHeartbeat(heartbeatCtx)
+
+	// Run a command instead of the service when one is given
+	if flag.NArg() > 0 {
+		code := runCommand(context.Background(), &commandEnv{cfg: cfg, proc: proc, scan: scan}, flag.Args())
+		stopHeartbeat()
+		if err := db.Close(); err != nil {
+			log.Error().Err(err).Msg("Error closing database connection")
+		}
+		os.Exit(code)
+	}
+
+	// Initialize dispatcher
+	disp := dispatcher.New(cfg, db, scan, proc)
+
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -158,14 +190,14 @@ func main() {
 			// Start the watcher
 			if err := scan.StartWatching(); err != nil {
 				log.Error().Err(err).Msg("Failed to start file system watcher, falling back to periodic scanning")
-				startPeriodicScanner(ctx, scan, proc, cfg)
+				startPeriodicScanner(ctx, scan, disp, cfg)
 				return
 			}
 
 			log.Info().Msg("File system watcher started successfully")
 
-			// Wait for context cancellation
-			<-ctx.Done()
+			// Dispatch files discovered by the watcher until context cancellation
+			disp.Run(ctx)
 
 			// Stop the watcher
 			if err := scan.StopWatching(); err != nil {
@@ -176,7 +208,7 @@ func main() {
 		} else {
 			// Use periodic scanning
 			log.Info().Msg("Using periodic scanning mode")
-			startPeriodicScanner(ctx, scan, proc, cfg)
+			startPeriodicScanner(ctx, scan, disp, cfg)
 		}
 	}()
 
@@ -228,11 +260,12 @@ func main() {
 }
 
 // startPeriodicScanner starts a periodic scanner that scans for new files at regular intervals
-func startPeriodicScanner(ctx context.Context, scan *scanner.Scanner, proc *processor.Processor, cfg *config.Config) {
+func startPeriodicScanner(ctx context.Context, scan *scanner.Scanner, disp *dispatcher.Dispatcher, cfg *config.Config) {
 	log.Info().Int("interval_minutes", cfg.ScanInterval).Msg("Starting periodic scanner")
 
-	// Initial scan
-	scanAndProcess(ctx, scan, proc, cfg.WorkerPool.Enabled)
+	// Resume work left over from previous runs, then scan
+	disp.Recover(ctx, true)
+	scanAndProcess(ctx, scan, disp)
 
 	// Setup ticker for periodic scanning
 	ticker := time.NewTicker(time.Duration(cfg.ScanInterval) * time.Minute)
@@ -244,13 +277,19 @@ func startPeriodicScanner(ctx context.Context, scan *scanner.Scanner, proc *proc
 			log.Info().Msg("Periodic scanner stopping")
 			return
 		case <-ticker.C:
-			scanAndProcess(ctx, scan, proc, cfg.WorkerPool.Enabled)
+			disp.Recover(ctx, false)
+			scanAndProcess(ctx, scan, disp)
 		}
 	}
 }
 
-// scanAndProcess scans for new files and processes them
-func scanAndProcess(ctx context.Context, scan *scanner.Scanner, proc *processor.Processor, useWorkerPool bool) {
+// scanAndProcess dispatches pending files, then scans for new files and processes them
+func scanAndProcess(ctx context.Context, scan *scanner.Scanner, disp *dispatcher.Dispatcher) {
+	// Files left pending by earlier runs or returned by recovery are not found by the scan
+	if err := disp.DispatchPending(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to dispatch pending media files")
+	}
+
 	log.Info().Msg("Starting scan for new files")
 
 	// Scan for new files
@@ -264,6 +303,7 @@ func scanAndProcess(ctx context.Context, scan *scanner.Scanner, proc *processor.
 		Int("new_files", len(result.NewFiles)).
 		Int("batch_dirs", len(result.BatchDirs)).
 		Int("excluded_files", len(result.ExcludedFiles)).
+		Int("unstable_files", len(result.UnstableFiles)).
 		Msg("Scan completed")
 
 	// Process batch directories
@@ -277,21 +317,8 @@ func scanAndProcess(ctx context.Context, scan *scanner.Scanner, proc *processor.
 			continue
 		}
 
-		if useWorkerPool {
-			// Queue batch process for processing
-			if err := proc.QueueBatchProcess(batchProcess); err != nil {
-				log.Error().Err(err).Str("directory", dir).Msg("Failed to queue batch process")
-			} else {
-				log.Info().Str("directory", dir).Msg("Batch process queued successfully")
-			}
-		} else {
-			// Process batch directly
-			if err := proc.ProcessBatchFiles(ctx, batchProcess); err != nil {
-				log.Error().Err(err).Str("directory", dir).Msg("Failed to process batch")
-			} else {
-				log.Info().Str("directory", dir).Msg("Batch processed successfully")
-			}
-		}
+		// Queue or process the batch
+		_ = disp.DispatchBatch(ctx, batchProcess)
 	}
 
 	// Process individual files (not in batch directories)
@@ -320,21 +347,8 @@ func scanAndProcess(ctx context.Context, scan *scanner.Scanner, proc *processor.
 			continue
 		}
 
-		if useWorkerPool {
-			// Queue media file for processing
-			if err := proc.QueueMediaFile(mediaFile); err != nil {
-				log.Error().Err(err).Str("file", file).Msg("Failed to queue media file")
-			} else {
-				log.Debug().Str("file", file).Msg("Media file queued successfully")
-			}
-		} else {
-			// Process media file directly
-			if err := proc.ProcessMediaFile(ctx, mediaFile); err != nil {
-				log.Error().Err(err).Str("file", file).Msg("Failed to process media file")
-			} else {
-				log.Info().Str("file", file).Msg("Media file processed successfully")
-			}
-		}
+		// Queue or process the media file
+		_ = disp.DispatchMediaFile(ctx, mediaFile)
 	}
 
 	log.Info().Int("individual_files", individualFiles).Msg("Individual file processing completed")
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/processor"
+)
+
+// runPlan scans for new files and prints how they would be organised
+func runPlan(ctx context.Context, env *commandEnv, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	output := fs.String("o", "", "Save the plan as JSON to this file, to apply it later")
+	asJSON := fs.Bool("json", false, "Print the plan as JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	// Directories given on the command line replace the configured media directories
+	if fs.NArg() > 0 {
+		env.cfg.Scanner.MediaDirs = fs.Args()
+	}
+
+	result, err := env.scan.Scan()
+	if err != nil {
+		return fmt.Errorf("error scanning: %w", err)
+	}
+	if len(result.UnstableFiles) > 0 {
+		fmt.Fprintf(os.Stderr, "%d files are still being downloaded and were not planned\n", len(result.UnstableFiles))
+	}
+
+	plan := env.proc.PlanFiles(ctx, result.NewFiles, result.BatchDirs)
+
+	if *output != "" {
+		if err := processor.SavePlan(plan, *output); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Plan saved to %s\n", *output)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	return printPlan(plan)
+}
+
+// printPlan prints a plan as a table
+func printPlan(plan *processor.Plan) error {
+	if len(plan.Entries) == 0 {
+		fmt.Println("No new files")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tSOURCE\tDESTINATION\tIDENTIFICATION\tCONFIDENCE\tBY")
+	var planned, review, failed int
+	for _, entry := range plan.Entries {
+		status := "ok"
+		switch {
+		case entry.Error != "":
+			status = "error"
+			failed++
+		case entry.NeedsReview:
+			status = "review"
+			review++
+		default:
+			planned++
+		}
+
+		destination := entry.Destination
+		if rel, err := filepath.Rel(plan.DestinationRoot, destination); err == nil && destination != "" {
+			destination = rel
+		}
+		if entry.Error != "" {
+			destination = entry.Error
+		}
+
+		identification, confidence := "-", "-"
+		if entry.Identification != nil {
+			identification = formatIdentification(entry.Identification)
+			confidence = fmt.Sprintf("%.2f", entry.Identification.Confidence)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", status, filepath.Base(entry.SourcePath), destination, identification, confidence, entry.IdentifiedBy)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d files: %d planned, %d for review, %d failed (mode %s, destination %s)\n",
+		len(plan.Entries), planned, review, failed, plan.Mode, plan.DestinationRoot)
+	return nil
+}
+
+// formatIdentification formats an identification as a single line
+func formatIdentification(result *llm.MediaFileResult) string {
+	var sb strings.Builder
+	sb.WriteString(result.Title)
+	if result.Year > 0 {
+		fmt.Fprintf(&sb, " (%d)", result.Year)
+	}
+	fmt.Fprintf(&sb, " [%s]", result.MediaType)
+	if episode := formatEpisode(result.MediaType, result.Season, result.Episode, result.EndEpisode, result.Part); episode != "-" {
+		sb.WriteString(" " + episode)
+	}
+	if ids := formatIDs(result.TMDBID, result.TVDBID, result.BangumiID); ids != "-" {
+		sb.WriteString(" " + ids)
+	}
+	return sb.String()
+}
+
+// runApply organises files as described by a saved plan
+func runApply(ctx context.Context, proc *processor.Processor, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: apply <plan.json>")
+	}
+
+	plan, err := processor.LoadPlan(args[0])
+	if err != nil {
+		return err
+	}
+
+	results := proc.ApplyPlan(ctx, plan)
+	failed := 0
+	for _, result := range results {
+		switch result.Status {
+		case "success":
+			fmt.Printf("%-8s %s -> %s\n", result.Status, result.SourcePath, result.Destination)
+		case "failed":
+			failed++
+			fmt.Printf("%-8s %s: %s\n", result.Status, result.SourcePath, result.Reason)
+		default:
+			if result.Reason != "" {
+				fmt.Printf("%-8s %s: %s\n", result.Status, result.SourcePath, result.Reason)
+			} else {
+				fmt.Printf("%-8s %s\n", result.Status, result.SourcePath)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/processor"
+)
+
+// runReview runs a review subcommand
+func runReview(ctx context.Context, proc *processor.Processor, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing review command: list, show, accept or correct")
+	}
+
+	switch args[0] {
+	case "list":
+		return reviewList(proc)
+	case "show":
+		id, err := parseMediaFileID(args[1:])
+		if err != nil {
+			return err
+		}
+		return reviewShow(proc, id)
+	case "accept":
+		id, err := parseMediaFileID(args[1:])
+		if err != nil {
+			return err
+		}
+		rank := 1
+		if len(args) > 2 {
+			if rank, err = strconv.Atoi(args[2]); err != nil {
+				return fmt.Errorf("invalid candidate rank: %s", args[2])
+			}
+		}
+		if err := proc.AcceptCandidate(ctx, id, rank); err != nil {
+			return err
+		}
+		return reviewResult(proc, id)
+	case "correct":
+		id, err := parseMediaFileID(args[1:])
+		if err != nil {
+			return err
+		}
+
+		var correction processor.Correction
+		fs := flag.NewFlagSet("review correct", flag.ContinueOnError)
+		fs.StringVar(&correction.MediaType, "type", "", "Media type: movie or tv (inferred when omitted)")
+		fs.Int64Var(&correction.TMDBID, "tmdb", 0, "TMDB ID")
+		fs.Int64Var(&correction.TVDBID, "tvdb", 0, "TVDB ID")
+		fs.Int64Var(&correction.BangumiID, "bangumi", 0, "Bangumi ID")
+		fs.IntVar(&correction.Season, "season", 0, "Season number")
+		fs.IntVar(&correction.Episode, "episode", 0, "Episode number")
+		fs.IntVar(&correction.EndEpisode, "end-episode", 0, "Last episode number of a multi-episode file")
+		fs.IntVar(&correction.Part, "part", 0, "Part number of a multi-part movie")
+		fs.StringVar(&correction.Category, "category", "", "Destination category (best candidate or category rules when omitted)")
+		fs.StringVar(&correction.Subcategory, "subcategory", "", "Destination subcategory")
+		if err := fs.Parse(args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+
+		if err := proc.ApplyCorrection(ctx, id, &correction); err != nil {
+			return err
+		}
+		return reviewResult(proc, id)
+	default:
+		return fmt.Errorf("unknown review command: %s", args[0])
+	}
+}
+
+// parseMediaFileID parses the media file ID argument of a review command
+func parseMediaFileID(args []string) (int64, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("missing media file ID")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid media file ID: %s", args[0])
+	}
+	return id, nil
+}
+
+// reviewList prints the media files awaiting review
+func reviewList(proc *processor.Processor) error {
+	items, err := proc.ListReviewItems()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("No files awaiting review")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tFILE\tBEST GUESS\tCANDIDATES")
+	for _, item := range items {
+		guess := "-"
+		if item.MediaInfo != nil && item.MediaInfo.Title != "" {
+			guess = formatMediaInfo(item.MediaInfo)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", item.File.ID, item.File.Status, item.File.OriginalName, guess, len(item.Candidates))
+	}
+	return w.Flush()
+}
+
+// reviewShow prints a media file with its stored identification and candidates
+func reviewShow(proc *processor.Processor, id int64) error {
+	item, err := proc.GetReviewItem(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("File:    %s\n", item.File.OriginalPath)
+	fmt.Printf("Status:  %s\n", item.File.Status)
+	if item.File.ErrorMessage != "" {
+		fmt.Printf("Reason:  %s\n", item.File.ErrorMessage)
+	}
+	if item.MediaInfo != nil && item.MediaInfo.Title != "" {
+		fmt.Printf("Guess:   %s\n", formatMediaInfo(item.MediaInfo))
+	}
+
+	if len(item.Candidates) == 0 {
+		fmt.Println("\nNo candidates, use 'review correct' to identify the file")
+		return nil
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tTITLE\tYEAR\tTYPE\tEPISODE\tIDS\tCATEGORY\tCONFIDENCE\tSOURCE")
+	for _, c := range item.Candidates {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\t%.2f\t%s\n",
+			c.Rank, c.Title, c.Year, c.MediaType, formatEpisode(c.MediaType, c.Season, c.Episode, c.EndEpisode, c.Part),
+			formatIDs(c.TMDBID, c.TVDBID, c.BangumiID), formatCategory(c.Category, c.Subcategory), c.Confidence, c.Source)
+	}
+	return w.Flush()
+}
+
+// reviewResult prints where a reviewed media file was organised
+func reviewResult(proc *processor.Processor, id int64) error {
+	item, err := proc.GetReviewItem(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s -> %s\n", item.File.OriginalPath, item.File.DestinationPath)
+	return nil
+}
+
+// formatMediaInfo formats a stored identification as a single line
+func formatMediaInfo(info *models.MediaInfo) string {
+	s := fmt.Sprintf("%s (%d) [%s]", info.Title, info.Year, info.MediaType)
+	if episode := formatEpisode(info.MediaType, info.Season, info.Episode, info.EndEpisode, info.Part); episode != "-" {
+		s += " " + episode
+	}
+	return s
+}
+
+// formatEpisode formats the episode numbers of a TV show or the part of a movie
+func formatEpisode(mediaType string, season, episode, endEpisode, part int) string {
+	switch {
+	case mediaType == "tv" && endEpisode > episode:
+		return fmt.Sprintf("S%02dE%02d-E%02d", season, episode, endEpisode)
+	case mediaType == "tv":
+		return fmt.Sprintf("S%02dE%02d", season, episode)
+	case part > 0:
+		return fmt.Sprintf("part%d", part)
+	}
+	return "-"
+}
+
+// formatIDs formats the provider IDs of a candidate
+func formatIDs(tmdbID, tvdbID, bangumiID int64) string {
+	s := ""
+	for _, id := range []struct {
+		provider string
+		id       int64
+	}{{"tmdb", tmdbID}, {"tvdb", tvdbID}, {"bangumi", bangumiID}} {
+		if id.id == 0 {
+			continue
+		}
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("%s:%d", id.provider, id.id)
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatCategory formats a destination category
+func formatCategory(category, subcategory string) string {
+	switch {
+	case category == "":
+		return "-"
+	case subcategory == "":
+		return category
+	default:
+		return category + "/" + subcategory
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/processor"
+)
+
+// runUndo runs an undo subcommand
+func runUndo(proc *processor.Processor, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: undo file <id> | undo batch <id> | undo since <time|duration>")
+	}
+
+	var results []processor.UndoResult
+	var err error
+	switch args[0] {
+	case "file":
+		id, parseErr := parseMediaFileID(args[1:])
+		if parseErr != nil {
+			return parseErr
+		}
+		results, err = proc.UndoMediaFile(id)
+	case "batch":
+		id, parseErr := parseMediaFileID(args[1:])
+		if parseErr != nil {
+			return fmt.Errorf("invalid batch ID: %s", args[1])
+		}
+		results, err = proc.UndoBatch(id)
+	case "since":
+		since, parseErr := parseSince(args[1], time.Now())
+		if parseErr != nil {
+			return parseErr
+		}
+		results, err = proc.UndoSince(since)
+	default:
+		return fmt.Errorf("unknown undo command: %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Println("Nothing to undo")
+		return nil
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("FAILED  %s: %v\n", result.Operation.DestinationPath, result.Err)
+			continue
+		}
+		fmt.Printf("undone  %s -> %s\n", result.Operation.DestinationPath, result.Operation.SourcePath)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d operations could not be undone", failed, len(results))
+	}
+	return nil
+}
+
+// parseSince parses a point in time given as RFC 3339 timestamp, date, local
+// date and time, or as duration before now
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", value)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/processor"
+)
+
+// runUsage reports the LLM usage and cost
+func runUsage(proc *processor.Processor, args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	by := fs.String("by", processor.UsageByDay, "Group by day, provider, model or file")
+	sinceValue := fs.String("since", "720h", "Report usage since a time (RFC 3339, 2006-01-02) or duration (24h)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	since, err := parseSince(*sinceValue, time.Now())
+	if err != nil {
+		return err
+	}
+	rows, err := proc.LLMUsage(since, *by)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		fmt.Println("No LLM requests")
+		return nil
+	}
+
+	total := processor.UsageRow{Key: "TOTAL"}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tFAILED\tPROMPT\tCOMPLETION\tCOST\tAVG LATENCY\n", strings.ToUpper(*by))
+	for _, row := range rows {
+		printUsageRow(w, row)
+		total.Requests += row.Requests
+		total.Failed += row.Failed
+		total.PromptTokens += row.PromptTokens
+		total.CompletionTokens += row.CompletionTokens
+		total.Cost += row.Cost
+		total.Latency += row.Latency * time.Duration(row.Requests)
+	}
+	total.Latency /= time.Duration(total.Requests)
+	printUsageRow(w, total)
+	return w.Flush()
+}
+
+// printUsageRow prints a row of the usage report
+func printUsageRow(w *tabwriter.Writer, row processor.UsageRow) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.4f\t%s\n",
+		row.Key, row.Requests, row.Failed, row.PromptTokens, row.CompletionTokens, row.Cost, row.Latency.Round(time.Millisecond))
+}
@@ -59,3 +59,14 @@ func New(cfg *config.APIConfig, db *database.Database) (*API, error) {
 		RateLimiter: rateLimiter,
 	}, nil
 }
+
+// MediaDetails holds the provider details fetched for a single media file.
+// Fields are nil when the corresponding provider was not queried.
+type MediaDetails struct {
+	Movie      *MovieDetails
+	TVShow     *TVDetails
+	Season     *SeasonDetails
+	TVDBSeries *TVDBSeriesDetails
+	TVDBSeason *TVDBSeasonEpisodes
+	Bangumi    *BangumiAnimeDetails
+}
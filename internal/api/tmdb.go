@@ -280,8 +280,10 @@ func (c *TMDBClient) GetMovieDetails(ctx context.Context, id int) (*MovieDetails
 
 	// Process production countries
 	countries := make([]string, 0, len(movie.ProductionCountries))
+	countryCodes := make([]string, 0, len(movie.ProductionCountries))
 	for _, country := range movie.ProductionCountries {
 		countries = append(countries, country.Name)
+		countryCodes = append(countryCodes, country.Iso3166_1)
 	}
 
 	// Process spoken languages
@@ -300,13 +302,15 @@ func (c *TMDBClient) GetMovieDetails(ctx context.Context, id int) (*MovieDetails
 		PosterPath:    movie.PosterPath,
 		BackdropPath:  movie.BackdropPath,
 		// Get ImdbID from movie details
-		ImdbID:      movie.IMDbID,
-		Genres:      genres,
-		Countries:   countries,
-		Languages:   languages,
-		Runtime:     movie.Runtime,
-		VoteAverage: movie.VoteAverage,
-		VoteCount:   movie.VoteCount,
+		ImdbID:           movie.IMDbID,
+		Genres:           genres,
+		Countries:        countries,
+		CountryCodes:     countryCodes,
+		Languages:        languages,
+		OriginalLanguage: movie.OriginalLanguage,
+		Runtime:          movie.Runtime,
+		VoteAverage:      movie.VoteAverage,
+		VoteCount:        movie.VoteCount,
 	}
 
 	// Cache the result if caching is enabled
@@ -387,6 +391,13 @@ func (c *TMDBClient) GetTVDetails(ctx context.Context, id int) (*TVDetails, erro
 		countries = append(countries, country.Name)
 	}
 
+	// Origin countries are more reliable than production countries for categorisation
+	countryCodes := make([]string, 0, len(tv.OriginCountry)+len(tv.ProductionCountries))
+	countryCodes = append(countryCodes, tv.OriginCountry...)
+	for _, country := range tv.ProductionCountries {
+		countryCodes = append(countryCodes, country.Iso3166_1)
+	}
+
 	// Process spoken languages
 	languages := make([]string, 0)
 	// Note: SpokenLanguages field is not directly accessible in the current version of the library
@@ -403,14 +414,16 @@ func (c *TMDBClient) GetTVDetails(ctx context.Context, id int) (*TVDetails, erro
 		BackdropPath: tv.BackdropPath,
 		// Note: ExternalIDs field is not directly accessible in the current version of the library
 		// We would need to use GetTVExternalIDs method to get this information
-		ImdbID:          "", // Placeholder
-		TVDBID:          0,  // Placeholder
-		Genres:          genres,
-		Countries:       countries,
-		Languages:       languages,
-		NumberOfSeasons: tv.NumberOfSeasons,
-		VoteAverage:     tv.VoteAverage,
-		VoteCount:       tv.VoteCount,
+		ImdbID:           "", // Placeholder
+		TVDBID:           0,  // Placeholder
+		Genres:           genres,
+		Countries:        countries,
+		CountryCodes:     countryCodes,
+		Languages:        languages,
+		OriginalLanguage: tv.OriginalLanguage,
+		NumberOfSeasons:  tv.NumberOfSeasons,
+		VoteAverage:      tv.VoteAverage,
+		VoteCount:        tv.VoteCount,
 	}
 
 	// Cache the result if caching is enabled
@@ -586,9 +599,150 @@ func (c *TMDBClient) GetEpisodeDetails(ctx context.Context, tvID, seasonNumber,
 	return result, nil
 }
 
-// GetImageURL gets the full URL for an image
+// GetMovieImages gets the posters, backdrops and logos of a movie
+func (c *TMDBClient) GetMovieImages(ctx context.Context, id int) (*ImageSet, error) {
+	return c.getImages(ctx, "movie_images", id, func(options map[string]string) (*ImageSet, error) {
+		images, err := c.client.GetMovieImages(id, options)
+		if err != nil {
+			return nil, fmt.Errorf("TMDB get movie images error: %w", err)
+		}
+		return &ImageSet{
+			Posters:   convertMovieImages(images.Posters),
+			Backdrops: convertMovieImages(images.Backdrops),
+			Logos:     convertMovieImages(images.Logos),
+		}, nil
+	})
+}
+
+// GetTVImages gets the posters, backdrops and logos of a TV show
+func (c *TMDBClient) GetTVImages(ctx context.Context, id int) (*ImageSet, error) {
+	return c.getImages(ctx, "tv_images", id, func(options map[string]string) (*ImageSet, error) {
+		images, err := c.client.GetTVImages(id, options)
+		if err != nil {
+			return nil, fmt.Errorf("TMDB get TV images error: %w", err)
+		}
+		return &ImageSet{
+			Posters:   convertTVImages(images.Posters),
+			Backdrops: convertTVImages(images.Backdrops),
+			Logos:     convertTVImages(images.Logos),
+		}, nil
+	})
+}
+
+// getImages wraps an image request with caching and rate limiting
+func (c *TMDBClient) getImages(ctx context.Context, kind string, id int, fetch func(options map[string]string) (*ImageSet, error)) (*ImageSet, error) {
+	cacheKey := fmt.Sprintf("%s:%d", kind, id)
+
+	// Check if cache is enabled
+	if c.cacheConfig != nil && c.cacheConfig.Enabled {
+		// Check cache first
+		cache, err := c.db.GetAPICache("tmdb", cacheKey)
+		if err == nil {
+			// Cache hit
+			var result ImageSet
+			if err := json.Unmarshal([]byte(cache.Response), &result); err == nil {
+				return &result, nil
+			}
+		}
+	}
+
+	// Apply rate limiting if enabled
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(ctx, "tmdb"); err != nil {
+			return nil, fmt.Errorf("rate limiter error: %w", err)
+		}
+	}
+
+	// Include images in the configured language, English and images without text
+	languages := "en,null"
+	if len(c.config.Language) >= 2 && c.config.Language[:2] != "en" {
+		languages = c.config.Language[:2] + "," + languages
+	}
+	options := map[string]string{
+		"include_image_language": languages,
+	}
+
+	result, err := fetch(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache the result if caching is enabled
+	if c.cacheConfig != nil && c.cacheConfig.Enabled {
+		resultJSON, err := json.Marshal(result)
+		if err == nil {
+			// Calculate cache expiration based on configuration
+			ttl := time.Duration(c.cacheConfig.DetailsTTL) * time.Hour
+			if ttl <= 0 {
+				ttl = 7 * 24 * time.Hour // Default to 7 days if not configured
+			}
+
+			cache := &models.APICache{
+				Provider:  "tmdb",
+				Query:     cacheKey,
+				Response:  string(resultJSON),
+				ExpiresAt: time.Now().Add(ttl),
+			}
+			_ = c.db.CreateAPICache(cache)
+		}
+	}
+
+	return result, nil
+}
+
+// convertMovieImages converts TMDB movie images
+func convertMovieImages(images []tmdb.MovieImage) []Image {
+	result := make([]Image, 0, len(images))
+	for _, image := range images {
+		result = append(result, Image{
+			FilePath:    image.FilePath,
+			Language:    image.Iso639_1,
+			Width:       image.Width,
+			Height:      image.Height,
+			VoteAverage: image.VoteAverage,
+		})
+	}
+	return result
+}
+
+// convertTVImages converts TMDB TV images
+func convertTVImages(images []tmdb.TVImage) []Image {
+	result := make([]Image, 0, len(images))
+	for _, image := range images {
+		result = append(result, Image{
+			FilePath:    image.FilePath,
+			Language:    image.Iso639_1,
+			Width:       image.Width,
+			Height:      image.Height,
+			VoteAverage: image.VoteAverage,
+		})
+	}
+	return result
+}
+
+// GetImageURL gets the full URL for an image. Unknown sizes fall back to the original image.
 func (c *TMDBClient) GetImageURL(path string, size string) string {
-	return tmdb.GetImageURL(path, size)
+	url := tmdb.GetImageURL(path, size)
+	if url == path {
+		url = tmdb.GetImageURL(path, tmdb.Original)
+	}
+	return url
+}
+
+// Image represents an image of a movie or TV show
+type Image struct {
+	FilePath    string  `json:"file_path"`
+	Language    string  `json:"language"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	VoteAverage float32 `json:"vote_average"`
+}
+
+// ImageSet represents the images of a movie or TV show
+type ImageSet struct {
+	Posters   []Image `json:"posters"`
+	Backdrops []Image `json:"backdrops"`
+	Logos     []Image `json:"logos"`
 }
 
 // Movie represents a movie search result
@@ -633,39 +787,43 @@ type TVSearchResult struct {
 
 // MovieDetails represents detailed information about a movie
 type MovieDetails struct {
-	ID            int64    `json:"id"`
-	Title         string   `json:"title"`
-	OriginalTitle string   `json:"original_title"`
-	ReleaseYear   int      `json:"release_year"`
-	Overview      string   `json:"overview"`
-	PosterPath    string   `json:"poster_path"`
-	BackdropPath  string   `json:"backdrop_path"`
-	ImdbID        string   `json:"imdb_id"`
-	Genres        []string `json:"genres"`
-	Countries     []string `json:"countries"`
-	Languages     []string `json:"languages"`
-	Runtime       int      `json:"runtime"`
-	VoteAverage   float32  `json:"vote_average"`
-	VoteCount     int64    `json:"vote_count"`
+	ID               int64    `json:"id"`
+	Title            string   `json:"title"`
+	OriginalTitle    string   `json:"original_title"`
+	ReleaseYear      int      `json:"release_year"`
+	Overview         string   `json:"overview"`
+	PosterPath       string   `json:"poster_path"`
+	BackdropPath     string   `json:"backdrop_path"`
+	ImdbID           string   `json:"imdb_id"`
+	Genres           []string `json:"genres"`
+	Countries        []string `json:"countries"`
+	CountryCodes     []string `json:"country_codes"` // ISO 3166-1
+	Languages        []string `json:"languages"`
+	OriginalLanguage string   `json:"original_language"` // ISO 639-1
+	Runtime          int      `json:"runtime"`
+	VoteAverage      float32  `json:"vote_average"`
+	VoteCount        int64    `json:"vote_count"`
 }
 
 // TVDetails represents detailed information about a TV show
 type TVDetails struct {
-	ID              int64    `json:"id"`
-	Name            string   `json:"name"`
-	OriginalName    string   `json:"original_name"`
-	FirstAirYear    int      `json:"first_air_year"`
-	Overview        string   `json:"overview"`
-	PosterPath      string   `json:"poster_path"`
-	BackdropPath    string   `json:"backdrop_path"`
-	ImdbID          string   `json:"imdb_id"`
-	TVDBID          int      `json:"tvdb_id"`
-	Genres          []string `json:"genres"`
-	Countries       []string `json:"countries"`
-	Languages       []string `json:"languages"`
-	NumberOfSeasons int      `json:"number_of_seasons"`
-	VoteAverage     float32  `json:"vote_average"`
-	VoteCount       int64    `json:"vote_count"`
+	ID               int64    `json:"id"`
+	Name             string   `json:"name"`
+	OriginalName     string   `json:"original_name"`
+	FirstAirYear     int      `json:"first_air_year"`
+	Overview         string   `json:"overview"`
+	PosterPath       string   `json:"poster_path"`
+	BackdropPath     string   `json:"backdrop_path"`
+	ImdbID           string   `json:"imdb_id"`
+	TVDBID           int      `json:"tvdb_id"`
+	Genres           []string `json:"genres"`
+	Countries        []string `json:"countries"`
+	CountryCodes     []string `json:"country_codes"` // ISO 3166-1, origin countries first
+	Languages        []string `json:"languages"`
+	OriginalLanguage string   `json:"original_language"` // ISO 639-1
+	NumberOfSeasons  int      `json:"number_of_seasons"`
+	VoteAverage      float32  `json:"vote_average"`
+	VoteCount        int64    `json:"vote_count"`
 }
 
 // SeasonDetails represents detailed information about a TV show season
@@ -448,6 +448,140 @@ func (c *TVDBClient) GetSeasonEpisodes(ctx context.Context, seasonID int) (*TVDB
 	return result, nil
 }
 
+// GetSeriesArtworks gets the artworks (posters, banners, backgrounds, logos) of a TV series
+func (c *TVDBClient) GetSeriesArtworks(ctx context.Context, id int) (*TVDBArtworks, error) {
+	// Check if cache is enabled
+	if c.cacheConfig != nil && c.cacheConfig.Enabled {
+		// Check cache first
+		cacheKey := fmt.Sprintf("artworks:%d", id)
+		cache, err := c.db.GetAPICache("tvdb", cacheKey)
+		if err == nil {
+			// Cache hit
+			var result TVDBArtworks
+			if err := json.Unmarshal([]byte(cache.Response), &result); err == nil {
+				return &result, nil
+			}
+		}
+	}
+
+	// Apply rate limiting if enabled
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(ctx, "tvdb"); err != nil {
+			return nil, fmt.Errorf("rate limiter error: %w", err)
+		}
+	}
+
+	// Cache miss or cache disabled, perform API call
+	endpoint := fmt.Sprintf("%s/series/%d/artworks", c.baseURL, id)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	req.Header.Set("Accept", "application/json")
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("TVDB API error: %s - %s", resp.Status, string(body))
+	}
+
+	var apiResp struct {
+		Data struct {
+			ID       int `json:"id"`
+			Artworks []struct {
+				ID       int    `json:"id"`
+				Image    string `json:"image"`
+				Language string `json:"language"`
+				Type     int    `json:"type"`
+				Score    int    `json:"score"`
+				Width    int    `json:"width"`
+				Height   int    `json:"height"`
+			} `json:"artworks"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	// Process artworks
+	artworks := make([]TVDBArtwork, 0, len(apiResp.Data.Artworks))
+	for _, artwork := range apiResp.Data.Artworks {
+		artworks = append(artworks, TVDBArtwork{
+			ID:       artwork.ID,
+			ImageURL: artwork.Image,
+			Language: artwork.Language,
+			Type:     artwork.Type,
+			Score:    artwork.Score,
+			Width:    artwork.Width,
+			Height:   artwork.Height,
+		})
+	}
+
+	// Create result
+	result := &TVDBArtworks{
+		SeriesID: apiResp.Data.ID,
+		Artworks: artworks,
+	}
+
+	// Cache the result if caching is enabled
+	if c.cacheConfig != nil && c.cacheConfig.Enabled {
+		resultJSON, err := json.Marshal(result)
+		if err == nil {
+			// Calculate cache expiration based on configuration
+			ttl := time.Duration(c.cacheConfig.DetailsTTL) * time.Hour
+			if ttl <= 0 {
+				ttl = 7 * 24 * time.Hour // Default to 7 days if not configured
+			}
+
+			cache := &models.APICache{
+				Provider:  "tvdb",
+				Query:     fmt.Sprintf("artworks:%d", id),
+				Response:  string(resultJSON),
+				ExpiresAt: time.Now().Add(ttl),
+			}
+			_ = c.db.CreateAPICache(cache)
+		}
+	}
+
+	return result, nil
+}
+
+// TVDB artwork types for series
+const (
+	TVDBArtworkBanner     = 1
+	TVDBArtworkPoster     = 2
+	TVDBArtworkBackground = 3
+	TVDBArtworkClearLogo  = 23
+)
+
+// TVDBArtworks represents the artworks of a TV series
+type TVDBArtworks struct {
+	SeriesID int           `json:"series_id"`
+	Artworks []TVDBArtwork `json:"artworks"`
+}
+
+// TVDBArtwork represents a single TV series artwork
+type TVDBArtwork struct {
+	ID       int    `json:"id"`
+	ImageURL string `json:"image_url"`
+	Language string `json:"language"`
+	Type     int    `json:"type"`
+	Score    int    `json:"score"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
 // TVDBSeries represents a TV series search result
 type TVDBSeries struct {
 	ID             int    `json:"id"`
@@ -18,6 +18,9 @@ type Config struct {
 	// LLM settings
 	LLM LLMConfig `json:"llm" yaml:"llm"`
 
+	// Local filename parser settings
+	Parser ParserConfig `json:"parser" yaml:"parser"`
+
 	// API settings
 	APIs APIConfig `json:"apis" yaml:"apis"`
 
@@ -47,6 +50,87 @@ type LLMConfig struct {
 	BatchSystemPrompt string `json:"batch_system_prompt" yaml:"batch_system_prompt"` // Custom system prompt for batch processing
 	MaxRetries        int    `json:"max_retries" yaml:"max_retries"`
 	Timeout           int    `json:"timeout" yaml:"timeout"` // in seconds
+
+	// Identifications below this confidence (0-1) are held for manual review; 0 disables the check
+	ConfidenceThreshold float64 `json:"confidence_threshold" yaml:"confidence_threshold"`
+
+	// Format of the final answer: json_schema, json_object or text. The JSON is extracted from
+	// text answers; providers rejecting the format fall back to text.
+	ResponseFormat string `json:"response_format" yaml:"response_format"`
+
+	// Turns in which invalid answers are sent back to the LLM with their problems; 0 disables repairs
+	MaxRepairTurns int `json:"max_repair_turns" yaml:"max_repair_turns"`
+
+	// Prices by model used to compute the cost of LLM requests. Models are matched by the
+	// longest price key they start with, so "gpt-4o" also prices "gpt-4o-2024-08-06".
+	Prices map[string]ModelPrice `json:"prices" yaml:"prices"`
+
+	// Spending budgets. Files needing the LLM are deferred while a budget is exhausted.
+	Budget LLMBudgetConfig `json:"budget" yaml:"budget"`
+
+	// Quotas of the provider; requests wait until they fit. 0 disables a quota. Configured
+	// endpoints have quotas of their own.
+	RequestsPerMinute int `json:"requests_per_minute" yaml:"requests_per_minute"`
+	TokensPerMinute   int `json:"tokens_per_minute" yaml:"tokens_per_minute"`
+
+	// Endpoints of the fallback chain, tried in order when one fails with a transport error,
+	// a rate limit or a server error. Without endpoints the settings above form the only one.
+	Endpoints []LLMEndpoint `json:"endpoints" yaml:"endpoints"`
+}
+
+// LLMEndpoint is an endpoint of the LLM fallback chain. Empty provider, API key, base URL and
+// model are taken from the LLM settings.
+type LLMEndpoint struct {
+	Name              string `json:"name" yaml:"name"` // shown as the provider in usage reports, defaults to the provider
+	Provider          string `json:"provider" yaml:"provider"`
+	APIKey            string `json:"api_key" yaml:"api_key"`
+	BaseURL           string `json:"base_url" yaml:"base_url"`
+	Model             string `json:"model" yaml:"model"`
+	RequestsPerMinute int    `json:"requests_per_minute" yaml:"requests_per_minute"`
+	TokensPerMinute   int    `json:"tokens_per_minute" yaml:"tokens_per_minute"`
+
+	// Escalation endpoints are left out of the chain. They form a second chain, usually of a
+	// stronger model, that is asked again for files whose answer stays invalid or falls
+	// below the confidence threshold.
+	Escalation bool `json:"escalation" yaml:"escalation"`
+}
+
+// LLMBudgetConfig limits the tokens and cost of LLM requests per calendar day and month in
+// local time. 0 disables a budget.
+type LLMBudgetConfig struct {
+	DailyTokens   int64   `json:"daily_tokens" yaml:"daily_tokens"`
+	MonthlyTokens int64   `json:"monthly_tokens" yaml:"monthly_tokens"`
+	DailyCost     float64 `json:"daily_cost" yaml:"daily_cost"` // in the currency of the prices
+	MonthlyCost   float64 `json:"monthly_cost" yaml:"monthly_cost"`
+}
+
+// ModelPrice is the price of a model per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input" yaml:"input"`   // per million prompt tokens
+	Output float64 `json:"output" yaml:"output"` // per million completion tokens
+}
+
+// ParserConfig represents the local filename parser configuration
+type ParserConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Minimum parser confidence (0-1) to identify a file without the LLM
+	ConfidenceThreshold float64 `json:"confidence_threshold" yaml:"confidence_threshold"`
+
+	// Rules choosing the category of locally identified files; the first matching rule wins.
+	// Files without a matching rule are identified by the LLM.
+	CategoryRules []CategoryRule `json:"category_rules" yaml:"category_rules"`
+}
+
+// CategoryRule maps TMDB metadata to a category of the directory structure.
+// Empty conditions match everything.
+type CategoryRule struct {
+	MediaType   string   `json:"media_type" yaml:"media_type"` // movie, tv
+	Genres      []string `json:"genres" yaml:"genres"`         // Genre names, any of them must match
+	Countries   []string `json:"countries" yaml:"countries"`   // ISO 3166-1 codes, any of them must match
+	Languages   []string `json:"languages" yaml:"languages"`   // ISO 639-1 original language codes
+	Category    string   `json:"category" yaml:"category"`
+	Subcategory string   `json:"subcategory" yaml:"subcategory"`
 }
 
 // APIConfig represents the API configuration
@@ -129,6 +213,9 @@ type ScannerConfig struct {
 	// File system monitoring settings
 	UseWatcher      bool            `json:"use_watcher" yaml:"use_watcher"`
 	WatcherSettings WatcherSettings `json:"watcher_settings" yaml:"watcher_settings"`
+
+	// File stability settings
+	Stability StabilitySettings `json:"stability" yaml:"stability"`
 }
 
 // WatcherSettings represents the file system watcher settings
@@ -140,14 +227,71 @@ type WatcherSettings struct {
 	ProcessDelay int `json:"process_delay" yaml:"process_delay"`
 }
 
+// StabilitySettings represents the settings used to detect files that are still being downloaded
+type StabilitySettings struct {
+	// Whether to hold back files until they are stable
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Number of seconds a file's size and modification time must stay unchanged
+	QuietPeriod int `json:"quiet_period" yaml:"quiet_period"`
+
+	// Suffixes used by download clients for incomplete files and their side files (.part, .!qB, .aria2)
+	PartialSuffixes []string `json:"partial_suffixes" yaml:"partial_suffixes"`
+
+	// Whether to skip files that are currently opened by another process (Linux only)
+	CheckOpenFiles bool `json:"check_open_files" yaml:"check_open_files"`
+}
+
 // FileOpsConfig represents the file operations configuration
 type FileOpsConfig struct {
-	Mode               string              `json:"mode" yaml:"mode"` // copy, move, symlink
+	Mode               string              `json:"mode" yaml:"mode"` // copy, move, symlink, hardlink, reflink
 	DestinationRoot    string              `json:"destination_root" yaml:"destination_root"`
 	DirectoryStructure map[string][]string `json:"directory_structure" yaml:"directory_structure"`
 	MovieTemplate      string              `json:"movie_template" yaml:"movie_template"`
 	TVShowTemplate     string              `json:"tv_show_template" yaml:"tv_show_template"`
+	SeasonTemplate     string              `json:"season_template" yaml:"season_template"`
 	EpisodeTemplate    string              `json:"episode_template" yaml:"episode_template"`
+
+	// Copy the file when a hardlink or reflink cannot be created, e.g. across filesystems
+	LinkFallback bool `json:"link_fallback" yaml:"link_fallback"`
+
+	// What to do when the destination already exists: skip, overwrite, keep-both, upgrade.
+	// Upgrade replaces the existing file only with a better resolution, source, codec or size.
+	ConflictPolicy string `json:"conflict_policy" yaml:"conflict_policy"`
+	RecycleDir     string `json:"recycle_dir" yaml:"recycle_dir"`   // Replaced files are moved here, or removed if empty
+	FFprobePath    string `json:"ffprobe_path" yaml:"ffprobe_path"` // Probes the quality of files whose names lack it, empty to disable
+
+	// Sidecar files sharing the video's name, e.g. subtitles, are organised along with it
+	SidecarExtensions []string `json:"sidecar_extensions" yaml:"sidecar_extensions"`
+
+	// Artwork download settings
+	Artwork ArtworkConfig `json:"artwork" yaml:"artwork"`
+
+	// Source-side cleanup settings (move mode only)
+	Cleanup CleanupConfig `json:"cleanup" yaml:"cleanup"`
+}
+
+// ArtworkConfig represents the artwork download configuration
+type ArtworkConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// TMDB image sizes (w300, w500, w780, w1280, original)
+	PosterSize   string `json:"poster_size" yaml:"poster_size"`
+	BackdropSize string `json:"backdrop_size" yaml:"backdrop_size"`
+	LogoSize     string `json:"logo_size" yaml:"logo_size"`
+	StillSize    string `json:"still_size" yaml:"still_size"` // Episode thumbnails
+}
+
+// CleanupConfig represents the cleanup of download directories after their videos were moved
+type CleanupConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Regular expressions matched case-insensitively against the path of a file relative to
+	// its download directory, e.g. `\.nfo$` or `^screens/`; matching files are deleted
+	JunkPatterns []string `json:"junk_patterns" yaml:"junk_patterns"`
+
+	// File every deletion is logged to, in addition to the application log; empty to disable
+	LogFile string `json:"log_file" yaml:"log_file"`
 }
 
 // WorkerPoolConfig represents the worker pool configuration
@@ -159,6 +303,10 @@ type WorkerPoolConfig struct {
 	MaxConcurrentLLM    int  `json:"max_concurrent_llm" yaml:"max_concurrent_llm"`         // Maximum concurrent LLM requests
 	MaxConcurrentAPI    int  `json:"max_concurrent_api" yaml:"max_concurrent_api"`         // Maximum concurrent API requests
 	MaxConcurrentFileOp int  `json:"max_concurrent_file_op" yaml:"max_concurrent_file_op"` // Maximum concurrent file operations
+
+	// Seconds a file or batch being processed stays reserved for its instance without a heartbeat.
+	// Work whose lease expires is taken over, after a crash or by another instance.
+	LeaseDuration int `json:"lease_duration" yaml:"lease_duration"`
 }
 
 // NotificationConfig represents the notification configuration
@@ -225,9 +373,16 @@ func LoadConfig(filePath string) (*Config, error) {
 	// Apply environment variable overrides
 	applyEnvironmentOverrides(&config)
 
+	if !conflictPolicies[config.FileOps.ConflictPolicy] {
+		return nil, fmt.Errorf("unknown conflict policy: %s", config.FileOps.ConflictPolicy)
+	}
+
 	return &config, nil
 }
 
+// conflictPolicies are the accepted conflict policies, empty keeps both files
+var conflictPolicies = map[string]bool{"": true, "skip": true, "overwrite": true, "keep-both": true, "upgrade": true}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
@@ -271,8 +426,32 @@ You should use the searchTMDB, searchTVDB, and searchBangumi functions to get ac
 For anime content, prioritize using searchBangumi after confirming it's anime through TMDB/TVDB.
 
 Respond with a structured JSON array containing the media information and the appropriate destination path for each file.`,
-			MaxRetries: 3,
-			Timeout:    30,
+			MaxRetries:          3,
+			Timeout:             30,
+			ConfidenceThreshold: 0.7,
+			ResponseFormat:      "json_schema",
+			MaxRepairTurns:      2,
+			Prices: map[string]ModelPrice{
+				"gpt-3.5-turbo": {Input: 0.5, Output: 1.5},
+				"gpt-4o":        {Input: 2.5, Output: 10},
+				"gpt-4o-mini":   {Input: 0.15, Output: 0.6},
+			},
+		},
+		Parser: ParserConfig{
+			Enabled:             true,
+			ConfidenceThreshold: 0.8,
+			CategoryRules: []CategoryRule{
+				{MediaType: "movie", Genres: []string{"Animation", "动画"}, Category: "电影", Subcategory: "动画电影"},
+				{MediaType: "movie", Languages: []string{"zh", "cn"}, Category: "电影", Subcategory: "国语电影"},
+				{MediaType: "movie", Category: "电影", Subcategory: "外语电影"},
+				{MediaType: "tv", Genres: []string{"Animation", "动画"}, Category: "电视剧", Subcategory: "动画"},
+				{MediaType: "tv", Genres: []string{"Documentary", "纪录"}, Category: "电视剧", Subcategory: "纪录片"},
+				{MediaType: "tv", Genres: []string{"Reality", "Talk", "真人秀", "脱口秀"}, Category: "电视剧", Subcategory: "综艺"},
+				{MediaType: "tv", Countries: []string{"CN", "TW", "HK"}, Category: "电视剧", Subcategory: "国产剧"},
+				{MediaType: "tv", Countries: []string{"JP", "KR"}, Category: "电视剧", Subcategory: "日韩剧"},
+				{MediaType: "tv", Countries: []string{"US", "GB", "CA", "AU", "FR", "DE", "ES", "IT"}, Category: "电视剧", Subcategory: "欧美剧"},
+				{MediaType: "tv", Category: "电视剧", Subcategory: "其他"},
+			},
 		},
 		APIs: APIConfig{
 			TMDB: TMDBConfig{
@@ -322,6 +501,12 @@ Respond with a structured JSON array containing the media information and the ap
 				Recursive:    true,
 				ProcessDelay: 30, // 30 seconds
 			},
+			Stability: StabilitySettings{
+				Enabled:         true,
+				QuietPeriod:     60, // 60 seconds
+				PartialSuffixes: []string{".part", ".!qb", ".aria2", ".crdownload", ".downloading", ".tmp"},
+				CheckOpenFiles:  false,
+			},
 		},
 		FileOps: FileOpsConfig{
 			Mode:            "copy",
@@ -332,7 +517,32 @@ Respond with a structured JSON array containing the media information and the ap
 			},
 			MovieTemplate:   "{title} ({year})",
 			TVShowTemplate:  "{title} ({year})",
+			SeasonTemplate:  "Season {season}",
 			EpisodeTemplate: "{title} - S{season:02d}E{episode:02d} - {episode_title}",
+			LinkFallback:    true,
+			ConflictPolicy:  "keep-both",
+			FFprobePath:     "ffprobe",
+			SidecarExtensions: []string{
+				".srt", ".ass", ".ssa", ".sub", ".idx", ".sup", ".vtt",
+				".mka", ".jpg", ".jpeg", ".png",
+			},
+			Artwork: ArtworkConfig{
+				Enabled:      true,
+				PosterSize:   "w780",
+				BackdropSize: "original",
+				LogoSize:     "original",
+				StillSize:    "w300",
+			},
+			Cleanup: CleanupConfig{
+				Enabled: false,
+				JunkPatterns: []string{
+					`\.(nfo|txt|url|lnk|html?|sfv|md5|torrent|exe)$`,
+					`\.(jpe?g|png|gif|bmp|webp)$`,
+					`(^|[/._ -])sample([/._ -]|$)`,
+					`(^|/)(screens|screenshots|proof)/`,
+				},
+				LogFile: "logs/cleanup.log",
+			},
 		},
 		WorkerPool: WorkerPoolConfig{
 			Enabled:             true,
@@ -342,6 +552,7 @@ Respond with a structured JSON array containing the media information and the ap
 			MaxConcurrentLLM:    2,
 			MaxConcurrentAPI:    5,
 			MaxConcurrentFileOp: 3,
+			LeaseDuration:       300,
 		},
 		Notification: NotificationConfig{
 			Enabled:        false,
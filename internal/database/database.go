@@ -50,6 +50,11 @@ func New(cfg *config.DatabaseConfig) (*Database, error) {
 	return &Database{db: db}, nil
 }
 
+// NewWithDB wraps an open GORM connection, such as one to a test database
+func NewWithDB(db *gorm.DB) *Database {
+	return &Database{db: db}
+}
+
 // Migrate performs database migrations
 func (d *Database) Migrate() error {
 	return d.db.AutoMigrate(
@@ -60,6 +65,8 @@ func (d *Database) Migrate() error {
 		&models.BatchProcess{},
 		&models.BatchProcessFile{},
 		&models.Notification{},
+		&models.Candidate{},
+		&models.Operation{},
 	)
 }
 
@@ -92,6 +99,16 @@ func (d *Database) GetMediaFileByPath(path string) (*models.MediaFile, error) {
 	return &file, nil
 }
 
+// GetMediaFileByDestinationPath retrieves the organised media file at a destination path
+func (d *Database) GetMediaFileByDestinationPath(path string) (*models.MediaFile, error) {
+	var file models.MediaFile
+	err := d.db.Where("destination_path = ? AND status = ?", path, "success").Order("id DESC").First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
 // GetMediaFileByID retrieves a media file by its ID
 func (d *Database) GetMediaFileByID(id int64) (*models.MediaFile, error) {
 	var file models.MediaFile
@@ -107,6 +124,59 @@ func (d *Database) UpdateMediaFile(file *models.MediaFile) error {
 	return d.db.Save(file).Error
 }
 
+// ClaimMediaFile atomically sets a media file to processing under a lease, provided it is in
+// one of the given statuses or is processing under an expired lease. It reports whether the
+// file was claimed.
+func (d *Database) ClaimMediaFile(file *models.MediaFile, owner string, expiresAt time.Time, statuses ...string) (bool, error) {
+	now := time.Now()
+	result := d.db.Model(&models.MediaFile{}).
+		Where("id = ? AND (status IN ? OR (status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)))", file.ID, statuses, "processing", now).
+		Updates(map[string]interface{}{
+			"status":           "processing",
+			"lease_owner":      owner,
+			"lease_expires_at": expiresAt,
+			"updated_at":       now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	file.Status = "processing"
+	file.LeaseOwner = owner
+	file.LeaseExpiresAt = expiresAt
+	file.UpdatedAt = now
+	return true, nil
+}
+
+// ReleaseExpiredMediaFiles returns media files processing under an expired lease to the
+// pending state and reports how many there were
+func (d *Database) ReleaseExpiredMediaFiles() (int64, error) {
+	result := d.db.Model(&models.MediaFile{}).
+		Where("status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", "processing", time.Now()).
+		Updates(map[string]interface{}{
+			"status":      "pending",
+			"lease_owner": "",
+		})
+	return result.RowsAffected, result.Error
+}
+
+// RenewLeases extends the leases an owner holds on processing media files and batches
+func (d *Database) RenewLeases(owner string, expiresAt time.Time) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.MediaFile{}).
+			Where("lease_owner = ? AND status = ?", owner, "processing").
+			UpdateColumn("lease_expires_at", expiresAt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.BatchProcess{}).
+			Where("lease_owner = ? AND status = ?", owner, "processing").
+			UpdateColumn("lease_expires_at", expiresAt).Error
+	})
+}
+
 // CreateMediaInfo creates a new media info record
 func (d *Database) CreateMediaInfo(info *models.MediaInfo) error {
 	return d.db.Create(info).Error
@@ -147,6 +217,40 @@ func (d *Database) CreateLLMRequest(request *models.LLMRequest) error {
 	return d.db.Create(request).Error
 }
 
+// GetLLMRequestsSince retrieves the LLM requests since a point in time without their
+// messages, oldest first
+func (d *Database) GetLLMRequestsSince(since time.Time) ([]models.LLMRequest, error) {
+	var requests []models.LLMRequest
+	err := d.db.Omit("prompt", "response", "messages").Where("created_at >= ?", since).Order("id").Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// GetLLMSpendSince returns the tokens and cost of the LLM requests since a point in time
+func (d *Database) GetLLMSpendSince(since time.Time) (int64, float64, error) {
+	var spend struct {
+		Tokens int64
+		Cost   float64
+	}
+	err := d.db.Model(&models.LLMRequest{}).
+		Select("COALESCE(SUM(tokens), 0) AS tokens, COALESCE(SUM(cost), 0) AS cost").
+		Where("created_at >= ?", since).
+		Scan(&spend).Error
+	return spend.Tokens, spend.Cost, err
+}
+
+// GetBatchProcessByID retrieves a batch process by its ID
+func (d *Database) GetBatchProcessByID(id int64) (*models.BatchProcess, error) {
+	var batch models.BatchProcess
+	err := d.db.Where("id = ?", id).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
 // CreateBatchProcess creates a new batch process record
 func (d *Database) CreateBatchProcess(batch *models.BatchProcess) error {
 	return d.db.Create(batch).Error
@@ -157,6 +261,39 @@ func (d *Database) UpdateBatchProcess(batch *models.BatchProcess) error {
 	return d.db.Save(batch).Error
 }
 
+// ClaimBatchProcess atomically sets a batch process to processing under a lease, provided it
+// is pending, processing under an expired lease or already held by the owner. It reports
+// whether the batch was claimed.
+func (d *Database) ClaimBatchProcess(batch *models.BatchProcess, owner string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+	result := d.db.Model(&models.BatchProcess{}).
+		Where("id = ? AND (status = ? OR (status = ? AND (lease_owner = ? OR lease_expires_at IS NULL OR lease_expires_at < ?)))", batch.ID, "pending", "processing", owner, now).
+		Updates(map[string]interface{}{
+			"status":           "processing",
+			"lease_owner":      owner,
+			"lease_expires_at": expiresAt,
+			"updated_at":       now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	batch.Status = "processing"
+	batch.LeaseOwner = owner
+	batch.LeaseExpiresAt = expiresAt
+	batch.UpdatedAt = now
+	return true, nil
+}
+
+// ReleaseBatchProcess gives up the lease on a batch process so that it is resumed later
+func (d *Database) ReleaseBatchProcess(batch *models.BatchProcess) error {
+	batch.LeaseExpiresAt = time.Time{}
+	return d.db.Model(batch).UpdateColumn("lease_expires_at", nil).Error
+}
+
 // CreateBatchProcessFile creates a new batch process file record
 func (d *Database) CreateBatchProcessFile(file *models.BatchProcessFile) error {
 	return d.db.Create(file).Error
@@ -197,6 +334,26 @@ func (d *Database) GetPendingMediaFiles() ([]models.MediaFile, error) {
 	return files, nil
 }
 
+// GetMediaFiles retrieves all media files, oldest first
+func (d *Database) GetMediaFiles() ([]models.MediaFile, error) {
+	var files []models.MediaFile
+	err := d.db.Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetMediaFilesByStatus retrieves media files in any of the given statuses, oldest first
+func (d *Database) GetMediaFilesByStatus(statuses ...string) ([]models.MediaFile, error) {
+	var files []models.MediaFile
+	err := d.db.Where("status IN ?", statuses).Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
 // GetMediaFilesByDirectory retrieves media files by directory
 func (d *Database) GetMediaFilesByDirectory(directory string) ([]models.MediaFile, error) {
 	var files []models.MediaFile
@@ -217,12 +374,90 @@ func (d *Database) GetPendingBatchProcesses() ([]models.BatchProcess, error) {
 	return batches, nil
 }
 
+// GetExpiredBatchProcesses retrieves batch processes processing under an expired lease
+func (d *Database) GetExpiredBatchProcesses() ([]models.BatchProcess, error) {
+	var batches []models.BatchProcess
+	err := d.db.Where("status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", "processing", time.Now()).Order("id").Find(&batches).Error
+	if err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
 // GetBatchProcessFilesByBatchID retrieves batch process files by batch ID
 func (d *Database) GetBatchProcessFilesByBatchID(batchID int64) ([]models.BatchProcessFile, error) {
 	var files []models.BatchProcessFile
-	err := d.db.Where("batch_process_id = ?", batchID).Find(&files).Error
+	err := d.db.Where("batch_process_id = ?", batchID).Order("id").Find(&files).Error
 	if err != nil {
 		return nil, err
 	}
 	return files, nil
 }
+
+// ReplaceCandidates replaces the review candidates of a media file
+func (d *Database) ReplaceCandidates(mediaFileID int64, candidates []models.Candidate) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_file_id = ?", mediaFileID).Delete(&models.Candidate{}).Error; err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		return tx.Create(&candidates).Error
+	})
+}
+
+// GetCandidatesByMediaFileID retrieves the review candidates of a media file, best first
+func (d *Database) GetCandidatesByMediaFileID(mediaFileID int64) ([]models.Candidate, error) {
+	var candidates []models.Candidate
+	err := d.db.Where("media_file_id = ?", mediaFileID).Order("rank").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// DeleteCandidatesByMediaFileID deletes the review candidates of a media file
+func (d *Database) DeleteCandidatesByMediaFileID(mediaFileID int64) error {
+	return d.db.Where("media_file_id = ?", mediaFileID).Delete(&models.Candidate{}).Error
+}
+
+// CreateOperation creates a new operation journal entry
+func (d *Database) CreateOperation(operation *models.Operation) error {
+	return d.db.Create(operation).Error
+}
+
+// UpdateOperation updates an operation journal entry
+func (d *Database) UpdateOperation(operation *models.Operation) error {
+	return d.db.Save(operation).Error
+}
+
+// GetOperationsByMediaFileID retrieves the operations of a media file that have not been undone, newest first
+func (d *Database) GetOperationsByMediaFileID(mediaFileID int64) ([]models.Operation, error) {
+	var operations []models.Operation
+	err := d.db.Where("media_file_id = ? AND status = ?", mediaFileID, "done").Order("id DESC").Find(&operations).Error
+	if err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
+
+// GetOperationsByBatchID retrieves the operations of a batch that have not been undone, newest first
+func (d *Database) GetOperationsByBatchID(batchID int64) ([]models.Operation, error) {
+	var operations []models.Operation
+	err := d.db.Where("batch_process_id = ? AND status = ?", batchID, "done").Order("id DESC").Find(&operations).Error
+	if err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
+
+// GetOperationsSince retrieves the operations since a point in time that have not been undone, newest first
+func (d *Database) GetOperationsSince(since time.Time) ([]models.Operation, error) {
+	var operations []models.Operation
+	err := d.db.Where("created_at >= ? AND status = ?", since, "done").Order("id DESC").Find(&operations).Error
+	if err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
@@ -0,0 +1,194 @@
+// Package dbtest provides a scripted stand-in for the PostgreSQL database, so that code
+// using the database can be tested without a server. Every statement is recorded and
+// queries are answered by a function of the test.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/database"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Statement is a statement sent to the database
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// IsWrite reports whether the statement changes the database
+func (s Statement) IsWrite() bool {
+	for _, verb := range []string{"INSERT", "UPDATE", "DELETE"} {
+		if strings.HasPrefix(s.Query, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// Answer returns the rows of a query, nil for none. Inserts answered with nil are
+// given increasing IDs, updates and deletes report one affected row.
+type Answer func(query string, args []driver.Value) *Rows
+
+// Rows is the result of a query
+type Rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// RowsOf returns rows holding the given records, pointers to models
+func RowsOf(records ...any) *Rows {
+	rows := &Rows{}
+	for _, record := range records {
+		s, err := schema.Parse(record, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			panic(fmt.Sprintf("dbtest: %v", err))
+		}
+		if rows.columns == nil {
+			rows.columns = s.DBNames
+		}
+
+		value := reflect.ValueOf(record)
+		values := make([]driver.Value, 0, len(s.DBNames))
+		for _, name := range s.DBNames {
+			v, _ := s.FieldsByDBName[name].ValueOf(context.Background(), value)
+			converted, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				panic(fmt.Sprintf("dbtest: column %s: %v", name, err))
+			}
+			values = append(values, converted)
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows
+}
+
+// DB is a database whose statements are recorded and whose queries are scripted
+type DB struct {
+	*database.Database
+
+	answer     Answer
+	mu         sync.Mutex
+	statements []Statement
+	nextID     int64
+}
+
+// New returns a database answering queries with the given function, which may be nil
+func New(t testing.TB, answer Answer) *DB {
+	d := &DB{answer: answer}
+	sqlDB := sql.OpenDB(connector{d})
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Database = database.NewWithDB(db)
+	return d
+}
+
+// Statements returns the statements sent so far
+func (d *DB) Statements() []Statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Statement(nil), d.statements...)
+}
+
+// Writes returns the statements sent so far that change the database
+func (d *DB) Writes() []Statement {
+	var writes []Statement
+	for _, statement := range d.Statements() {
+		if statement.IsWrite() {
+			writes = append(writes, statement)
+		}
+	}
+	return writes
+}
+
+// run records a statement and answers it
+func (d *DB) run(query string, args []driver.NamedValue) *Rows {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	d.mu.Lock()
+	d.statements = append(d.statements, Statement{Query: query, Args: values})
+	d.mu.Unlock()
+
+	var rows *Rows
+	if d.answer != nil {
+		rows = d.answer(query, values)
+	}
+	if rows == nil && strings.HasPrefix(query, "INSERT") && strings.Contains(query, "RETURNING") {
+		d.mu.Lock()
+		d.nextID++
+		rows = &Rows{columns: []string{"id"}, values: [][]driver.Value{{d.nextID}}}
+		d.mu.Unlock()
+	}
+	if rows == nil {
+		rows = &Rows{}
+	}
+	return rows
+}
+
+// connector opens connections to a DB
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn{c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return nil }
+
+// conn is a connection to a DB, transactions are not isolated
+type conn struct{ db *DB }
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("dbtest: prepared statements are not supported")
+}
+func (c conn) Close() error              { return nil }
+func (c conn) Begin() (driver.Tx, error) { return tx{}, nil }
+
+func (c conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &rows{Rows: c.db.run(query, args)}, nil
+}
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.run(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+// tx is a transaction of a conn
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+// rows iterates over Rows
+type rows struct {
+	*Rows
+	next int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next == len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,44 @@
+package dbtest
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestDB tests that queries are answered and statements are recorded
+func TestDB(t *testing.T) {
+	db := New(t, func(query string, args []driver.Value) *Rows {
+		if strings.Contains(query, `FROM "media_files"`) {
+			return RowsOf(&models.MediaFile{ID: 7, OriginalPath: "/downloads/Heat.mkv", Status: "pending"})
+		}
+		return nil
+	})
+
+	mediaFile, err := db.GetMediaFileByPath("/downloads/Heat.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaFile.ID != 7 || mediaFile.Status != "pending" {
+		t.Errorf("Expected pending media file 7, got %+v", mediaFile)
+	}
+
+	created := &models.MediaFile{OriginalPath: "/downloads/Ronin.mkv"}
+	if err := db.CreateMediaFile(created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != 1 {
+		t.Errorf("Expected ID 1, got %d", created.ID)
+	}
+	mediaFile.Status = "success"
+	if err := db.UpdateMediaFile(mediaFile); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := db.Writes()
+	if len(writes) != 2 || !strings.HasPrefix(writes[0].Query, "INSERT") || !strings.HasPrefix(writes[1].Query, "UPDATE") {
+		t.Errorf("Expected an insert and an update, got %v", writes)
+	}
+}
@@ -0,0 +1,357 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/database"
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/processor"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+const (
+	// minDispatchInterval is the shortest interval between two dispatch passes
+	minDispatchInterval = 5 * time.Second
+	// maxDispatchInterval is the longest interval between two dispatch passes
+	maxDispatchInterval = time.Minute
+)
+
+// Dispatcher hands pending media files over to the processor
+type Dispatcher struct {
+	config    *config.Config
+	db        *database.Database
+	scanner   *scanner.Scanner
+	processor *processor.Processor
+
+	// inFlight holds the IDs of media files that have been handed to the
+	// processor but have not left the pending state yet
+	inFlight map[int64]bool
+
+	// batches holds the IDs of the media files of the dispatched batch processes, which
+	// leave the in-flight set when their batch ends
+	batches map[int64][]int64
+	mu      sync.Mutex
+}
+
+// New creates a new dispatcher
+func New(cfg *config.Config, db *database.Database, scan *scanner.Scanner, proc *processor.Processor) *Dispatcher {
+	d := &Dispatcher{
+		config:    cfg,
+		db:        db,
+		scanner:   scan,
+		processor: proc,
+		inFlight:  make(map[int64]bool),
+		batches:   make(map[int64][]int64),
+	}
+	proc.SetBatchDoneHandler(d.batchEnded)
+	return d
+}
+
+// Run dispatches pending media files until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	interval := d.processDelay() / 2
+	if interval < minDispatchInterval {
+		interval = minDispatchInterval
+	}
+	if interval > maxDispatchInterval {
+		interval = maxDispatchInterval
+	}
+
+	log.Info().
+		Dur("interval", interval).
+		Dur("process_delay", d.processDelay()).
+		Msg("Starting pending file dispatcher")
+
+	// Initial pass picks up work left over from previous runs
+	d.Recover(ctx, true)
+	if err := d.DispatchPending(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to dispatch pending media files")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Pending file dispatcher stopping")
+			return
+		case <-ticker.C:
+			d.Recover(ctx, false)
+			if err := d.DispatchPending(ctx); err != nil {
+				log.Error().Err(err).Msg("Failed to dispatch pending media files")
+			}
+		}
+	}
+}
+
+// DispatchPending routes every pending media file that has been quiet for
+// at least the configured process delay to single-file or batch processing
+func (d *Dispatcher) DispatchPending(ctx context.Context) error {
+	pending, err := d.db.GetPendingMediaFiles()
+	if err != nil {
+		return fmt.Errorf("error getting pending media files: %w", err)
+	}
+
+	d.forgetSettled(pending)
+	d.forgetDeferred()
+
+	// Group ready files by directory
+	groups := make(map[string][]*models.MediaFile)
+	for i := range pending {
+		mediaFile := &pending[i]
+		if d.isInFlight(mediaFile.ID) || !d.isReady(mediaFile) {
+			continue
+		}
+		dir := filepath.Dir(mediaFile.OriginalPath)
+		groups[dir] = append(groups[dir], mediaFile)
+	}
+
+	// Process directories in a stable order
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		files := groups[dir]
+		if d.config.Scanner.BatchThreshold > 0 && len(files) >= d.config.Scanner.BatchThreshold {
+			d.dispatchBatchDirectory(ctx, dir, files)
+			continue
+		}
+
+		for _, mediaFile := range files {
+			_ = d.DispatchMediaFile(ctx, mediaFile)
+		}
+	}
+
+	return nil
+}
+
+// Recover takes over work abandoned by a crashed or stopped instance: files it was processing
+// return to pending and are dispatched again with the other pending files, its batches are
+// resumed. At startup batches that were created but never started are resumed as well.
+func (d *Dispatcher) Recover(ctx context.Context, startup bool) {
+	recovery, err := d.processor.Recover(startup)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to recover interrupted work")
+		if recovery == nil {
+			return
+		}
+	}
+
+	for i := range recovery.Batches {
+		d.resumeBatch(ctx, &recovery.Batches[i])
+	}
+}
+
+// resumeBatch dispatches a recovered batch process. It is released again if it cannot be dispatched.
+func (d *Dispatcher) resumeBatch(ctx context.Context, batchProcess *models.BatchProcess) {
+	if err := d.DispatchBatch(ctx, batchProcess); err == nil {
+		return
+	}
+
+	if err := d.processor.ReleaseBatch(batchProcess); err != nil {
+		log.Error().Err(err).Int64("batch_id", batchProcess.ID).Msg("Failed to release batch process")
+	}
+}
+
+// dispatchBatchDirectory creates a batch process for files in the same directory and dispatches it
+func (d *Dispatcher) dispatchBatchDirectory(ctx context.Context, dir string, files []*models.MediaFile) {
+	log.Info().Str("directory", dir).Int("file_count", len(files)).Msg("Dispatching batch directory")
+
+	batchProcess, err := d.scanner.CreateBatchProcessFromMediaFiles(dir, files)
+	if err != nil {
+		log.Error().Err(err).Str("directory", dir).Msg("Failed to create batch process")
+		return
+	}
+
+	ids := make([]int64, 0, len(files))
+	for _, mediaFile := range files {
+		ids = append(ids, mediaFile.ID)
+	}
+	d.trackBatch(batchProcess.ID, ids)
+
+	_ = d.dispatchTrackedBatch(ctx, batchProcess)
+}
+
+// dispatchTrackedBatch dispatches a tracked batch process. A batch that could not be queued
+// or processed has ended; processed batches also end through the processor.
+func (d *Dispatcher) dispatchTrackedBatch(ctx context.Context, batchProcess *models.BatchProcess) error {
+	err := d.sendBatch(ctx, batchProcess)
+	if err != nil {
+		d.batchEnded(batchProcess.ID)
+	}
+	return err
+}
+
+// DispatchMediaFile queues a media file on the worker pool, or processes it
+// directly when the worker pool is disabled
+func (d *Dispatcher) DispatchMediaFile(ctx context.Context, mediaFile *models.MediaFile) error {
+	if d.processor.IsWorkerPoolEnabled() {
+		d.markInFlight(mediaFile.ID)
+		if err := d.processor.QueueMediaFile(mediaFile); err != nil {
+			d.clearInFlight(mediaFile.ID)
+			log.Error().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to queue media file")
+			return err
+		}
+		log.Debug().Str("file", mediaFile.OriginalPath).Msg("Media file queued successfully")
+		return nil
+	}
+
+	if err := d.processor.ProcessMediaFile(ctx, mediaFile); err != nil {
+		log.Error().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to process media file")
+		return err
+	}
+	log.Info().Str("file", mediaFile.OriginalPath).Msg("Media file processed successfully")
+	return nil
+}
+
+// DispatchBatch dispatches a batch process created elsewhere, such as by a scan. Its files
+// are kept from being dispatched again, on their own or in another batch, until it ends.
+func (d *Dispatcher) DispatchBatch(ctx context.Context, batchProcess *models.BatchProcess) error {
+	batchFiles, err := d.db.GetBatchProcessFilesByBatchID(batchProcess.ID)
+	if err != nil {
+		log.Error().Err(err).Int64("batch_id", batchProcess.ID).Msg("Failed to get batch process files")
+		return fmt.Errorf("error getting batch process files: %w", err)
+	}
+
+	ids := make([]int64, 0, len(batchFiles))
+	for _, batchFile := range batchFiles {
+		ids = append(ids, batchFile.MediaFileID)
+	}
+	d.trackBatch(batchProcess.ID, ids)
+
+	return d.dispatchTrackedBatch(ctx, batchProcess)
+}
+
+// sendBatch queues a batch process on the worker pool, or processes it
+// directly when the worker pool is disabled
+func (d *Dispatcher) sendBatch(ctx context.Context, batchProcess *models.BatchProcess) error {
+	if d.processor.IsWorkerPoolEnabled() {
+		if err := d.processor.QueueBatchProcess(batchProcess); err != nil {
+			log.Error().Err(err).Str("directory", batchProcess.Directory).Msg("Failed to queue batch process")
+			return err
+		}
+		log.Info().Str("directory", batchProcess.Directory).Msg("Batch process queued successfully")
+		return nil
+	}
+
+	if err := d.processor.ProcessBatchFiles(ctx, batchProcess); err != nil {
+		log.Error().Err(err).Str("directory", batchProcess.Directory).Msg("Failed to process batch")
+		return err
+	}
+	log.Info().Str("directory", batchProcess.Directory).Msg("Batch processed successfully")
+	return nil
+}
+
+// isReady reports whether a pending media file has been quiet for the process delay
+func (d *Dispatcher) isReady(mediaFile *models.MediaFile) bool {
+	delay := d.processDelay()
+	if time.Since(mediaFile.UpdatedAt) < delay {
+		return false
+	}
+
+	info, err := os.Stat(mediaFile.OriginalPath)
+	if err != nil {
+		log.Debug().Err(err).Str("file", mediaFile.OriginalPath).Msg("Pending media file is not accessible")
+		return false
+	}
+
+	if time.Since(info.ModTime()) < delay {
+		return false
+	}
+
+	// Hold back files that are still being downloaded
+	return d.scanner.IsStable(mediaFile.OriginalPath)
+}
+
+// processDelay returns the configured watcher process delay
+func (d *Dispatcher) processDelay() time.Duration {
+	return time.Duration(d.config.Scanner.WatcherSettings.ProcessDelay) * time.Second
+}
+
+// forgetSettled drops in-flight IDs that are no longer pending
+func (d *Dispatcher) forgetSettled(pending []models.MediaFile) {
+	stillPending := make(map[int64]bool, len(pending))
+	for _, mediaFile := range pending {
+		stillPending[mediaFile.ID] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id := range d.inFlight {
+		if !stillPending[id] {
+			delete(d.inFlight, id)
+		}
+	}
+}
+
+// forgetDeferred drops the in-flight IDs of media files the processor deferred for the LLM
+// budget once it allows requests again, as they went back to pending while marked in flight
+func (d *Dispatcher) forgetDeferred() {
+	deferred := d.processor.TakeDeferred()
+	if len(deferred) == 0 {
+		return
+	}
+
+	log.Info().Int("count", len(deferred)).Msg("LLM budget allows requests again, dispatching deferred files")
+	for _, id := range deferred {
+		d.clearInFlight(id)
+	}
+}
+
+// trackBatch marks the media files of a dispatched batch process in flight until it ends
+func (d *Dispatcher) trackBatch(batchID int64, ids []int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.batches[batchID] = ids
+	for _, id := range ids {
+		d.inFlight[id] = true
+	}
+}
+
+// batchEnded allows the media files of a batch process to be dispatched again. Files left
+// pending by the batch, such as those claimed elsewhere, are picked up on their own.
+func (d *Dispatcher) batchEnded(batchID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range d.batches[batchID] {
+		delete(d.inFlight, id)
+	}
+	delete(d.batches, batchID)
+}
+
+// isInFlight reports whether a media file has already been dispatched
+func (d *Dispatcher) isInFlight(id int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inFlight[id]
+}
+
+// markInFlight records that a media file has been dispatched
+func (d *Dispatcher) markInFlight(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inFlight[id] = true
+}
+
+// clearInFlight allows a media file to be dispatched again
+func (d *Dispatcher) clearInFlight(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, id)
+}
@@ -0,0 +1,161 @@
+package dispatcher
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/database/dbtest"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/processor"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+// newTestDispatcher returns a dispatcher with only its in-flight bookkeeping
+func newTestDispatcher() *Dispatcher {
+	return &Dispatcher{inFlight: make(map[int64]bool), batches: make(map[int64][]int64)}
+}
+
+// TestBatchEnded tests that the files of a batch leave the in-flight set when the batch
+// ends, even when they are still pending, so that a failed batch does not strand them
+func TestBatchEnded(t *testing.T) {
+	d := newTestDispatcher()
+	d.trackBatch(1, []int64{10, 11})
+	d.trackBatch(2, []int64{20})
+	d.markInFlight(30)
+
+	// Files still pending stay in flight while their batch is queued or running
+	d.forgetSettled([]models.MediaFile{{ID: 10}, {ID: 11}, {ID: 20}, {ID: 30}})
+	for _, id := range []int64{10, 11, 20, 30} {
+		if !d.isInFlight(id) {
+			t.Errorf("media file %d is not in flight before its batch ended", id)
+		}
+	}
+
+	d.batchEnded(1)
+	for id, expected := range map[int64]bool{10: false, 11: false, 20: true, 30: true} {
+		if d.isInFlight(id) != expected {
+			t.Errorf("media file %d in flight = %v after batch 1 ended, expected %v", id, !expected, expected)
+		}
+	}
+	if _, ok := d.batches[1]; ok {
+		t.Error("batch 1 is still tracked after it ended")
+	}
+
+	// Ending an unknown or already ended batch changes nothing
+	d.batchEnded(1)
+	d.batchEnded(3)
+	if !d.isInFlight(20) || !d.isInFlight(30) {
+		t.Error("ending other batches cleared in-flight files")
+	}
+}
+
+// TestForgetSettled tests that files which left the pending state leave the in-flight set
+func TestForgetSettled(t *testing.T) {
+	d := newTestDispatcher()
+	d.markInFlight(1)
+	d.markInFlight(2)
+
+	d.forgetSettled([]models.MediaFile{{ID: 2}})
+	if d.isInFlight(1) || !d.isInFlight(2) {
+		t.Errorf("in flight after forgetting settled files = %v, expected only 2", d.inFlight)
+	}
+}
+
+// TestScanBatchDispatchedOnce tests that the files of a batch created by a scan are not
+// dispatched again by the next ticks while the batch waits in the worker pool queue
+func TestScanBatchDispatchedOnce(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	files := []*models.MediaFile{
+		{ID: 1, OriginalPath: filepath.Join(dir, "Show.S01E01.mkv"), OriginalName: "Show.S01E01.mkv", Status: "pending", UpdatedAt: old},
+		{ID: 2, OriginalPath: filepath.Join(dir, "Show.S01E02.mkv"), OriginalName: "Show.S01E02.mkv", Status: "pending", UpdatedAt: old},
+	}
+	for _, mediaFile := range files {
+		if err := os.WriteFile(mediaFile.OriginalPath, []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(mediaFile.OriginalPath, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The files stay pending until the LLM has answered
+	db := dbtest.New(t, func(query string, args []driver.Value) *dbtest.Rows {
+		switch {
+		case strings.HasPrefix(query, `SELECT * FROM "media_files" WHERE status`):
+			return dbtest.RowsOf(files[0], files[1])
+		case strings.HasPrefix(query, `SELECT * FROM "media_files" WHERE id`):
+			return dbtest.RowsOf(files[args[0].(int64)-1])
+		case strings.HasPrefix(query, `SELECT * FROM "batch_process_files"`):
+			batchID := args[0].(int64)
+			return dbtest.RowsOf(
+				&models.BatchProcessFile{ID: 1, BatchProcessID: batchID, MediaFileID: 1, Status: "pending"},
+				&models.BatchProcessFile{ID: 2, BatchProcessID: batchID, MediaFileID: 2, Status: "pending"},
+			)
+		}
+		return nil
+	})
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "invalid request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.Scanner.BatchThreshold = 2
+	cfg.WorkerPool = config.WorkerPoolConfig{Enabled: true, WorkerCount: 1, BatchWorkerCount: 1, QueueSize: 10, MaxConcurrentLLM: 1, MaxConcurrentAPI: 1, MaxConcurrentFileOp: 1}
+	cfg.LLM = config.LLMConfig{APIKey: "test", BaseURL: server.URL, Model: "test"}
+	llmClient, err := llm.New(&cfg.LLM, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := processor.New(cfg, db.Database, llmClient, nil, fileops.New(&cfg.FileOps), nil)
+	d := New(cfg, db.Database, scanner.New(&cfg.Scanner, db.Database), proc)
+
+	// The scan creates the batch, the following ticks find its files still pending
+	ctx := context.Background()
+	if err := d.DispatchBatch(ctx, &models.BatchProcess{ID: 1, Directory: dir, FileCount: 2, Status: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := d.DispatchPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proc.StartWorkerPool()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, queued := proc.GetWorkerPoolStats()
+		if queued == 0 && !d.isInFlight(1) && !d.isInFlight(2) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("batch was not processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	proc.StopWorkerPool()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected the batch to be sent to the LLM once, got %d requests", n)
+	}
+	for _, statement := range db.Writes() {
+		if strings.HasPrefix(statement.Query, `INSERT INTO "batch_processes"`) {
+			t.Errorf("Expected no other batch process, got %s", statement.Query)
+		}
+	}
+}
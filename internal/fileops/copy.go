@@ -0,0 +1,178 @@
+package fileops
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// hashBlockSize is the size of the blocks sampled by fastHash and compared when resuming a copy
+	hashBlockSize = 1 << 20
+	// hashSamples is the number of blocks sampled by fastHash
+	hashSamples = 16
+)
+
+// ErrVerifyFailed is returned when a copy does not match its source
+var ErrVerifyFailed = errors.New("copy verification failed")
+
+// partialPath returns the temporary path a copy to destPath is written to. The name is
+// stable so an interrupted copy is resumed on the next attempt, and hidden so the scanner skips it.
+func partialPath(destPath string) string {
+	return filepath.Join(filepath.Dir(destPath), "."+filepath.Base(destPath)+".partial")
+}
+
+// copyFile copies a file from source to destination. The file is written to a temporary
+// file which is renamed to the destination only after its size and hash match the source.
+// An interrupted copy is resumed from where it stopped.
+func copyFile(sourcePath, destPath string) error {
+	// Open source file
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("error opening source file: %w", err)
+	}
+	defer sourceFile.Close()
+
+	// Get source file info
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting source file info: %w", err)
+	}
+
+	// Open the temporary file, keeping what an earlier attempt already copied
+	tmpPath := partialPath(destPath)
+	offset := resumeOffset(sourceFile, tmpPath, sourceInfo.Size())
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer tmpFile.Close()
+
+	if err := tmpFile.Truncate(offset); err != nil {
+		return fmt.Errorf("error truncating temporary file: %w", err)
+	}
+	if _, err := tmpFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking temporary file: %w", err)
+	}
+	if _, err := sourceFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking source file: %w", err)
+	}
+
+	// Copy the rest of the file. The temporary file is kept on error so the copy can be resumed.
+	if _, err := io.Copy(tmpFile, sourceFile); err != nil {
+		return fmt.Errorf("error copying file: %w", err)
+	}
+
+	// Sync the file to ensure it's written to disk
+	if err := tmpFile.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file: %w", err)
+	}
+
+	// Verify the copy, a corrupt copy is discarded so the next attempt starts over
+	if err := verifyCopy(sourcePath, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Set file permissions
+	if err := os.Chmod(tmpPath, sourceInfo.Mode()); err != nil {
+		return fmt.Errorf("error setting file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("error renaming temporary file: %w", err)
+	}
+
+	return nil
+}
+
+// resumeOffset returns how much of the source an interrupted copy already holds. The last
+// block of the temporary file must match the source, otherwise the copy starts over.
+func resumeOffset(source *os.File, tmpPath string, sourceSize int64) int64 {
+	info, err := os.Stat(tmpPath)
+	if err != nil || info.Size() == 0 || info.Size() > sourceSize {
+		return 0
+	}
+
+	size := info.Size()
+	blockSize := min(size, int64(hashBlockSize))
+
+	tmpFile, err := os.Open(tmpPath)
+	if err != nil {
+		return 0
+	}
+	defer tmpFile.Close()
+
+	tmpBlock := make([]byte, blockSize)
+	sourceBlock := make([]byte, blockSize)
+	if _, err := tmpFile.ReadAt(tmpBlock, size-blockSize); err != nil {
+		return 0
+	}
+	if _, err := source.ReadAt(sourceBlock, size-blockSize); err != nil {
+		return 0
+	}
+	if !bytes.Equal(tmpBlock, sourceBlock) {
+		return 0
+	}
+	return size
+}
+
+// verifyCopy returns ErrVerifyFailed unless a copy has the size and hash of its source
+func verifyCopy(sourcePath, copyPath string) error {
+	sourceHash, err := fastHash(sourcePath)
+	if err != nil {
+		return fmt.Errorf("error hashing source file: %w", err)
+	}
+	copyHash, err := fastHash(copyPath)
+	if err != nil {
+		return fmt.Errorf("error hashing copy: %w", err)
+	}
+	if !bytes.Equal(sourceHash, copyHash) {
+		return fmt.Errorf("%w: %s does not match %s", ErrVerifyFailed, copyPath, sourcePath)
+	}
+	return nil
+}
+
+// fastHash hashes the size of a file and evenly spaced blocks of its content.
+// Small files are hashed completely, large files without reading them in full.
+func fastHash(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	hash := sha256.New()
+	binary.Write(hash, binary.LittleEndian, size)
+
+	if size <= hashSamples*hashBlockSize {
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil, err
+		}
+		return hash.Sum(nil), nil
+	}
+
+	block := make([]byte, hashBlockSize)
+	for i := int64(0); i < hashSamples; i++ {
+		offset := i * (size - hashBlockSize) / (hashSamples - 1)
+		if _, err := file.ReadAt(block, offset); err != nil {
+			return nil, err
+		}
+		hash.Write(block)
+	}
+	return hash.Sum(nil), nil
+}
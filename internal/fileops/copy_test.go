@@ -0,0 +1,86 @@
+package fileops
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCopyFileResume tests that interrupted copies are resumed or restarted
+func TestCopyFileResume(t *testing.T) {
+	content := make([]byte, 3*hashBlockSize+123)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	testCases := []struct {
+		name    string
+		partial []byte
+	}{
+		{"no partial", nil},
+		{"matching partial", content[:hashBlockSize+7]},
+		{"stale partial", bytes.Repeat([]byte{1}, hashBlockSize)},
+		{"oversized partial", append(append([]byte{}, content...), 0)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			source := filepath.Join(root, "movie.mkv")
+			dest := filepath.Join(root, "library", "movie.mkv")
+			if err := os.WriteFile(source, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if tc.partial != nil {
+				if err := os.WriteFile(partialPath(dest), tc.partial, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := copyFile(source, dest); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if data, err := os.ReadFile(dest); err != nil || !bytes.Equal(data, content) {
+				t.Errorf("Expected destination to match source, got %d bytes, %v", len(data), err)
+			}
+			if _, err := os.Stat(partialPath(dest)); !os.IsNotExist(err) {
+				t.Errorf("Expected temporary file to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+// TestFastHash tests that the fast hash detects changed sizes and sampled content
+func TestFastHash(t *testing.T) {
+	root := t.TempDir()
+	content := make([]byte, hashSamples*hashBlockSize+hashBlockSize/2)
+	rand.New(rand.NewSource(2)).Read(content)
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	original := write("original", content)
+	same := write("same", content)
+
+	changed := append([]byte{}, content...)
+	changed[0] ^= 0xff
+	modified := write("modified", changed)
+	truncated := write("truncated", content[:len(content)-1])
+
+	if err := verifyCopy(original, same); err != nil {
+		t.Errorf("Expected identical files to verify, got %v", err)
+	}
+	for _, path := range []string{modified, truncated} {
+		if err := verifyCopy(original, path); err == nil {
+			t.Errorf("Expected %s to fail verification", filepath.Base(path))
+		}
+	}
+}
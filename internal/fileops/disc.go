@@ -0,0 +1,238 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// errSourceRemoval reports that a tree was moved by copying but its source could not be removed
+var errSourceRemoval = errors.New("error removing source")
+
+// ProcessDir processes the content of a disc folder (a BDMV or VIDEO_TS structure and whatever
+// lies next to it) into the given destination directory with the configured mode. The entries
+// are processed one by one, so the destination directory may hold other files such as artwork.
+// If the destination already holds one of the entries a " (n)" suffix is appended to the directory.
+func (f *FileOps) ProcessDir(sourceDir, destDir string) (*Result, error) {
+	if sourceDir == "" {
+		return nil, fmt.Errorf("source path cannot be empty")
+	}
+	if destDir == "" {
+		return nil, fmt.Errorf("destination path cannot be empty")
+	}
+
+	sourceInfo, err := os.Stat(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file info: %w", err)
+	}
+	if !sourceInfo.IsDir() {
+		return nil, fmt.Errorf("source is not a directory: %s", sourceDir)
+	}
+
+	dirEntries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source directory: %w", err)
+	}
+	entries := make([]string, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		entries = append(entries, entry.Name())
+	}
+
+	// Check if the destination already holds any of the entries
+	if holdsAny(destDir, entries) {
+		base := destDir
+		for i := 1; ; i++ {
+			destDir = fmt.Sprintf("%s (%d)", base, i)
+			if !holdsAny(destDir, entries) {
+				break
+			}
+		}
+	}
+
+	createdDirs, err := mkdirAll(destDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating destination directory: %w", err)
+	}
+
+	mode := f.config.Mode
+	var fallback string
+	for i, name := range entries {
+		entryDest := filepath.Join(destDir, name)
+		entryFallback, err := f.processEntry(filepath.Join(sourceDir, name), entryDest)
+		if err != nil {
+			// Put back what has been processed so far, the disc is organised as a whole or not at all
+			for _, done := range entries[:i] {
+				_ = revertEntry(filepath.Join(sourceDir, done), filepath.Join(destDir, done), mode)
+			}
+			if mode == "move" && errors.Is(err, errSourceRemoval) {
+				// The entry was copied completely and its source is partly gone, the copy is kept
+				return nil, fmt.Errorf("error processing %s, kept at %s: %w", name, entryDest, err)
+			}
+			// The destination did not hold the entry before, whatever is there is partial.
+			// The source is left alone: it is complete unless the move removed it.
+			_ = os.RemoveAll(entryDest)
+			return nil, fmt.Errorf("error processing %s: %w", name, err)
+		}
+		if entryFallback != "" {
+			fallback = entryFallback
+		}
+	}
+	if fallback != "" {
+		mode = "copy"
+	}
+
+	return &Result{
+		Source:      sourceDir,
+		Destination: destDir,
+		Mode:        mode,
+		Fallback:    fallback,
+		CreatedDirs: createdDirs,
+		Entries:     entries,
+	}, nil
+}
+
+// processEntry processes a file or directory tree of a disc folder and returns why files
+// were copied instead of linked, if they were
+func (f *FileOps) processEntry(sourcePath, destPath string) (string, error) {
+	switch f.config.Mode {
+	case "copy":
+		return "", copyTree(sourcePath, destPath, copyFile)
+	case "move":
+		return "", moveTree(sourcePath, destPath)
+	case "symlink":
+		return "", symlinkFile(sourcePath, destPath)
+	case "hardlink", "reflink":
+		link := hardlinkFile
+		if f.config.Mode == "reflink" {
+			link = reflinkFile
+		}
+		var fallback string
+		err := copyTree(sourcePath, destPath, func(source, dest string) error {
+			err := link(source, dest)
+			if err == nil {
+				return nil
+			}
+			if !f.config.LinkFallback || !canFallBack(err) {
+				return fmt.Errorf("error creating %s: %w", f.config.Mode, err)
+			}
+			if err := copyFile(source, dest); err != nil {
+				return fmt.Errorf("error copying file after %s failed: %w", f.config.Mode, err)
+			}
+			fallback = fmt.Sprintf("%s failed: %v", f.config.Mode, err)
+			return nil
+		})
+		return fallback, err
+	default:
+		return "", fmt.Errorf("unknown file operation mode: %s", f.config.Mode)
+	}
+}
+
+// RevertDir reverses ProcessDir, entry by entry as Revert does for single files
+func (f *FileOps) RevertDir(sourceDir, destDir, mode string, entries []string) error {
+	for _, name := range entries {
+		if err := revertEntry(filepath.Join(sourceDir, name), filepath.Join(destDir, name), mode); err != nil {
+			return fmt.Errorf("error reverting %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// revertEntry reverses processEntry
+func revertEntry(sourcePath, destPath, mode string) error {
+	destInfo, destErr := os.Lstat(destPath)
+	_, sourceErr := os.Lstat(sourcePath)
+	sourceExists := sourceErr == nil
+
+	switch mode {
+	case "symlink":
+		if os.IsNotExist(destErr) {
+			return nil
+		}
+		if destErr != nil {
+			return fmt.Errorf("error getting destination info: %w", destErr)
+		}
+		if destInfo.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("destination is not a symlink: %s", destPath)
+		}
+		if err := os.Remove(destPath); err != nil {
+			return fmt.Errorf("error removing symlink: %w", err)
+		}
+		return nil
+	case "copy", "hardlink", "reflink":
+		if sourceExists {
+			if err := os.RemoveAll(destPath); err != nil {
+				return fmt.Errorf("error removing %s: %w", mode, err)
+			}
+			return nil
+		}
+	case "move":
+		if sourceExists {
+			return fmt.Errorf("source path already exists: %s", sourcePath)
+		}
+	default:
+		return fmt.Errorf("unknown file operation mode: %s", mode)
+	}
+
+	// Move the entry back to where it came from
+	if destErr != nil {
+		return fmt.Errorf("error getting destination info: %w", destErr)
+	}
+	if err := os.MkdirAll(filepath.Dir(sourcePath), 0755); err != nil {
+		return fmt.Errorf("error creating source directory: %w", err)
+	}
+	if err := moveTree(destPath, sourcePath); err != nil {
+		return fmt.Errorf("error moving back: %w", err)
+	}
+	return nil
+}
+
+// moveTree moves a file or directory tree. Across filesystems the tree is copied with
+// verification and the source is removed afterwards.
+func moveTree(sourcePath, destPath string) error {
+	if err := os.Rename(sourcePath, destPath); err == nil {
+		return nil
+	}
+	if err := copyTree(sourcePath, destPath, copyFile); err != nil {
+		return fmt.Errorf("error copying: %w", err)
+	}
+	if err := os.RemoveAll(sourcePath); err != nil {
+		return fmt.Errorf("%w: %v", errSourceRemoval, err)
+	}
+	return nil
+}
+
+// copyTree recreates the directories of a file or directory tree at the destination
+// and processes its regular files with the given function
+func copyTree(sourcePath, destPath string, process func(source, dest string) error) error {
+	return filepath.WalkDir(sourcePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destPath, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type().IsRegular():
+			return process(path, target)
+		}
+		// Disc structures hold no special files, skip them
+		return nil
+	})
+}
+
+// holdsAny reports whether a directory holds any of the given names
+func holdsAny(dir string, names []string) bool {
+	for _, name := range names {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
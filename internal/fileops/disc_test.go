@@ -0,0 +1,112 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// TestProcessDirRevert tests that disc folders are organised as a whole and can be put back
+func TestProcessDirRevert(t *testing.T) {
+	for _, mode := range []string{"copy", "move", "symlink", "hardlink", "reflink"} {
+		t.Run(mode, func(t *testing.T) {
+			root := t.TempDir()
+			source := filepath.Join(root, "downloads", "Movie.2020.1080p.BluRay")
+			stream := filepath.Join(source, "BDMV", "STREAM", "00000.m2ts")
+			if err := os.MkdirAll(filepath.Dir(stream), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(stream, []byte("video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Join(source, "CERTIFICATE"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			// The movie directory already holds a disc, the new one gets a directory of its own
+			dest := filepath.Join(root, "library", "Movie (2020)")
+			if err := os.MkdirAll(filepath.Join(dest, "BDMV"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			f := New(&config.FileOpsConfig{Mode: mode, LinkFallback: true})
+			result, err := f.ProcessDir(source, dest)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if expected := dest + " (1)"; result.Destination != expected {
+				t.Errorf("Expected destination %s, got %s", expected, result.Destination)
+			}
+			if len(result.Entries) != 2 {
+				t.Errorf("Expected 2 entries, got %v", result.Entries)
+			}
+			organised := filepath.Join(result.Destination, "BDMV", "STREAM", "00000.m2ts")
+			if data, err := os.ReadFile(organised); err != nil || string(data) != "video" {
+				t.Errorf("Expected organised stream, got %q, %v", data, err)
+			}
+
+			if err := f.RevertDir(result.Source, result.Destination, result.Mode, result.Entries); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if data, err := os.ReadFile(stream); err != nil || string(data) != "video" {
+				t.Errorf("Expected source to be restored, got %q, %v", data, err)
+			}
+			if _, err := os.Lstat(filepath.Join(result.Destination, "BDMV")); !os.IsNotExist(err) {
+				t.Errorf("Expected organised disc to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+// TestProcessDirPartialEntry tests that the partial destination of a failing entry is removed
+func TestProcessDirPartialEntry(t *testing.T) {
+	for _, mode := range []string{"copy", "hardlink", "reflink"} {
+		t.Run(mode, func(t *testing.T) {
+			root := t.TempDir()
+			source := filepath.Join(root, "src")
+			stream := filepath.Join(source, "BDMV", "STREAM", "00000.m2ts")
+			if err := os.MkdirAll(filepath.Dir(stream), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(stream, []byte("video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The second entry holds a file that is processed, then a directory whose
+			// destination path is too long to create
+			certificate := filepath.Join(source, "CERTIFICATE", "id.bdmv")
+			if err := os.MkdirAll(filepath.Dir(certificate), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(certificate, []byte("id"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			deep := filepath.Join(source, "CERTIFICATE", "z"+strings.Repeat("d", 200), strings.Repeat("e", 200), strings.Repeat("f", 200))
+			if err := os.MkdirAll(deep, 0755); err != nil {
+				t.Fatal(err)
+			}
+			dest := root
+			for len(dest) < 3800 {
+				dest = filepath.Join(dest, strings.Repeat("l", 200))
+			}
+
+			f := New(&config.FileOpsConfig{Mode: mode, LinkFallback: true})
+			if _, err := f.ProcessDir(source, dest); err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, name := range []string{"BDMV", "CERTIFICATE"} {
+				if _, err := os.Lstat(filepath.Join(dest, name)); !os.IsNotExist(err) {
+					t.Errorf("Expected %s to be removed from the destination, got %v", name, err)
+				}
+			}
+			for _, path := range []string{stream, certificate, deep} {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("Expected source %s to be kept, got %v", path, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Errors classifying why a hardlink or reflink could not be created
+var (
+	ErrCrossDevice  = errors.New("source and destination are on different filesystems")
+	ErrNotSupported = errors.New("not supported by the filesystem")
+	ErrTooManyLinks = errors.New("source has too many links")
+	ErrPermission   = errors.New("permission denied")
+)
+
+// classifyLinkError wraps an error of creating a hardlink or reflink with its cause
+func classifyLinkError(err error) error {
+	switch {
+	case errors.Is(err, syscall.EXDEV):
+		return fmt.Errorf("%w: %v", ErrCrossDevice, err)
+	case errors.Is(err, syscall.EMLINK):
+		return fmt.Errorf("%w: %v", ErrTooManyLinks, err)
+	case errors.Is(err, syscall.EOPNOTSUPP), errors.Is(err, syscall.ENOTSUP), errors.Is(err, syscall.ENOSYS),
+		errors.Is(err, syscall.EINVAL), errors.Is(err, syscall.ENOTTY):
+		// FICLONE reports EINVAL or ENOTTY on filesystems without reflink support
+		return fmt.Errorf("%w: %v", ErrNotSupported, err)
+	case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		// EPERM is also the fs.protected_hardlinks refusal; hardlinkFile checks for filesystems without hardlinks
+		return fmt.Errorf("%w: %v", ErrPermission, err)
+	default:
+		return err
+	}
+}
+
+// canFallBack reports whether a failed hardlink or reflink can be replaced by a copy
+func canFallBack(err error) bool {
+	return errors.Is(err, ErrCrossDevice) || errors.Is(err, ErrNotSupported) || errors.Is(err, ErrTooManyLinks)
+}
@@ -1,11 +1,16 @@
 package fileops
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sleepstars/mediascanner/internal/config"
 )
@@ -13,125 +18,145 @@ import (
 // FileOps represents the file operations
 type FileOps struct {
 	config *config.FileOpsConfig
+	client *http.Client
 }
 
 // New creates a new file operations instance
 func New(cfg *config.FileOpsConfig) *FileOps {
 	return &FileOps{
 		config: cfg,
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
 	}
 }
 
-// ProcessFile processes a file (copy, move, or symlink)
-func (f *FileOps) ProcessFile(sourcePath, destDir string) (string, error) {
+// Result describes a file organised by ProcessFile, or a disc folder organised by ProcessDir
+type Result struct {
+	Source       string
+	Destination  string   // Final path, including a conflict suffix
+	Mode         string   // Mode used: copy, move, symlink, hardlink, reflink
+	Fallback     string   // Why the file was copied instead of linked
+	CreatedDirs  []string // Directories created for the destination, outermost first
+	Replaced     string   // Where the file previously at the destination was recycled to, see ReplaceFile
+	ReplacedFrom string   // Where the replaced file was, the destination unless it was named differently
+	Entries      []string // Entries of a disc folder organised by ProcessDir, nil for files
+}
+
+// ProcessFile processes a file (copy, move, symlink, hardlink or reflink) to the given destination path.
+// If the destination already exists a " (n)" suffix is appended to the file name, see ReplaceFile to replace it.
+// Hardlinks and reflinks fall back to a copy when they cannot be created, if enabled.
+func (f *FileOps) ProcessFile(sourcePath, destPath string) (*Result, error) {
 	// Validate input parameters
 	if sourcePath == "" {
-		return "", fmt.Errorf("source path cannot be empty")
+		return nil, fmt.Errorf("source path cannot be empty")
 	}
-	if destDir == "" {
-		return "", fmt.Errorf("destination directory cannot be empty")
+	if destPath == "" {
+		return nil, fmt.Errorf("destination path cannot be empty")
 	}
 
 	// Check if source file exists
 	sourceInfo, err := os.Stat(sourcePath)
 	if err != nil {
-		return "", fmt.Errorf("error getting file info: %w", err)
+		return nil, fmt.Errorf("error getting file info: %w", err)
 	}
 
 	// Ensure source is a regular file
 	if !sourceInfo.Mode().IsRegular() {
-		return "", fmt.Errorf("source is not a regular file: %s", sourcePath)
+		return nil, fmt.Errorf("source is not a regular file: %s", sourcePath)
 	}
 
 	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return "", fmt.Errorf("error creating destination directory: %w", err)
+	destDir := filepath.Dir(destPath)
+	createdDirs, err := mkdirAll(destDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating destination directory: %w", err)
 	}
 
 	// Get file extension
-	ext := filepath.Ext(sourcePath)
+	ext := filepath.Ext(destPath)
 
 	// Get file name without extension
-	fileName := filepath.Base(sourcePath)
+	fileName := filepath.Base(destPath)
 	fileNameWithoutExt := strings.TrimSuffix(fileName, ext)
 
-	// Create destination file path
-	destPath := filepath.Join(destDir, fileNameWithoutExt+ext)
-
 	// Check if destination file already exists
-	if _, err := os.Stat(destPath); err == nil {
+	if _, err := os.Lstat(destPath); err == nil {
 		// File already exists, append a suffix
 		for i := 1; ; i++ {
 			destPath = filepath.Join(destDir, fmt.Sprintf("%s (%d)%s", fileNameWithoutExt, i, ext))
-			if _, err := os.Stat(destPath); os.IsNotExist(err) {
+			if _, err := os.Lstat(destPath); os.IsNotExist(err) {
 				break
 			}
 		}
 	}
 
 	// Process the file based on the configured mode
-	switch f.config.Mode {
+	mode := f.config.Mode
+	var fallback string
+	switch mode {
 	case "copy":
 		if err := copyFile(sourcePath, destPath); err != nil {
-			return "", fmt.Errorf("error copying file: %w", err)
+			return nil, fmt.Errorf("error copying file: %w", err)
 		}
 	case "move":
 		if err := moveFile(sourcePath, destPath); err != nil {
-			return "", fmt.Errorf("error moving file: %w", err)
+			return nil, fmt.Errorf("error moving file: %w", err)
 		}
 	case "symlink":
 		if err := symlinkFile(sourcePath, destPath); err != nil {
-			return "", fmt.Errorf("error creating symlink: %w", err)
+			return nil, fmt.Errorf("error creating symlink: %w", err)
+		}
+	case "hardlink", "reflink":
+		link := hardlinkFile
+		if mode == "reflink" {
+			link = reflinkFile
+		}
+		if err := link(sourcePath, destPath); err != nil {
+			if !f.config.LinkFallback || !canFallBack(err) {
+				return nil, fmt.Errorf("error creating %s: %w", mode, err)
+			}
+			if err := copyFile(sourcePath, destPath); err != nil {
+				return nil, fmt.Errorf("error copying file after %s failed: %w", mode, err)
+			}
+			fallback = fmt.Sprintf("%s failed: %v", mode, err)
+			mode = "copy"
 		}
 	default:
-		return "", fmt.Errorf("unknown file operation mode: %s", f.config.Mode)
+		return nil, fmt.Errorf("unknown file operation mode: %s", f.config.Mode)
 	}
 
-	return destPath, nil
+	return &Result{
+		Source:      sourcePath,
+		Destination: destPath,
+		Mode:        mode,
+		Fallback:    fallback,
+		CreatedDirs: createdDirs,
+	}, nil
 }
 
-// copyFile copies a file from source to destination
-func copyFile(sourcePath, destPath string) error {
-	// Open source file
-	sourceFile, err := os.Open(sourcePath)
-	if err != nil {
-		return fmt.Errorf("error opening source file: %w", err)
-	}
-	defer sourceFile.Close()
-
-	// Create destination file
-	destFile, err := os.Create(destPath)
-	if err != nil {
-		return fmt.Errorf("error creating destination file: %w", err)
-	}
-	defer destFile.Close()
-
-	// Copy the file
-	_, err = io.Copy(destFile, sourceFile)
-	if err != nil {
-		return fmt.Errorf("error copying file: %w", err)
-	}
-
-	// Sync the file to ensure it's written to disk
-	if err := destFile.Sync(); err != nil {
-		return fmt.Errorf("error syncing file: %w", err)
-	}
-
-	// Get source file info
-	sourceInfo, err := os.Stat(sourcePath)
-	if err != nil {
-		return fmt.Errorf("error getting source file info: %w", err)
+// mkdirAll creates a directory with its parents and returns the directories
+// that did not exist before, outermost first
+func mkdirAll(dir string) ([]string, error) {
+	var missing []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append([]string{d}, missing...)
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
 	}
 
-	// Set file permissions
-	if err := os.Chmod(destPath, sourceInfo.Mode()); err != nil {
-		return fmt.Errorf("error setting file permissions: %w", err)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return missing, nil
 }
 
-// moveFile moves a file from source to destination
+// moveFile moves a file from source to destination. Across filesystems the file is
+// copied and the source is removed only after the copy has been verified.
 func moveFile(sourcePath, destPath string) error {
 	// Try to rename the file (this works if source and destination are on the same filesystem)
 	err := os.Rename(sourcePath, destPath)
@@ -168,38 +193,132 @@ func symlinkFile(sourcePath, destPath string) error {
 	return nil
 }
 
-// DownloadImage downloads an image from a URL
-func (f *FileOps) DownloadImage(url, destPath string) error {
+// Relink atomically replaces a symlink with one pointing at a new target
+func Relink(linkPath, target string) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %w", err)
+	}
+	info, err := os.Lstat(linkPath)
+	if err != nil {
+		return fmt.Errorf("error getting symlink info: %w", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("not a symlink: %s", linkPath)
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(linkPath), "."+filepath.Base(linkPath)+".relink")
+	_ = os.Remove(tmpPath)
+	if err := os.Symlink(absTarget, tmpPath); err != nil {
+		return fmt.Errorf("error creating symlink: %w", err)
+	}
+	if err := os.Rename(tmpPath, linkPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error replacing symlink: %w", err)
+	}
+	return nil
+}
+
+// hardlinkFile creates a hardlink to the source file
+func hardlinkFile(sourcePath, destPath string) error {
+	if err := os.Link(sourcePath, destPath); err != nil {
+		if errors.Is(err, syscall.EPERM) && lacksHardlinks(filepath.Dir(destPath)) {
+			// link(2) reports EPERM on filesystems without hardlinks, e.g. FAT
+			return fmt.Errorf("%w: %v", ErrNotSupported, err)
+		}
+		return classifyLinkError(err)
+	}
+	return nil
+}
+
+// DownloadImage downloads an image from a URL and reports whether it was downloaded.
+// Existing images are kept and the image is written to a temporary file first,
+// so an interrupted download never leaves a truncated image behind.
+func (f *FileOps) DownloadImage(ctx context.Context, url, destPath string) (bool, error) {
+	if url == "" {
+		return false, fmt.Errorf("image URL cannot be empty")
+	}
+
+	// Skip images that have already been downloaded
+	if info, err := os.Stat(destPath); err == nil && info.Size() > 0 {
+		return false, nil
+	}
+
 	// Create destination directory if it doesn't exist
 	destDir := filepath.Dir(destPath)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("error creating destination directory: %w", err)
+		return false, fmt.Errorf("error creating destination directory: %w", err)
 	}
 
-	// TODO: Implement image downloading
-	return nil
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error downloading image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("error downloading image: %s", resp.Status)
+	}
+
+	// Write to a temporary file in the destination directory
+	tmpFile, err := os.CreateTemp(destDir, "."+filepath.Base(destPath)+".*.tmp")
+	if err != nil {
+		return false, fmt.Errorf("error creating temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+		tmpFile.Close()
+		return false, fmt.Errorf("error writing image: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return false, fmt.Errorf("error syncing image: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return false, fmt.Errorf("error closing image: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return false, fmt.Errorf("error setting image permissions: %w", err)
+	}
+
+	// Move the complete image into place
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return false, fmt.Errorf("error moving image into place: %w", err)
+	}
+
+	return true, nil
 }
 
-// CreateNFOFile creates an NFO file
-func (f *FileOps) CreateNFOFile(destPath string, content string) error {
+// CreateNFOFile creates or replaces an NFO file and reports whether it did not exist before
+func (f *FileOps) CreateNFOFile(destPath string, content string) (bool, error) {
 	// Create destination directory if it doesn't exist
 	destDir := filepath.Dir(destPath)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("error creating destination directory: %w", err)
+		return false, fmt.Errorf("error creating destination directory: %w", err)
 	}
 
+	_, statErr := os.Stat(destPath)
+	created := os.IsNotExist(statErr)
+
 	// Create the file
 	file, err := os.Create(destPath)
 	if err != nil {
-		return fmt.Errorf("error creating NFO file: %w", err)
+		return false, fmt.Errorf("error creating NFO file: %w", err)
 	}
 	defer file.Close()
 
 	// Write the content
 	_, err = file.WriteString(content)
 	if err != nil {
-		return fmt.Errorf("error writing NFO file: %w", err)
+		return false, fmt.Errorf("error writing NFO file: %w", err)
 	}
 
-	return nil
+	return created, nil
 }
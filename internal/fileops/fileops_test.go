@@ -0,0 +1,106 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// TestClassifyLinkError tests the classification of link errors
+func TestClassifyLinkError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected error
+		fallback bool
+	}{
+		{&os.LinkError{Op: "link", Err: syscall.EXDEV}, ErrCrossDevice, true},
+		{syscall.EOPNOTSUPP, ErrNotSupported, true},
+		{syscall.EINVAL, ErrNotSupported, true},
+		{syscall.EMLINK, ErrTooManyLinks, true},
+		{&os.LinkError{Op: "link", Err: syscall.EACCES}, ErrPermission, false},
+		{&os.LinkError{Op: "link", Err: syscall.EPERM}, ErrPermission, false},
+		{fmt.Errorf("disk on fire"), nil, false},
+	}
+
+	for _, tc := range testCases {
+		err := classifyLinkError(tc.err)
+		if tc.expected != nil && !errors.Is(err, tc.expected) {
+			t.Errorf("Expected %v for %v, got %v", tc.expected, tc.err, err)
+		}
+		if result := canFallBack(err); result != tc.fallback {
+			t.Errorf("Expected fallback %v for %v, got %v", tc.fallback, tc.err, result)
+		}
+	}
+}
+
+// TestProcessFileHardlink tests that hardlinks share the source file
+func TestProcessFileHardlink(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "movie.mkv")
+	if err := os.WriteFile(source, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(&config.FileOpsConfig{Mode: "hardlink"})
+	result, err := f.ProcessFile(source, filepath.Join(root, "library", "movie.mkv"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Mode != "hardlink" || result.Fallback != "" {
+		t.Errorf("Expected hardlink without fallback, got %s (%s)", result.Mode, result.Fallback)
+	}
+
+	sourceInfo, _ := os.Stat(source)
+	destInfo, _ := os.Stat(result.Destination)
+	if !os.SameFile(sourceInfo, destInfo) {
+		t.Error("Expected destination to be a hardlink of the source")
+	}
+}
+
+// TestProcessFileReflinkFallback tests that reflinks fall back to copies where unsupported
+func TestProcessFileReflinkFallback(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "movie.mkv")
+	if err := os.WriteFile(source, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(&config.FileOpsConfig{Mode: "reflink", LinkFallback: true})
+	result, err := f.ProcessFile(source, filepath.Join(root, "library", "movie.mkv"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	switch result.Mode {
+	case "reflink":
+		// The temporary directory supports reflinks
+	case "copy":
+		if result.Fallback == "" {
+			t.Error("Expected the fallback reason to be recorded")
+		}
+	default:
+		t.Errorf("Expected reflink or copy, got %s", result.Mode)
+	}
+	if data, err := os.ReadFile(result.Destination); err != nil || string(data) != "video" {
+		t.Errorf("Expected destination content, got %q, %v", data, err)
+	}
+
+	// Without fallback an unsupported reflink is an error
+	if result.Mode == "copy" {
+		f = New(&config.FileOpsConfig{Mode: "reflink"})
+		if _, err := f.ProcessFile(source, filepath.Join(root, "library", "other.mkv")); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Expected ErrNotSupported, got %v", err)
+		}
+	}
+}
+
+// TestLacksHardlinks tests that a local filesystem is not mistaken for one without hardlinks
+func TestLacksHardlinks(t *testing.T) {
+	if lacksHardlinks(t.TempDir()) {
+		t.Error("Expected the temporary directory to support hardlinks")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package fileops
+
+import "golang.org/x/sys/unix"
+
+// lacksHardlinks reports whether the filesystem containing dir does not support hardlinks
+func lacksHardlinks(dir string) bool {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	switch stat.Type {
+	case unix.MSDOS_SUPER_MAGIC, unix.EXFAT_SUPER_MAGIC, unix.SMB_SUPER_MAGIC, unix.CIFS_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fileops
+
+// lacksHardlinks reports whether the filesystem containing dir does not support hardlinks.
+// The filesystem type is not checked on this platform, so EPERM is treated as a permission error.
+func lacksHardlinks(dir string) bool {
+	return false
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package fileops
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clones a file with the FICLONE ioctl, sharing its data blocks
+// until either copy is modified (btrfs, XFS with reflink=1)
+func reflinkFile(sourcePath, destPath string) error {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("error opening source file: %w", err)
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting source file info: %w", err)
+	}
+
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, sourceInfo.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error creating destination file: %w", err)
+	}
+
+	if err := unix.IoctlFileClone(int(destFile.Fd()), int(sourceFile.Fd())); err != nil {
+		destFile.Close()
+		os.Remove(destPath)
+		return classifyLinkError(err)
+	}
+
+	if err := destFile.Close(); err != nil {
+		os.Remove(destPath)
+		return fmt.Errorf("error closing destination file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fileops
+
+import "fmt"
+
+// reflinkFile is not supported on this platform
+func reflinkFile(sourcePath, destPath string) error {
+	return fmt.Errorf("%w: reflinks require Linux", ErrNotSupported)
+}
@@ -0,0 +1,89 @@
+package fileops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReplaceFile processes a file to a destination that already exists. The existing file is set
+// aside while the new one is processed and put back if that fails. Afterwards it is moved to the
+// recycle directory, or removed when none is configured.
+func (f *FileOps) ReplaceFile(sourcePath, destPath string) (*Result, error) {
+	return f.ReplaceExisting(sourcePath, destPath, destPath)
+}
+
+// ReplaceExisting is ReplaceFile for an existing file that may be named differently from the
+// destination, e.g. a video with another extension
+func (f *FileOps) ReplaceExisting(sourcePath, destPath, existingPath string) (*Result, error) {
+	if _, err := os.Lstat(existingPath); err != nil {
+		return f.ProcessFile(sourcePath, destPath)
+	}
+
+	// Set the existing file aside under a hidden name the scanner skips
+	backupPath := filepath.Join(filepath.Dir(existingPath), "."+filepath.Base(existingPath)+".replaced")
+	if err := os.Rename(existingPath, backupPath); err != nil {
+		return nil, fmt.Errorf("error setting existing file aside: %w", err)
+	}
+
+	result, err := f.ProcessFile(sourcePath, destPath)
+	if err != nil {
+		if restoreErr := os.Rename(backupPath, existingPath); restoreErr != nil {
+			return nil, fmt.Errorf("%w (existing file left at %s: %v)", err, backupPath, restoreErr)
+		}
+		return nil, err
+	}
+	result.ReplacedFrom = existingPath
+
+	if f.config.RecycleDir == "" {
+		if err := os.Remove(backupPath); err != nil {
+			// The new file is in place, keep the old one where it is
+			result.Replaced = backupPath
+		}
+		return result, nil
+	}
+
+	recyclePath := f.recyclePath(existingPath)
+	if _, err := mkdirAll(filepath.Dir(recyclePath)); err != nil {
+		result.Replaced = backupPath
+		return result, nil
+	}
+	if err := moveFile(backupPath, recyclePath); err != nil {
+		result.Replaced = backupPath
+		return result, nil
+	}
+	result.Replaced = recyclePath
+	return result, nil
+}
+
+// RestoreReplaced moves a file recycled by ReplaceFile back to its destination
+func (f *FileOps) RestoreReplaced(replacedPath, destPath string) error {
+	if _, err := os.Lstat(destPath); err == nil {
+		return fmt.Errorf("destination path already exists: %s", destPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("error creating destination directory: %w", err)
+	}
+	if err := moveFile(replacedPath, destPath); err != nil {
+		return fmt.Errorf("error restoring replaced file: %w", err)
+	}
+	return nil
+}
+
+// recyclePath returns where a replaced file is recycled to, keeping its path relative to
+// the destination root. A timestamp is added when the recycle directory already holds the name.
+func (f *FileOps) recyclePath(destPath string) string {
+	rel, err := filepath.Rel(f.config.DestinationRoot, destPath)
+	if err != nil || f.config.DestinationRoot == "" || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(destPath)
+	}
+
+	path := filepath.Join(f.config.RecycleDir, rel)
+	if _, err := os.Lstat(path); err == nil {
+		ext := filepath.Ext(path)
+		path = fmt.Sprintf("%s.%s%s", strings.TrimSuffix(path, ext), time.Now().Format("20060102-150405"), ext)
+	}
+	return path
+}
@@ -0,0 +1,54 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// TestReplaceFile tests that replaced files are recycled and can be restored
+func TestReplaceFile(t *testing.T) {
+	root := t.TempDir()
+	library := filepath.Join(root, "library")
+	source := filepath.Join(root, "downloads", "movie.mkv")
+	dest := filepath.Join(library, "Movies", "Movie (2020)", "Movie (2020).mkv")
+	for path, content := range map[string]string{source: "new", dest: "old"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := New(&config.FileOpsConfig{Mode: "copy", DestinationRoot: library, RecycleDir: filepath.Join(root, "recycle")})
+	result, err := f.ReplaceFile(source, dest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Destination != dest {
+		t.Errorf("Expected destination %s, got %s", dest, result.Destination)
+	}
+	expectedRecycled := filepath.Join(root, "recycle", "Movies", "Movie (2020)", "Movie (2020).mkv")
+	if result.Replaced != expectedRecycled {
+		t.Errorf("Expected replaced file at %s, got %s", expectedRecycled, result.Replaced)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "new" {
+		t.Errorf("Expected destination to hold the new file, got %q", data)
+	}
+	if data, _ := os.ReadFile(result.Replaced); string(data) != "old" {
+		t.Errorf("Expected recycled file to hold the old file, got %q", data)
+	}
+
+	if err := f.Revert(result.Source, result.Destination, result.Mode); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.RestoreReplaced(result.Replaced, dest); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "old" {
+		t.Errorf("Expected destination to hold the old file again, got %q", data)
+	}
+}
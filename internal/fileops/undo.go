@@ -0,0 +1,81 @@
+package fileops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Revert reverses ProcessFile. Moved files are moved back to the source path,
+// copies, links and clones are removed. A copy whose source is gone is moved back instead.
+func (f *FileOps) Revert(sourcePath, destPath, mode string) error {
+	destInfo, destErr := os.Lstat(destPath)
+	_, sourceErr := os.Lstat(sourcePath)
+	sourceExists := sourceErr == nil
+
+	switch mode {
+	case "symlink":
+		if os.IsNotExist(destErr) {
+			return nil
+		}
+		if destErr != nil {
+			return fmt.Errorf("error getting destination info: %w", destErr)
+		}
+		if destInfo.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("destination is not a symlink: %s", destPath)
+		}
+		if err := os.Remove(destPath); err != nil {
+			return fmt.Errorf("error removing symlink: %w", err)
+		}
+		return nil
+	case "copy", "hardlink", "reflink":
+		if sourceExists {
+			if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing %s: %w", mode, err)
+			}
+			return nil
+		}
+	case "move":
+		if sourceExists {
+			return fmt.Errorf("source path already exists: %s", sourcePath)
+		}
+	default:
+		return fmt.Errorf("unknown file operation mode: %s", mode)
+	}
+
+	// Move the file back to where it came from
+	if destErr != nil {
+		return fmt.Errorf("error getting destination info: %w", destErr)
+	}
+	if err := os.MkdirAll(filepath.Dir(sourcePath), 0755); err != nil {
+		return fmt.Errorf("error creating source directory: %w", err)
+	}
+	if err := moveFile(destPath, sourcePath); err != nil {
+		return fmt.Errorf("error moving file back: %w", err)
+	}
+	return nil
+}
+
+// RemoveFile removes a file, files that no longer exist are ignored
+func (f *FileOps) RemoveFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing file: %w", err)
+	}
+	return nil
+}
+
+// PruneDirs removes those of the given directories that are empty, deepest first,
+// and returns the removed directories
+func (f *FileOps) PruneDirs(dirs []string) []string {
+	var removed []string
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err == nil {
+			removed = append(removed, dirs[i])
+		}
+	}
+	return removed
+}
@@ -0,0 +1,81 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// TestProcessFileRevert tests that organised files can be put back
+func TestProcessFileRevert(t *testing.T) {
+	for _, mode := range []string{"copy", "move", "symlink", "hardlink", "reflink"} {
+		t.Run(mode, func(t *testing.T) {
+			root := t.TempDir()
+			source := filepath.Join(root, "downloads", "movie.mkv")
+			if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(source, []byte("video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			f := New(&config.FileOpsConfig{Mode: mode, LinkFallback: true})
+			dest := filepath.Join(root, "library", "Movies", "Movie (2020)", "Movie (2020).mkv")
+			result, err := f.ProcessFile(source, dest)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Destination != dest {
+				t.Errorf("Expected destination %s, got %s", dest, result.Destination)
+			}
+			expectedDirs := []string{
+				filepath.Join(root, "library"),
+				filepath.Join(root, "library", "Movies"),
+				filepath.Join(root, "library", "Movies", "Movie (2020)"),
+			}
+			if len(result.CreatedDirs) != len(expectedDirs) {
+				t.Fatalf("Expected created directories %v, got %v", expectedDirs, result.CreatedDirs)
+			}
+			for i := range expectedDirs {
+				if result.CreatedDirs[i] != expectedDirs[i] {
+					t.Errorf("Expected created directory %s, got %s", expectedDirs[i], result.CreatedDirs[i])
+				}
+			}
+
+			if err := f.Revert(result.Source, result.Destination, result.Mode); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if removed := f.PruneDirs(result.CreatedDirs); len(removed) != len(expectedDirs) {
+				t.Errorf("Expected %d directories to be removed, got %v", len(expectedDirs), removed)
+			}
+
+			if data, err := os.ReadFile(source); err != nil || string(data) != "video" {
+				t.Errorf("Expected source to be restored, got %q, %v", data, err)
+			}
+			if _, err := os.Lstat(filepath.Join(root, "library")); !os.IsNotExist(err) {
+				t.Errorf("Expected library directory to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+// TestPruneDirsKeepsNonEmpty tests that directories still in use are kept
+func TestPruneDirsKeepsNonEmpty(t *testing.T) {
+	root := t.TempDir()
+	show := filepath.Join(root, "Show")
+	season := filepath.Join(show, "Season 1")
+	if err := os.MkdirAll(season, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(show, "tvshow.nfo"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(&config.FileOpsConfig{})
+	removed := f.PruneDirs([]string{show, season})
+	if len(removed) != 1 || removed[0] != season {
+		t.Errorf("Expected only %s to be removed, got %v", season, removed)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
@@ -157,20 +158,39 @@ func (w *Watcher) watch() {
 
 // handleEvent handles a file system event
 func (w *Watcher) handleEvent(event fsnotify.Event) {
-	// If a directory is created, add it to the watcher
+	// If a directory is created, add it to the watcher with its subdirectories,
+	// which a directory renamed into place already has
 	if event.Op&fsnotify.Create == fsnotify.Create {
 		info, err := os.Stat(event.Name)
 		if err == nil && info.IsDir() {
 			w.mu.Lock()
-			if err := w.watcher.Add(event.Name); err != nil {
-				log.Printf("Warning: failed to add new directory to watcher: %v", err)
-			} else {
-				w.directories[event.Name] = true
-			}
+			_ = filepath.Walk(event.Name, func(subpath string, info os.FileInfo, err error) error {
+				if err != nil || !info.IsDir() {
+					return nil
+				}
+				if err := w.watcher.Add(subpath); err != nil {
+					log.Printf("Warning: failed to add new directory to watcher: %v", err)
+				} else {
+					w.directories[subpath] = true
+				}
+				return nil
+			})
 			w.mu.Unlock()
 		}
 	}
 
+	// A removed or renamed directory is no longer watched under its old name
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.mu.Lock()
+		for dir := range w.directories {
+			if dir == event.Name || strings.HasPrefix(dir, event.Name+string(filepath.Separator)) {
+				_ = w.watcher.Remove(dir)
+				delete(w.directories, dir)
+			}
+		}
+		w.mu.Unlock()
+	}
+
 	// Convert fsnotify event to our event type
 	var eventType EventType
 	switch {
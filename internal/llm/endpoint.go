@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// failoverCooldown is how long an endpoint that failed over is passed over
+const failoverCooldown = 30 * time.Second
+
+// endpoint is an LLM endpoint of the fallback chain
+type endpoint struct {
+	name   string // shown as the provider of exchanges
+	model  string
+	client *openai.Client
+	quotas quotas
+
+	// formatUnsupported is set when the endpoint rejected the response format
+	formatUnsupported atomic.Bool
+
+	// unavailableUntil keeps an endpoint that failed over out of the chain, in Unix nanoseconds
+	unavailableUntil atomic.Int64
+}
+
+// newEndpoints creates the endpoints of the fallback chain and of the escalation chain. Without
+// configured endpoints the LLM settings form the only endpoint. Empty endpoint fields are taken
+// from the LLM settings.
+func newEndpoints(cfg *config.LLMConfig) ([]*endpoint, []*endpoint, error) {
+	configured := cfg.Endpoints
+	if len(configured) == 0 {
+		configured = []config.LLMEndpoint{{RequestsPerMinute: cfg.RequestsPerMinute, TokensPerMinute: cfg.TokensPerMinute}}
+	}
+
+	var chain, escalation []*endpoint
+	for i, ec := range configured {
+		ec.Provider = orDefault(ec.Provider, cfg.Provider)
+		ec.APIKey = orDefault(ec.APIKey, cfg.APIKey)
+		ec.BaseURL = orDefault(ec.BaseURL, cfg.BaseURL)
+		ec.Model = orDefault(ec.Model, cfg.Model)
+		ec.Name = orDefault(ec.Name, ec.Provider)
+		if ec.APIKey == "" {
+			if len(cfg.Endpoints) == 0 {
+				return nil, nil, errors.New("LLM API key is required")
+			}
+			return nil, nil, fmt.Errorf("LLM API key is required for endpoint %d (%s)", i+1, ec.Name)
+		}
+
+		clientConfig := openai.DefaultConfig(ec.APIKey)
+		if ec.BaseURL != "" {
+			clientConfig.BaseURL = ec.BaseURL
+		}
+		e := &endpoint{
+			name:   ec.Name,
+			model:  ec.Model,
+			client: openai.NewClientWithConfig(clientConfig),
+			quotas: newQuotas(ec.RequestsPerMinute, ec.TokensPerMinute),
+		}
+		if ec.Escalation {
+			escalation = append(escalation, e)
+		} else {
+			chain = append(chain, e)
+		}
+	}
+
+	// Escalation needs a cheaper chain to escalate from
+	if len(chain) == 0 {
+		chain, escalation = escalation, nil
+	}
+	return chain, escalation, nil
+}
+
+// orDefault returns the value, or the default when it is empty
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// available returns the endpoints of a chain that have not failed over recently, or the
+// whole chain when all of them have
+func available(chain []*endpoint) []*endpoint {
+	now := time.Now().UnixNano()
+	var endpoints []*endpoint
+	for _, e := range chain {
+		if e.unavailableUntil.Load() <= now {
+			endpoints = append(endpoints, e)
+		}
+	}
+	if len(endpoints) == 0 {
+		return chain
+	}
+	return endpoints
+}
+
+// send sends a chat completion request to the endpoint within its quotas. Endpoints that
+// reject the response format are asked again without it, and from then on never with it.
+func (e *endpoint) send(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	request.Model = e.model
+	if e.formatUnsupported.Load() {
+		request.ResponseFormat = nil
+	}
+
+	response, err := e.sendWithinQuotas(ctx, request)
+	if err != nil && request.ResponseFormat != nil && formatRejected(err) {
+		// The provider may not support structured output, the answer is extracted from text instead
+		request.ResponseFormat = nil
+		if response, err = e.sendWithinQuotas(ctx, request); err == nil {
+			e.formatUnsupported.Store(true)
+		}
+	}
+	return response, err
+}
+
+// formatRejected reports whether a request was rejected for its response format
+func formatRejected(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusBadRequest {
+		return false
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "response_format") || strings.Contains(message, "json_schema")
+}
+
+// sendWithinQuotas waits for the quotas of the endpoint and sends a request
+func (e *endpoint) sendWithinQuotas(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	reserved, err := e.quotas.wait(ctx, request)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	response, err := e.client.CreateChatCompletion(ctx, request)
+	if err == nil {
+		e.quotas.settle(reserved, response.Usage)
+	}
+	return response, err
+}
+
+// failOver passes over the endpoint for a while after it failed
+func (e *endpoint) failOver(err error) {
+	e.unavailableUntil.Store(time.Now().Add(failoverCooldown).UnixNano())
+	log.Warn().Err(err).Str("endpoint", e.name).Str("model", e.model).Msg("LLM endpoint failed, failing over")
+}
+
+// shouldFailOver reports whether an error is worth trying the next endpoint or trying again
+// for: transport errors, rate limits and server errors. Rejected requests and failed
+// authentication fail the same way every time.
+func shouldFailOver(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	status := 0
+	var apiErr *openai.APIError
+	var requestErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &requestErr):
+		status = requestErr.HTTPStatusCode
+	default:
+		// No response from the endpoint
+		return true
+	}
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,234 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// testEndpoint starts an endpoint answering with the given status, and with the content when
+// the status is OK. The requests it received are counted.
+func testEndpoint(t *testing.T, status int, content string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+const testAnswer = `{"title":"Heat","media_type":"movie","category":"Movies","confidence":0.9}`
+
+// TestFailover tests that requests fail over to the next endpoint on rate limits and server
+// errors, and that the failed endpoint is passed over afterwards
+func TestFailover(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		primary, primaryRequests := testEndpoint(t, status, "")
+		backup, backupRequests := testEndpoint(t, http.StatusOK, testAnswer)
+
+		l, err := New(&config.LLMConfig{
+			Provider: "openai",
+			APIKey:   "test",
+			Model:    "cheap",
+			Endpoints: []config.LLMEndpoint{
+				{Name: "primary", BaseURL: primary.URL},
+				{Name: "backup", BaseURL: backup.URL, Model: "other"},
+			},
+		}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var exchanges []*Exchange
+		l.SetRecorder(func(_ context.Context, exchange *Exchange) { exchanges = append(exchanges, exchange) })
+
+		for i := 0; i < 2; i++ {
+			if _, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure); err != nil {
+				t.Fatalf("status %d: %v", status, err)
+			}
+		}
+		if primaryRequests.Load() != 1 || backupRequests.Load() != 2 {
+			t.Errorf("status %d: %d primary and %d backup requests, expected 1 and 2", status, primaryRequests.Load(), backupRequests.Load())
+		}
+		if exchanges[0].Provider != "backup" || exchanges[0].Model != "other" {
+			t.Errorf("status %d: exchange recorded for %s %s, expected backup other", status, exchanges[0].Provider, exchanges[0].Model)
+		}
+		if usage := exchanges[0].Usage; len(usage) != 1 || usage[0].Provider != "backup" || usage[0].Model != "other" {
+			t.Errorf("status %d: exchange usage = %+v, expected the backup model only", status, usage)
+		}
+	}
+}
+
+// TestNoFailoverOnClientError tests that client errors are not failed over
+func TestNoFailoverOnClientError(t *testing.T) {
+	primary, _ := testEndpoint(t, http.StatusUnauthorized, "")
+	backup, backupRequests := testEndpoint(t, http.StatusOK, testAnswer)
+
+	l, err := New(&config.LLMConfig{
+		APIKey: "test",
+		Endpoints: []config.LLMEndpoint{
+			{Name: "primary", BaseURL: primary.URL},
+			{Name: "backup", BaseURL: backup.URL},
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure); err == nil {
+		t.Error("expected the client error")
+	}
+	if backupRequests.Load() != 0 {
+		t.Errorf("%d backup requests, expected none", backupRequests.Load())
+	}
+}
+
+// TestEscalation tests that uncertain answers are asked again from the escalation endpoints
+func TestEscalation(t *testing.T) {
+	cheap, _ := testEndpoint(t, http.StatusOK, `{"title":"Heat","media_type":"tv","category":"TV","confidence":0.4}`)
+	strong, strongRequests := testEndpoint(t, http.StatusOK, testAnswer)
+
+	cfg := &config.LLMConfig{
+		APIKey:              "test",
+		ConfidenceThreshold: 0.7,
+		Endpoints: []config.LLMEndpoint{
+			{Name: "strong", BaseURL: strong.URL, Escalation: true},
+			{Name: "cheap", BaseURL: cheap.URL},
+		},
+	}
+	l, err := New(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exchanges []*Exchange
+	l.SetRecorder(func(_ context.Context, exchange *Exchange) { exchanges = append(exchanges, exchange) })
+
+	result, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MediaType != "movie" || result.Confidence != 0.9 {
+		t.Errorf("result = %+v, expected the answer of the escalation endpoint", result)
+	}
+	if len(exchanges) != 2 || exchanges[0].Provider != "cheap" || exchanges[1].Provider != "strong" {
+		t.Errorf("%d exchanges recorded, expected cheap then strong", len(exchanges))
+	}
+
+	// Confident answers are not escalated
+	cfg.ConfidenceThreshold = 0.3
+	if _, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure); err != nil {
+		t.Fatal(err)
+	}
+	if strongRequests.Load() != 1 {
+		t.Errorf("%d escalation requests, expected 1", strongRequests.Load())
+	}
+}
+
+// TestRetries tests that only errors worth trying again for are retried, and that the wait
+// before a retry ends with the context
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		status     int
+		maxRetries int
+		timeout    time.Duration
+		requests   int32
+	}{
+		{http.StatusUnauthorized, 2, 0, 1},
+		{http.StatusBadRequest, 2, 0, 1},
+		{http.StatusServiceUnavailable, 1, 0, 2},
+		{http.StatusServiceUnavailable, 3, 50 * time.Millisecond, 1},
+	}
+
+	for _, test := range tests {
+		server, requests := testEndpoint(t, test.status, "")
+		l, err := New(&config.LLMConfig{APIKey: "test", BaseURL: server.URL, MaxRetries: test.maxRetries}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		if test.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		if _, err := l.ProcessMediaFile(ctx, "Heat.1995.mkv", testStructure); err == nil {
+			t.Errorf("status %d: expected an error", test.status)
+		}
+		if requests.Load() != test.requests {
+			t.Errorf("status %d with %d retries: %d requests, expected %d", test.status, test.maxRetries, requests.Load(), test.requests)
+		}
+		if test.timeout > 0 && time.Since(start) > time.Second {
+			t.Errorf("status %d: retries outlasted the context by %v", test.status, time.Since(start)-test.timeout)
+		}
+	}
+}
+
+// TestResponseFormatFallback tests that the response format is dropped only when the endpoint
+// rejects it, and is not requested from that endpoint again
+func TestResponseFormatFallback(t *testing.T) {
+	tests := []struct {
+		message  string
+		fallback bool
+		requests int32
+	}{
+		{"response_format json_schema is not supported by this model", true, 3},
+		{"The model does not exist", false, 1},
+	}
+
+	for _, test := range tests {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			var request map[string]json.RawMessage
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			if _, ok := request["response_format"]; ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"message": test.message, "type": "invalid_request_error"}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{{
+					Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: testAnswer},
+					FinishReason: openai.FinishReasonStop,
+				}},
+			})
+		}))
+		defer server.Close()
+
+		l, err := New(&config.LLMConfig{APIKey: "test", BaseURL: server.URL, MaxRetries: 2}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure)
+		if (err == nil) != test.fallback {
+			t.Errorf("%q: error %v, expected fallback %v", test.message, err, test.fallback)
+		}
+		if err == nil {
+			// The format is no longer requested from the endpoint
+			if _, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure); err != nil {
+				t.Errorf("%q: %v", test.message, err)
+			}
+		}
+		if requests.Load() != test.requests {
+			t.Errorf("%q: %d requests, expected %d", test.message, requests.Load(), test.requests)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Exchange is a conversation with the LLM about a file or a batch of files, from the first
+// request to the final answer including tool calls and repair turns
+type Exchange struct {
+	Provider string // name of the endpoint that answered last
+	Model    string // model reported by the provider, the configured model if none was reported
+
+	// Messages of the conversation including tool calls, their results and the final answer
+	Messages []openai.ChatCompletionMessage
+	Response string // content of the final answer
+
+	// Usage by endpoint and model, in the order they were first used. A conversation moves
+	// to another endpoint when one fails over between its requests.
+	Usage []Usage
+
+	Latency time.Duration // time spent waiting for the LLM
+	Err     error         // why the conversation did not produce a valid answer
+}
+
+// Usage is the part of an exchange answered by one endpoint and model
+type Usage struct {
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Latency          time.Duration // time spent waiting for the responses of the model
+}
+
+// Recorder receives the exchanges of the client once they end
+type Recorder func(ctx context.Context, exchange *Exchange)
+
+// SetRecorder sets the recorder receiving the exchanges of the client
+func (l *LLM) SetRecorder(recorder Recorder) {
+	l.recorder = recorder
+}
+
+// newExchange starts an exchange with the first endpoint of a chain
+func newExchange(chain []*endpoint) *Exchange {
+	return &Exchange{Provider: chain[0].name, Model: chain[0].model}
+}
+
+// addResponse adds the usage of a response from an endpoint to the exchange, kept apart for
+// every endpoint and model so that each is priced at its own rate
+func (x *Exchange) addResponse(e *endpoint, response openai.ChatCompletionResponse, latency time.Duration) {
+	x.Provider = e.name
+	x.Model = e.model
+	if response.Model != "" {
+		x.Model = response.Model
+	}
+
+	var usage *Usage
+	for i := range x.Usage {
+		if x.Usage[i].Provider == x.Provider && x.Usage[i].Model == x.Model {
+			usage = &x.Usage[i]
+			break
+		}
+	}
+	if usage == nil {
+		x.Usage = append(x.Usage, Usage{Provider: x.Provider, Model: x.Model})
+		usage = &x.Usage[len(x.Usage)-1]
+	}
+	usage.PromptTokens += response.Usage.PromptTokens
+	usage.CompletionTokens += response.Usage.CompletionTokens
+	usage.Latency += latency
+}
+
+// Tokens returns the prompt and completion tokens of the exchange over all models
+func (x *Exchange) Tokens() (int, int) {
+	prompt, completion := 0, 0
+	for _, usage := range x.Usage {
+		prompt += usage.PromptTokens
+		completion += usage.CompletionTokens
+	}
+	return prompt, completion
+}
+
+// record hands an exchange to the recorder
+func (l *LLM) record(ctx context.Context, exchange *Exchange) {
+	if l.recorder != nil {
+		l.recorder(ctx, exchange)
+	}
+}
@@ -6,52 +6,67 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/rs/zerolog/log"
 	"github.com/sashabaranov/go-openai"
 	"github.com/sleepstars/mediascanner/internal/config"
 	"github.com/sleepstars/mediascanner/internal/worker"
 )
 
+// maxToolRounds bounds the number of turns in which the LLM may call tools before answering
+const maxToolRounds = 10
+
 // LLM represents the LLM client
 type LLM struct {
-	client      *openai.Client
-	config      *config.LLMConfig
-	functionMap map[string]FunctionHandler
-	semaphore   worker.Semaphore
+	config       *config.LLMConfig
+	functionMap  map[string]FunctionHandler
+	functionMu   sync.RWMutex
+	semaphore    worker.Semaphore
+	apiSemaphore worker.Semaphore
+
+	// chain holds the endpoints tried in order, escalation the endpoints asked again for
+	// answers the chain got wrong or is not confident about
+	chain      []*endpoint
+	escalation []*endpoint
+
+	recorder Recorder
 }
 
 // FunctionHandler is a function that handles a function call from the LLM
 type FunctionHandler func(ctx context.Context, args json.RawMessage) (interface{}, error)
 
-// New creates a new LLM client
-func New(cfg *config.LLMConfig, semaphore worker.Semaphore) (*LLM, error) {
-	if cfg.APIKey == "" {
-		return nil, errors.New("LLM API key is required")
-	}
-
-	clientConfig := openai.DefaultConfig(cfg.APIKey)
-	if cfg.BaseURL != "" {
-		clientConfig.BaseURL = cfg.BaseURL
+// New creates a new LLM client. The semaphore limits concurrent conversations, the API
+// semaphore limits concurrent tool calls to the metadata APIs.
+func New(cfg *config.LLMConfig, semaphore, apiSemaphore worker.Semaphore) (*LLM, error) {
+	chain, escalation, err := newEndpoints(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	client := openai.NewClientWithConfig(clientConfig)
-
 	// If no semaphore is provided, use a no-op semaphore
 	if semaphore == nil {
 		semaphore = worker.NewNoOpSemaphore()
 	}
+	if apiSemaphore == nil {
+		apiSemaphore = worker.NewNoOpSemaphore()
+	}
 
 	return &LLM{
-		client:      client,
-		config:      cfg,
-		functionMap: make(map[string]FunctionHandler),
-		semaphore:   semaphore,
+		config:       cfg,
+		functionMap:  make(map[string]FunctionHandler),
+		semaphore:    semaphore,
+		apiSemaphore: apiSemaphore,
+		chain:        chain,
+		escalation:   escalation,
 	}, nil
 }
 
 // RegisterFunction registers a function handler
 func (l *LLM) RegisterFunction(name string, handler FunctionHandler) {
+	l.functionMu.Lock()
+	defer l.functionMu.Unlock()
 	l.functionMap[name] = handler
 }
 
@@ -63,181 +78,23 @@ func (l *LLM) ProcessMediaFile(ctx context.Context, filename string, directorySt
 	}
 	defer l.semaphore.Release()
 	// Use the system prompt from configuration
-	systemMessage := l.config.SystemPrompt
+	systemMessage := l.config.SystemPrompt + "\n\n" + resultFormatInstructions + "\n" + structureInstructions(directoryStructure)
 
 	// Create the user message with the filename
-	userMessage := fmt.Sprintf("Please analyze this filename: %s", filename)
-
-	// Define the functions that can be called by the LLM
-	functions := []openai.FunctionDefinition{
-		{
-			Name:        "searchTMDB",
-			Description: "Search for a movie or TV show on TMDB",
-			Parameters: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"query": map[string]interface{}{
-						"type":        "string",
-						"description": "The search query",
-					},
-					"year": map[string]interface{}{
-						"type":        "integer",
-						"description": "The year of release (optional)",
-					},
-					"mediaType": map[string]interface{}{
-						"type":        "string",
-						"description": "The type of media to search for (movie, tv)",
-						"enum":        []string{"movie", "tv"},
-					},
-				},
-				"required": []string{"query"},
-			},
-		},
-		{
-			Name:        "searchTVDB",
-			Description: "Search for a TV show on TVDB",
-			Parameters: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"query": map[string]interface{}{
-						"type":        "string",
-						"description": "The search query",
-					},
-				},
-				"required": []string{"query"},
-			},
-		},
-		{
-			Name:        "searchBangumi",
-			Description: "Search for anime on Bangumi",
-			Parameters: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"query": map[string]interface{}{
-						"type":        "string",
-						"description": "The search query",
-					},
-				},
-				"required": []string{"query"},
-			},
-		},
-	}
-
-	// Create the chat completion request
-	request := openai.ChatCompletionRequest{
-		Model: l.config.Model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: systemMessage,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: userMessage,
-			},
-		},
-		Functions:    functions,
-		FunctionCall: "auto",
-	}
-
-	// Process the request with retries
-	var response openai.ChatCompletionResponse
-	var err error
-	for i := 0; i <= l.config.MaxRetries; i++ {
-		response, err = l.client.CreateChatCompletion(ctx, request)
-		if err == nil {
-			break
-		}
-
-		// If we've reached the maximum number of retries, return the error
-		if i == l.config.MaxRetries {
-			return nil, fmt.Errorf("failed to process media file after %d retries: %w", l.config.MaxRetries, err)
-		}
-
-		// Wait before retrying
-		time.Sleep(time.Duration(i+1) * time.Second)
+	userMessage := func(filenames []string) string {
+		return fmt.Sprintf("Please analyze this filename: %s", filenames[0])
 	}
 
-	// Process function calls
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: systemMessage,
-		},
-		{
-			Role:    openai.ChatMessageRoleUser,
-			Content: userMessage,
-		},
-	}
-
-	// Handle function calls
-	for {
-		// Check if the response contains a function call
-		if response.Choices[0].FinishReason == openai.FinishReasonFunctionCall {
-			functionCall := response.Choices[0].Message.FunctionCall
-
-			// Add the assistant's message to the conversation
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleAssistant,
-				Content: response.Choices[0].Message.Content,
-				// FunctionCall field has been updated in newer versions of the API
-				// We need to handle this differently
-			})
-
-			// Execute the function
-			handler, ok := l.functionMap[functionCall.Name]
-			if !ok {
-				return nil, fmt.Errorf("unknown function: %s", functionCall.Name)
-			}
-
-			result, err := handler(ctx, json.RawMessage(functionCall.Arguments))
-			if err != nil {
-				return nil, fmt.Errorf("error executing function %s: %w", functionCall.Name, err)
-			}
-
-			// Convert the result to JSON
-			resultJSON, err := json.Marshal(result)
-			if err != nil {
-				return nil, fmt.Errorf("error marshaling function result: %w", err)
-			}
-
-			// Add the function response to the conversation
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleFunction,
-				Name:    functionCall.Name,
-				Content: string(resultJSON),
-			})
-
-			// Create a new chat completion request with the updated conversation
-			request = openai.ChatCompletionRequest{
-				Model:        l.config.Model,
-				Messages:     messages,
-				Functions:    functions,
-				FunctionCall: "auto",
-			}
-
-			// Send the request
-			response, err = l.client.CreateChatCompletion(ctx, request)
-			if err != nil {
-				return nil, fmt.Errorf("error creating chat completion: %w", err)
-			}
-
-			// Continue the loop to handle additional function calls
-			continue
-		}
-
-		// If we've reached here, the LLM has provided a final response
-		break
-	}
-
-	// Parse the final response
-	var result MediaFileResult
-	err = json.Unmarshal([]byte(response.Choices[0].Message.Content), &result)
+	results, problems, err := l.ask(ctx, systemMessage, userMessage,
+		l.responseFormat("media_file_result", resultSchema(directoryStructure)), []string{filename}, directoryStructure)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing LLM response: %w", err)
+		return nil, fmt.Errorf("failed to process media file: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("error parsing LLM response: %s", strings.Join(problems, "; "))
 	}
 
-	return &result, nil
+	return results[0], nil
 }
 
 // ProcessBatchFiles processes a batch of media files using the LLM
@@ -255,16 +112,36 @@ func (l *LLM) ProcessBatchFiles(ctx context.Context, filenames []string, directo
 		systemMessage = strings.Replace(l.config.SystemPrompt, "the given filename", "the given filenames", -1)
 		systemMessage = strings.Replace(systemMessage, "Respond with a structured JSON", "Respond with a structured JSON array", -1)
 	}
+	systemMessage += "\n\n" + resultFormatInstructions + "\n" + batchFormatInstructions + "\n" + structureInstructions(directoryStructure)
 
 	// Create the user message with the filenames
-	userMessage := "Please analyze these filenames:\n"
-	for i, filename := range filenames {
-		userMessage += fmt.Sprintf("%d. %s\n", i+1, filename)
+	userMessage := func(filenames []string) string {
+		message := "Please analyze these filenames:\n"
+		for i, filename := range filenames {
+			message += fmt.Sprintf("%d. %s\n", i+1, filename)
+		}
+		return message
 	}
 
-	// Define the functions that can be called by the LLM
-	functions := []openai.FunctionDefinition{
-		{
+	results, problems, err := l.ask(ctx, systemMessage, userMessage,
+		l.responseFormat("media_file_results", batchSchema(directoryStructure)), filenames, directoryStructure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process batch files: %w", err)
+	}
+
+	// Files without a valid result are failed by the caller, the others can go ahead
+	if len(results) == 0 && len(problems) > 0 {
+		return nil, fmt.Errorf("error parsing LLM response: %s", strings.Join(problems, "; "))
+	}
+
+	return results, nil
+}
+
+// tools defines the tools that can be called by the LLM
+var tools = []openai.Tool{
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
 			Name:        "searchTMDB",
 			Description: "Search for a movie or TV show on TMDB",
 			Parameters: map[string]interface{}{
@@ -287,7 +164,10 @@ func (l *LLM) ProcessBatchFiles(ctx context.Context, filenames []string, directo
 				"required": []string{"query"},
 			},
 		},
-		{
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
 			Name:        "searchTVDB",
 			Description: "Search for a TV show on TVDB",
 			Parameters: map[string]interface{}{
@@ -301,7 +181,10 @@ func (l *LLM) ProcessBatchFiles(ctx context.Context, filenames []string, directo
 				"required": []string{"query"},
 			},
 		},
-		{
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
 			Name:        "searchBangumi",
 			Description: "Search for anime on Bangumi",
 			Parameters: map[string]interface{}{
@@ -315,45 +198,69 @@ func (l *LLM) ProcessBatchFiles(ctx context.Context, filenames []string, directo
 				"required": []string{"query"},
 			},
 		},
+	},
+}
+
+// ask identifies files with the endpoint chain. Files whose answer stays invalid or falls
+// below the confidence threshold are asked again from the escalation chain, whose results
+// replace those of the chain. The user message is built for the files asked about.
+func (l *LLM) ask(ctx context.Context, systemMessage string, userMessage func(filenames []string) string, format *openai.ChatCompletionResponseFormat, filenames []string, structure map[string][]string) ([]*MediaFileResult, []string, error) {
+	results, problems, err := l.answer(ctx, l.chain, conversation(systemMessage, userMessage(filenames)), format, filenames, structure)
+	if len(l.escalation) == 0 {
+		return results, problems, err
 	}
 
-	// Create the chat completion request
-	request := openai.ChatCompletionRequest{
-		Model: l.config.Model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: systemMessage,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: userMessage,
-			},
-		},
-		Functions:    functions,
-		FunctionCall: "auto",
+	escalated := l.escalated(results, filenames)
+	if err != nil {
+		escalated = filenames
+	}
+	if len(escalated) == 0 {
+		return results, problems, nil
 	}
 
-	// Process the request with retries
-	var response openai.ChatCompletionResponse
-	var err error
-	for i := 0; i <= l.config.MaxRetries; i++ {
-		response, err = l.client.CreateChatCompletion(ctx, request)
-		if err == nil {
-			break
-		}
+	log.Info().Strs("files", escalated).Msg("Escalating files to the escalation endpoints")
+	stronger, strongerProblems, strongerErr := l.answer(ctx, l.escalation, conversation(systemMessage, userMessage(escalated)), format, escalated, structure)
+	if strongerErr != nil {
+		log.Warn().Err(strongerErr).Msg("Escalation failed, keeping the answer of the endpoint chain")
+		return results, problems, err
+	}
 
-		// If we've reached the maximum number of retries, return the error
-		if i == l.config.MaxRetries {
-			return nil, fmt.Errorf("failed to process batch files after %d retries: %w", l.config.MaxRetries, err)
+	// Keep the results of the chain that were not replaced, in the order of the files
+	byFilename := make(map[string]*MediaFileResult, len(filenames))
+	for _, result := range results {
+		byFilename[result.OriginalFilename] = result
+	}
+	for _, result := range stronger {
+		byFilename[result.OriginalFilename] = result
+	}
+	merged := make([]*MediaFileResult, 0, len(byFilename))
+	for _, filename := range filenames {
+		if result, ok := byFilename[filename]; ok {
+			merged = append(merged, result)
 		}
+	}
+	return merged, strongerProblems, nil
+}
+
+// escalated returns the files without a result or with a result below the confidence threshold
+func (l *LLM) escalated(results []*MediaFileResult, filenames []string) []string {
+	confident := make(map[string]bool, len(results))
+	for _, result := range results {
+		confident[result.OriginalFilename] = l.config.ConfidenceThreshold <= 0 || result.Confidence >= l.config.ConfidenceThreshold
+	}
 
-		// Wait before retrying
-		time.Sleep(time.Duration(i+1) * time.Second)
+	var escalated []string
+	for _, filename := range filenames {
+		if !confident[filename] {
+			escalated = append(escalated, filename)
+		}
 	}
+	return escalated
+}
 
-	// Process function calls
-	messages := []openai.ChatCompletionMessage{
+// conversation starts a conversation with a system and a user message
+func conversation(systemMessage, userMessage string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
 			Content: systemMessage,
@@ -363,75 +270,184 @@ func (l *LLM) ProcessBatchFiles(ctx context.Context, filenames []string, directo
 			Content: userMessage,
 		},
 	}
+}
 
-	// Handle function calls
-	for {
-		// Check if the response contains a function call
-		if response.Choices[0].FinishReason == openai.FinishReasonFunctionCall {
-			functionCall := response.Choices[0].Message.FunctionCall
-
-			// Add the assistant's message to the conversation
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleAssistant,
-				Content: response.Choices[0].Message.Content,
-				// FunctionCall field has been updated in newer versions of the API
-				// We need to handle this differently
-			})
-
-			// Execute the function
-			handler, ok := l.functionMap[functionCall.Name]
-			if !ok {
-				return nil, fmt.Errorf("unknown function: %s", functionCall.Name)
-			}
+// answer runs a conversation on an endpoint chain and parses the results of its final answer
+// for the given filenames. Problems found in the answer are sent back to the LLM for a limited
+// number of repair turns; the valid results of the last answer are returned with its remaining
+// problems. The whole conversation is handed to the recorder.
+func (l *LLM) answer(ctx context.Context, chain []*endpoint, messages []openai.ChatCompletionMessage, format *openai.ChatCompletionResponseFormat, filenames []string, structure map[string][]string) ([]*MediaFileResult, []string, error) {
+	exchange := newExchange(chain)
+	defer l.record(ctx, exchange)
+
+	for turn := 0; ; turn++ {
+		var content string
+		var err error
+		messages, content, err = l.chat(ctx, chain, exchange, messages, format)
+		exchange.Messages = messages
+		exchange.Response = content
+		if err != nil {
+			exchange.Err = err
+			return nil, nil, err
+		}
 
-			result, err := handler(ctx, json.RawMessage(functionCall.Arguments))
-			if err != nil {
-				return nil, fmt.Errorf("error executing function %s: %w", functionCall.Name, err)
+		results, problems := parseResults(content, filenames, structure)
+		if len(problems) == 0 || turn >= l.config.MaxRepairTurns {
+			if len(problems) > 0 {
+				exchange.Err = fmt.Errorf("invalid answer: %s", strings.Join(problems, "; "))
 			}
+			return results, problems, nil
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: repairMessage(problems),
+		})
+	}
+}
 
-			// Convert the result to JSON
-			resultJSON, err := json.Marshal(result)
-			if err != nil {
-				return nil, fmt.Errorf("error marshaling function result: %w", err)
-			}
+// chat runs a conversation until the LLM gives its final answer and returns the conversation
+// including the answer, and the content of the answer. The tool calls the LLM makes on the
+// way are executed and answered in the conversation. Usage is added to the exchange.
+func (l *LLM) chat(ctx context.Context, chain []*endpoint, exchange *Exchange, messages []openai.ChatCompletionMessage, format *openai.ChatCompletionResponseFormat) ([]openai.ChatCompletionMessage, string, error) {
+	for round := 0; ; round++ {
+		request := openai.ChatCompletionRequest{
+			Messages:       messages,
+			Tools:          tools,
+			ResponseFormat: format,
+		}
+		if round == maxToolRounds {
+			// Make the LLM answer with what it has found so far
+			request.ToolChoice = "none"
+		}
+
+		start := time.Now()
+		response, e, err := l.createChatCompletion(ctx, chain, request)
+		latency := time.Since(start)
+		exchange.Latency += latency
+		if err != nil {
+			return messages, "", err
+		}
+		exchange.addResponse(e, response, latency)
+		if len(response.Choices) == 0 {
+			return messages, "", errors.New("LLM response has no choices")
+		}
+
+		message := response.Choices[0].Message
+		messages = append(messages, message)
+		if len(message.ToolCalls) == 0 {
+			return messages, message.Content, nil
+		}
 
-			// Add the function response to the conversation
-			messages = append(messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleFunction,
-				Name:    functionCall.Name,
-				Content: string(resultJSON),
-			})
-
-			// Create a new chat completion request with the updated conversation
-			request = openai.ChatCompletionRequest{
-				Model:        l.config.Model,
-				Messages:     messages,
-				Functions:    functions,
-				FunctionCall: "auto",
+		// The assistant turn keeps its tool calls, the results refer to them by ID
+		results, err := l.callTools(ctx, message.ToolCalls)
+		if err != nil {
+			return messages, "", err
+		}
+		messages = append(messages, results...)
+	}
+}
+
+// createChatCompletion sends a chat completion request to the first available endpoint of a
+// chain, failing over to the next one on transport errors, rate limits and server errors. The
+// chain is retried until an endpoint answers or the retries are used up, other errors are
+// returned at once.
+func (l *LLM) createChatCompletion(ctx context.Context, chain []*endpoint, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, *endpoint, error) {
+	var err error
+	for i := 0; ; i++ {
+		for _, e := range available(chain) {
+			var response openai.ChatCompletionResponse
+			response, err = e.send(ctx, request)
+			if err == nil {
+				return response, e, nil
+			}
+			if !shouldFailOver(ctx, err) {
+				return openai.ChatCompletionResponse{}, nil, fmt.Errorf("error creating chat completion: %w", err)
 			}
+			if len(chain) > 1 {
+				e.failOver(err)
+			}
+		}
+
+		// If we've reached the maximum number of retries, return the error
+		if i == l.config.MaxRetries {
+			break
+		}
+
+		// Wait before retrying, unless the context ends first
+		timer := time.NewTimer(time.Duration(i+1) * time.Second)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return openai.ChatCompletionResponse{}, nil, fmt.Errorf("error creating chat completion: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+	return openai.ChatCompletionResponse{}, nil, fmt.Errorf("error creating chat completion after %d retries: %w", l.config.MaxRetries, err)
+}
 
-			// Send the request
-			response, err = l.client.CreateChatCompletion(ctx, request)
+// callTools executes the tool calls of an assistant turn concurrently and returns the tool
+// messages answering them, in the order of the calls. A failed call is answered with its error
+// so that the LLM can correct it; only a cancelled context aborts the conversation.
+func (l *LLM) callTools(ctx context.Context, calls []openai.ToolCall) ([]openai.ChatCompletionMessage, error) {
+	messages := make([]openai.ChatCompletionMessage, len(calls))
+
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := l.callTool(ctx, call)
 			if err != nil {
-				return nil, fmt.Errorf("error creating chat completion: %w", err)
+				log.Warn().Err(err).Str("function", call.Function.Name).Msg("Tool call failed")
+				content = toolError(err)
 			}
+			messages[i] = openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Name:       call.Function.Name,
+				Content:    content,
+				ToolCallID: call.ID,
+			}
+		}()
+	}
+	wg.Wait()
 
-			// Continue the loop to handle additional function calls
-			continue
-		}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
 
-		// If we've reached here, the LLM has provided a final response
-		break
+// toolError returns the content of a tool message reporting a failed call
+func toolError(err error) string {
+	content, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(content)
+}
+
+// callTool executes a tool call within the API semaphore and returns its result as JSON
+func (l *LLM) callTool(ctx context.Context, call openai.ToolCall) (string, error) {
+	l.functionMu.RLock()
+	handler, ok := l.functionMap[call.Function.Name]
+	l.functionMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown function: %s", call.Function.Name)
+	}
+
+	if err := l.apiSemaphore.Acquire(ctx); err != nil {
+		return "", fmt.Errorf("failed to acquire API semaphore: %w", err)
 	}
+	defer l.apiSemaphore.Release()
 
-	// Parse the final response
-	var results []*MediaFileResult
-	err = json.Unmarshal([]byte(response.Choices[0].Message.Content), &results)
+	result, err := handler(ctx, json.RawMessage(call.Function.Arguments))
 	if err != nil {
-		return nil, fmt.Errorf("error parsing LLM response: %w", err)
+		return "", fmt.Errorf("error executing function %s: %w", call.Function.Name, err)
 	}
 
-	return results, nil
+	// Convert the result to JSON
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling function result: %w", err)
+	}
+	return string(resultJSON), nil
 }
 
 // MediaFileResult represents the result of processing a media file
@@ -443,6 +459,8 @@ type MediaFileResult struct {
 	MediaType        string  `json:"media_type"` // movie, tv
 	Season           int     `json:"season,omitempty"`
 	Episode          int     `json:"episode,omitempty"`
+	EndEpisode       int     `json:"end_episode,omitempty"` // last episode of a multi-episode file
+	Part             int     `json:"part,omitempty"`        // part of a multi-part movie, e.g. CD2
 	EpisodeTitle     string  `json:"episode_title,omitempty"`
 	TMDBID           int64   `json:"tmdb_id,omitempty"`
 	TVDBID           int64   `json:"tvdb_id,omitempty"`
@@ -452,4 +470,29 @@ type MediaFileResult struct {
 	Subcategory      string  `json:"subcategory"`
 	DestinationPath  string  `json:"destination_path"`
 	Confidence       float64 `json:"confidence,omitempty"`
+
+	// Alternative identifications when the result is uncertain
+	Candidates []Candidate `json:"candidates,omitempty"`
+}
+
+// Candidate represents an alternative identification of a media file
+type Candidate struct {
+	Title         string  `json:"title"`
+	OriginalTitle string  `json:"original_title,omitempty"`
+	Year          int     `json:"year,omitempty"`
+	MediaType     string  `json:"media_type"` // movie, tv
+	TMDBID        int64   `json:"tmdb_id,omitempty"`
+	TVDBID        int64   `json:"tvdb_id,omitempty"`
+	BangumiID     int64   `json:"bangumi_id,omitempty"`
+	Confidence    float64 `json:"confidence,omitempty"`
 }
+
+// resultFormatInstructions describes the fields of MediaFileResult to the LLM
+const resultFormatInstructions = `The JSON object must contain these fields: original_filename, title, original_title, year, media_type ("movie" or "tv"), season, episode, end_episode, part, episode_title, tmdb_id, tvdb_id, bangumi_id, imdb_id, category, subcategory, confidence and candidates.
+"end_episode" is the last episode of a file holding several episodes, e.g. 2 for "S01E01-E02", and 0 otherwise.
+"part" is the part number of a movie split into several files, e.g. 2 for "CD2", and 0 otherwise.
+"confidence" is a number between 0 and 1 expressing how certain you are that the identification is correct.
+"candidates" lists up to 3 alternative identifications (title, original_title, year, media_type, tmdb_id, tvdb_id, bangumi_id, confidence) when you are not certain, otherwise it is empty.`
+
+// batchFormatInstructions adapts the result format to batch processing
+const batchFormatInstructions = `Respond with a JSON object whose "results" array contains one such object per filename, with "original_filename" set to the filename exactly as given.`
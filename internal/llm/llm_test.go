@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/worker"
+)
+
+// TestCallTools tests that tool calls run concurrently and are answered in order by ID
+func TestCallTools(t *testing.T) {
+	l, err := New(&config.LLMConfig{APIKey: "test"}, nil, worker.NewChannelSemaphore(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every call waits until all three are running, which only works concurrently
+	var running sync.WaitGroup
+	running.Add(3)
+	l.RegisterFunction("searchTMDB", func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		var params struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return nil, err
+		}
+		running.Done()
+		running.Wait()
+		return map[string]string{"query": params.Query}, nil
+	})
+
+	calls := make([]openai.ToolCall, 3)
+	for i := range calls {
+		calls[i] = openai.ToolCall{
+			ID:   fmt.Sprintf("call_%d", i),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      "searchTMDB",
+				Arguments: fmt.Sprintf(`{"query":"show %d"}`, i),
+			},
+		}
+	}
+
+	done := make(chan struct{})
+	var messages []openai.ChatCompletionMessage
+	go func() {
+		defer close(done)
+		messages, err = l.callTools(context.Background(), calls)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool calls did not run concurrently")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, message := range messages {
+		if message.Role != openai.ChatMessageRoleTool || message.ToolCallID != calls[i].ID {
+			t.Errorf("message %d answers %q as %q, expected %q as tool", i, message.ToolCallID, message.Role, calls[i].ID)
+		}
+		expected := fmt.Sprintf(`{"query":"show %d"}`, i)
+		if message.Content != expected {
+			t.Errorf("message %d content = %s, expected %s", i, message.Content, expected)
+		}
+	}
+}
+
+// TestCallToolsErrors tests that failed calls are answered with their error
+func TestCallToolsErrors(t *testing.T) {
+	l, err := New(&config.LLMConfig{APIKey: "test"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.RegisterFunction("searchTMDB", func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		return nil, errors.New("TMDB is down")
+	})
+
+	calls := []openai.ToolCall{
+		{ID: "call_0", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "searchIMDB"}},
+		{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "searchTMDB", Arguments: "{}"}},
+	}
+	messages, err := l.callTools(context.Background(), calls)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		`{"error":"unknown function: searchIMDB"}`,
+		`{"error":"error executing function searchTMDB: TMDB is down"}`,
+	}
+	for i, message := range messages {
+		if message.Role != openai.ChatMessageRoleTool || message.ToolCallID != calls[i].ID {
+			t.Errorf("message %d answers %q as %q, expected %q as tool", i, message.ToolCallID, message.Role, calls[i].ID)
+		}
+		if message.Content != expected[i] {
+			t.Errorf("message %d content = %s, expected %s", i, message.Content, expected[i])
+		}
+	}
+
+	// A cancelled context aborts the conversation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.callTools(ctx, calls); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
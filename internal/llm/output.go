@@ -0,0 +1,317 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// Response formats requested for the final answer
+const (
+	ResponseFormatJSONSchema = "json_schema" // JSON constrained by the result schema
+	ResponseFormatJSONObject = "json_object" // any JSON object
+	ResponseFormatText       = "text"        // free text, the JSON is extracted from it
+)
+
+// requiredFields are the fields a result must contain
+var requiredFields = []string{"title", "media_type", "category", "confidence"}
+
+// resultSchema returns the JSON schema of a MediaFileResult. The category is restricted to
+// the directory structure when one is configured.
+func resultSchema(structure map[string][]string) jsonschema.Definition {
+	category := jsonschema.Definition{Type: jsonschema.String, Description: "Category of the directory structure"}
+	subcategory := jsonschema.Definition{Type: jsonschema.String, Description: "Subcategory of the category, empty if it has none"}
+	if len(structure) > 0 {
+		categories, subcategories := structureNames(structure)
+		category.Enum = categories
+		subcategory.Enum = append([]string{""}, subcategories...)
+	}
+
+	candidate := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"title":          {Type: jsonschema.String},
+			"original_title": {Type: jsonschema.String},
+			"year":           {Type: jsonschema.Integer},
+			"media_type":     {Type: jsonschema.String, Enum: []string{"movie", "tv"}},
+			"tmdb_id":        {Type: jsonschema.Integer},
+			"tvdb_id":        {Type: jsonschema.Integer},
+			"bangumi_id":     {Type: jsonschema.Integer},
+			"confidence":     {Type: jsonschema.Number},
+		},
+		Required: []string{"title", "media_type", "confidence"},
+	}
+
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"original_filename": {Type: jsonschema.String},
+			"title":             {Type: jsonschema.String},
+			"original_title":    {Type: jsonschema.String},
+			"year":              {Type: jsonschema.Integer},
+			"media_type":        {Type: jsonschema.String, Enum: []string{"movie", "tv"}},
+			"season":            {Type: jsonschema.Integer},
+			"episode":           {Type: jsonschema.Integer},
+			"end_episode":       {Type: jsonschema.Integer},
+			"part":              {Type: jsonschema.Integer},
+			"episode_title":     {Type: jsonschema.String},
+			"tmdb_id":           {Type: jsonschema.Integer},
+			"tvdb_id":           {Type: jsonschema.Integer},
+			"bangumi_id":        {Type: jsonschema.Integer},
+			"imdb_id":           {Type: jsonschema.String},
+			"category":          category,
+			"subcategory":       subcategory,
+			"destination_path":  {Type: jsonschema.String},
+			"confidence":        {Type: jsonschema.Number},
+			"candidates":        {Type: jsonschema.Array, Items: &candidate},
+		},
+		Required: append([]string{"original_filename"}, requiredFields...),
+	}
+}
+
+// batchSchema returns the JSON schema of the results of a batch
+func batchSchema(structure map[string][]string) jsonschema.Definition {
+	result := resultSchema(structure)
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"results": {Type: jsonschema.Array, Items: &result},
+		},
+		Required: []string{"results"},
+	}
+}
+
+// responseFormat returns the response format to request for the final answer, or nil when
+// the answer is requested as free text
+func (l *LLM) responseFormat(name string, schema jsonschema.Definition) *openai.ChatCompletionResponseFormat {
+	switch l.config.ResponseFormat {
+	case ResponseFormatText:
+		return nil
+	case ResponseFormatJSONObject:
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	default:
+		return &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   name,
+				Schema: &schema,
+			},
+		}
+	}
+}
+
+// structureNames returns the sorted categories and subcategories of a directory structure
+func structureNames(structure map[string][]string) ([]string, []string) {
+	categories := make([]string, 0, len(structure))
+	seen := make(map[string]bool)
+	var subcategories []string
+	for category, subs := range structure {
+		categories = append(categories, category)
+		for _, sub := range subs {
+			if !seen[sub] {
+				seen[sub] = true
+				subcategories = append(subcategories, sub)
+			}
+		}
+	}
+	sort.Strings(categories)
+	sort.Strings(subcategories)
+	return categories, subcategories
+}
+
+// structureInstructions describes the directory structure to the LLM
+func structureInstructions(structure map[string][]string) string {
+	if len(structure) == 0 {
+		return ""
+	}
+
+	categories, _ := structureNames(structure)
+	var b strings.Builder
+	b.WriteString("The directory structure has these categories, each followed by its subcategories. \"category\" must be one of them and \"subcategory\" one of its subcategories:\n")
+	for _, category := range categories {
+		fmt.Fprintf(&b, "- %s: %s\n", category, strings.Join(structure[category], ", "))
+	}
+	return b.String()
+}
+
+// extractJSON returns the first JSON object or array in the content of an answer, skipping
+// Markdown fences and any prose around it
+func extractJSON(content string) (json.RawMessage, error) {
+	for i := 0; i < len(content); i++ {
+		if content[i] != '{' && content[i] != '[' {
+			continue
+		}
+		var raw json.RawMessage
+		if err := json.NewDecoder(strings.NewReader(content[i:])).Decode(&raw); err == nil {
+			return raw, nil
+		}
+	}
+	return nil, errors.New("the answer contains no JSON object")
+}
+
+// resultItems splits the JSON of an answer into the objects of its results. A single object,
+// an array and an object holding a "results" array are accepted.
+func resultItems(raw json.RawMessage) ([]json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var wrapper struct {
+		Results []json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(raw, &wrapper); err == nil && wrapper.Results != nil {
+		return wrapper.Results, nil
+	}
+	return []json.RawMessage{raw}, nil
+}
+
+// parseResults extracts the results from an answer and validates them against the result
+// schema and the directory structure. Results for the given filenames are expected, one per
+// filename. Invalid results are left out and the problems found are returned with the valid ones.
+func parseResults(content string, filenames []string, structure map[string][]string) ([]*MediaFileResult, []string) {
+	raw, err := extractJSON(content)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	items, err := resultItems(raw)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("the answer is not valid JSON: %v", err)}
+	}
+
+	expected := make(map[string]bool, len(filenames))
+	for _, filename := range filenames {
+		expected[filename] = true
+	}
+
+	var results []*MediaFileResult
+	var problems []string
+	found := make(map[string]bool)
+	for i, item := range items {
+		result, itemProblems := parseResult(item, structure)
+
+		// A single file may be answered without repeating its name
+		if result != nil && result.OriginalFilename == "" && len(filenames) == 1 {
+			result.OriginalFilename = filenames[0]
+		}
+		label := fmt.Sprintf("result %d", i+1)
+		if result != nil && result.OriginalFilename != "" {
+			label = fmt.Sprintf("result for %q", result.OriginalFilename)
+			switch {
+			case !expected[result.OriginalFilename]:
+				itemProblems = append(itemProblems, "original_filename is not one of the filenames given")
+			case found[result.OriginalFilename]:
+				itemProblems = append(itemProblems, "the filename has already been answered")
+			}
+		} else if result != nil {
+			itemProblems = append(itemProblems, "original_filename is missing")
+		}
+
+		if len(itemProblems) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", label, strings.Join(itemProblems, "; ")))
+			continue
+		}
+		found[result.OriginalFilename] = true
+		results = append(results, result)
+	}
+
+	for _, filename := range filenames {
+		if !found[filename] && !answeredInvalid(filename, problems) {
+			problems = append(problems, fmt.Sprintf("there is no result for %q", filename))
+		}
+	}
+	return results, problems
+}
+
+// answeredInvalid reports whether a filename has an invalid result among the problems
+func answeredInvalid(filename string, problems []string) bool {
+	prefix := fmt.Sprintf("result for %q:", filename)
+	for _, problem := range problems {
+		if strings.HasPrefix(problem, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseResult decodes and validates a single result
+func parseResult(item json.RawMessage, structure map[string][]string) (*MediaFileResult, []string) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(item, &fields); err != nil {
+		return nil, []string{"it is not a JSON object"}
+	}
+	var result MediaFileResult
+	if err := json.Unmarshal(item, &result); err != nil {
+		return nil, []string{fmt.Sprintf("it does not match the schema: %v", err)}
+	}
+
+	var problems []string
+	for _, field := range requiredFields {
+		if _, ok := fields[field]; !ok && (field != "category" || len(structure) > 0) {
+			problems = append(problems, fmt.Sprintf("%s is missing", field))
+		}
+	}
+	return &result, append(problems, validateResult(&result, structure)...)
+}
+
+// validateResult checks the values of a result against the schema and the directory structure
+func validateResult(result *MediaFileResult, structure map[string][]string) []string {
+	var problems []string
+	if strings.TrimSpace(result.Title) == "" {
+		problems = append(problems, "title is empty")
+	}
+	if result.MediaType != "movie" && result.MediaType != "tv" {
+		problems = append(problems, fmt.Sprintf("media_type %q must be \"movie\" or \"tv\"", result.MediaType))
+	}
+	if result.Season < 0 || result.Episode < 0 || result.Part < 0 {
+		problems = append(problems, "season, episode and part cannot be negative")
+	}
+	if result.EndEpisode != 0 && result.EndEpisode < result.Episode {
+		problems = append(problems, "end_episode must be 0 or not below episode")
+	}
+	if result.Confidence < 0 || result.Confidence > 1 {
+		problems = append(problems, "confidence must be between 0 and 1")
+	}
+	for i, candidate := range result.Candidates {
+		if candidate.MediaType != "movie" && candidate.MediaType != "tv" {
+			problems = append(problems, fmt.Sprintf("media_type %q of candidate %d must be \"movie\" or \"tv\"", candidate.MediaType, i+1))
+		}
+	}
+
+	if len(structure) > 0 {
+		subcategories, ok := structure[result.Category]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("category %q is not part of the directory structure", result.Category))
+		case result.Subcategory != "" && !contains(subcategories, result.Subcategory):
+			problems = append(problems, fmt.Sprintf("subcategory %q is not part of category %q", result.Subcategory, result.Category))
+		}
+	}
+	return problems
+}
+
+// repairMessage asks the LLM to correct the problems of its answer
+func repairMessage(problems []string) string {
+	return "Your answer could not be used:\n- " + strings.Join(problems, "\n- ") +
+		"\nRespond again with the complete corrected JSON and nothing else."
+}
+
+// contains reports whether a list holds a value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+var testStructure = map[string][]string{
+	"Movies": {"Foreign", "Animation"},
+	"TV":     {"Anime", "Documentary"},
+}
+
+// TestExtractJSON tests extracting the JSON of an answer wrapped in fences and prose
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{`{"title":"Heat"}`, `{"title":"Heat"}`},
+		{"```json\n{\"title\":\"Heat\"}\n```", `{"title":"Heat"}`},
+		{"Here is the result:\n{\"title\":\"Heat\"}\nLet me know if you need more.", `{"title":"Heat"}`},
+		{"The {best} match is [{\"title\":\"Heat\"}]", `[{"title":"Heat"}]`},
+	}
+
+	for _, test := range tests {
+		raw, err := extractJSON(test.content)
+		if err != nil {
+			t.Errorf("extractJSON(%q) failed: %v", test.content, err)
+			continue
+		}
+		if string(raw) != test.expected {
+			t.Errorf("extractJSON(%q) = %s, expected %s", test.content, raw, test.expected)
+		}
+	}
+
+	if _, err := extractJSON("I could not identify this file."); err == nil {
+		t.Error("expected an error for an answer without JSON")
+	}
+}
+
+// TestParseResults tests validating results against the schema and the directory structure
+func TestParseResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		filenames []string
+		valid     int
+		problems  []string
+	}{
+		{
+			name:      "single without filename",
+			content:   `{"title":"Heat","media_type":"movie","category":"Movies","subcategory":"Foreign","confidence":0.9}`,
+			filenames: []string{"Heat.1995.mkv"},
+			valid:     1,
+		},
+		{
+			name:      "invalid media type and category",
+			content:   `{"title":"Heat","media_type":"film","category":"Films"}`,
+			filenames: []string{"Heat.1995.mkv"},
+			problems:  []string{`media_type "film"`, `category "Films"`},
+		},
+		{
+			name:      "missing field",
+			content:   `{"title":"Heat","category":"Movies"}`,
+			filenames: []string{"Heat.1995.mkv"},
+			problems:  []string{"media_type is missing"},
+		},
+		{
+			name:      "missing confidence",
+			content:   `{"title":"Heat","media_type":"movie","category":"Movies"}`,
+			filenames: []string{"Heat.1995.mkv"},
+			problems:  []string{"confidence is missing"},
+		},
+		{
+			name:      "subcategory of another category",
+			content:   `{"title":"Heat","media_type":"movie","category":"Movies","subcategory":"Anime"}`,
+			filenames: []string{"Heat.1995.mkv"},
+			problems:  []string{`subcategory "Anime" is not part of category "Movies"`},
+		},
+		{
+			name: "batch with a missing and an unknown file",
+			content: `{"results":[
+				{"original_filename":"Show.S01E01.mkv","title":"Show","media_type":"tv","category":"TV","season":1,"episode":1,"confidence":0.9},
+				{"original_filename":"Other.S01E01.mkv","title":"Other","media_type":"tv","category":"TV","season":1,"episode":1,"confidence":0.9}
+			]}`,
+			filenames: []string{"Show.S01E01.mkv", "Show.S01E02.mkv"},
+			valid:     1,
+			problems:  []string{`"Other.S01E01.mkv": original_filename is not one of the filenames given`, `no result for "Show.S01E02.mkv"`},
+		},
+		{
+			name:      "batch as a bare array",
+			content:   `[{"original_filename":"Show.S01E01.mkv","title":"Show","media_type":"tv","category":"TV","confidence":0.9}]`,
+			filenames: []string{"Show.S01E01.mkv"},
+			valid:     1,
+		},
+	}
+
+	for _, test := range tests {
+		results, problems := parseResults(test.content, test.filenames, testStructure)
+		if len(results) != test.valid {
+			t.Errorf("%s: %d valid results, expected %d", test.name, len(results), test.valid)
+		}
+		if len(test.problems) == 0 && len(problems) > 0 {
+			t.Errorf("%s: unexpected problems %q", test.name, problems)
+		}
+		joined := strings.Join(problems, "\n")
+		for _, expected := range test.problems {
+			if !strings.Contains(joined, expected) {
+				t.Errorf("%s: problems %q do not mention %q", test.name, problems, expected)
+			}
+		}
+	}
+}
+
+// TestResultSchema tests that the schema restricts the category to the directory structure
+func TestResultSchema(t *testing.T) {
+	schema := resultSchema(testStructure)
+	data, err := json.Marshal(&schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"enum":["Movies","TV"]`) {
+		t.Errorf("schema does not restrict the categories: %s", data)
+	}
+}
+
+// TestAnswerRepair tests that an invalid answer is sent back to the LLM with its problems
+func TestAnswerRepair(t *testing.T) {
+	answers := []string{
+		"```json\n{\"title\":\"Heat\",\"media_type\":\"film\",\"category\":\"Movies\"}\n```",
+		`{"title":"Heat","media_type":"movie","category":"Movies","confidence":0.9}`,
+	}
+	// The response format schema cannot be decoded into a ChatCompletionRequest
+	type chatRequest struct {
+		Messages       []openai.ChatCompletionMessage `json:"messages"`
+		ResponseFormat *struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	var requests []chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, request)
+		answer := answers[min(len(requests), len(answers))-1]
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: "test-model-0613",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 100, CompletionTokens: 10},
+		})
+	}))
+	defer server.Close()
+
+	l, err := New(&config.LLMConfig{Provider: "test", APIKey: "test", BaseURL: server.URL, MaxRepairTurns: 1}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exchanges []*Exchange
+	l.SetRecorder(func(_ context.Context, exchange *Exchange) { exchanges = append(exchanges, exchange) })
+	result, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MediaType != "movie" || result.OriginalFilename != "Heat.1995.mkv" {
+		t.Errorf("result = %+v, expected the repaired movie", result)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, expected 2", len(requests))
+	}
+	if requests[0].ResponseFormat == nil || requests[0].ResponseFormat.Type != string(openai.ChatCompletionResponseFormatTypeJSONSchema) {
+		t.Errorf("structured output was not requested")
+	}
+	repair := requests[1].Messages[len(requests[1].Messages)-1]
+	if repair.Role != openai.ChatMessageRoleUser || !strings.Contains(repair.Content, `media_type "film"`) {
+		t.Errorf("repair turn = %q, expected the problems of the answer", repair.Content)
+	}
+
+	// Both turns are recorded as one exchange
+	if len(exchanges) != 1 {
+		t.Fatalf("%d exchanges recorded, expected 1", len(exchanges))
+	}
+	exchange := exchanges[0]
+	if exchange.Provider != "test" || exchange.Model != "test-model-0613" || exchange.Err != nil {
+		t.Errorf("exchange = %+v, expected a successful exchange with the reported model", exchange)
+	}
+	if prompt, completion := exchange.Tokens(); prompt != 200 || completion != 20 {
+		t.Errorf("exchange used %d prompt and %d completion tokens, expected 200 and 20", prompt, completion)
+	}
+	if len(exchange.Messages) != len(requests[1].Messages)+1 {
+		t.Errorf("exchange has %d messages, expected %d", len(exchange.Messages), len(requests[1].Messages)+1)
+	}
+
+	// Without repair turns the invalid answer fails the file
+	requests = nil
+	l.config.MaxRepairTurns = 0
+	if _, err := l.ProcessMediaFile(context.Background(), "Heat.1995.mkv", testStructure); err == nil {
+		t.Error("expected an error for an invalid answer")
+	}
+	if exchange := exchanges[len(exchanges)-1]; exchange.Err == nil {
+		t.Error("the failed exchange was recorded without an error")
+	}
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/ratelimiter"
+)
+
+// quotas limits the requests and tokens sent to the provider per minute. Nil limiters are
+// not limited.
+type quotas struct {
+	requests *ratelimiter.TokenBucketRateLimiter
+	tokens   *ratelimiter.TokenBucketRateLimiter
+}
+
+// newQuotas creates the limiters of the configured quotas. A full minute of quota may be
+// used at once, after which it refills evenly.
+func newQuotas(requestsPerMinute, tokensPerMinute int) quotas {
+	var q quotas
+	if requestsPerMinute > 0 {
+		q.requests = ratelimiter.NewTokenBucketRateLimiter(float64(requestsPerMinute)/60, float64(requestsPerMinute))
+	}
+	if tokensPerMinute > 0 {
+		q.tokens = ratelimiter.NewTokenBucketRateLimiter(float64(tokensPerMinute)/60, float64(tokensPerMinute))
+	}
+	return q
+}
+
+// wait blocks until a request fits within the quotas and returns the tokens reserved for it
+func (q quotas) wait(ctx context.Context, request openai.ChatCompletionRequest) (int, error) {
+	if q.requests != nil {
+		if err := q.requests.Wait(ctx); err != nil {
+			return 0, fmt.Errorf("failed to wait for the request quota: %w", err)
+		}
+	}
+	if q.tokens == nil {
+		return 0, nil
+	}
+
+	reserved := estimateTokens(request.Messages)
+	if err := q.tokens.WaitN(ctx, float64(reserved)); err != nil {
+		return 0, fmt.Errorf("failed to wait for the token quota: %w", err)
+	}
+	return reserved, nil
+}
+
+// settle replaces the tokens reserved for a request by the tokens it used
+func (q quotas) settle(reserved int, usage openai.Usage) {
+	if q.tokens != nil && usage.TotalTokens > 0 {
+		q.tokens.Adjust(float64(usage.TotalTokens - reserved))
+	}
+}
+
+// estimateTokens estimates the prompt tokens of a conversation at four characters a token
+func estimateTokens(messages []openai.ChatCompletionMessage) int {
+	chars := 0
+	for _, message := range messages {
+		chars += len(message.Content)
+		for _, call := range message.ToolCalls {
+			chars += len(call.Function.Name) + len(call.Function.Arguments)
+		}
+	}
+	return chars/4 + 4*len(messages)
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestQuotas tests that requests wait for the token quota, corrected by the tokens used
+func TestQuotas(t *testing.T) {
+	request := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: strings.Repeat("x", 40)}},
+	}
+
+	// Without quotas nothing is reserved
+	if reserved, err := newQuotas(0, 0).wait(context.Background(), request); err != nil || reserved != 0 {
+		t.Errorf("wait() without quotas = %d, %v, expected 0, nil", reserved, err)
+	}
+
+	q := newQuotas(60, 1000)
+	reserved, err := q.wait(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved != 14 {
+		t.Errorf("wait() reserved %d tokens, expected 14", reserved)
+	}
+
+	// The request used the whole quota, the next one has to wait for it to refill
+	q.settle(reserved, openai.Usage{TotalTokens: 1000})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.wait(ctx, request); err == nil {
+		t.Error("wait() with the quota used up did not wait")
+	}
+}
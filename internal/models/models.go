@@ -12,8 +12,10 @@ type MediaFile struct {
 	DestinationPath string    `json:"destination_path"`
 	FileSize        int64     `json:"file_size"`
 	MediaType       string    `json:"media_type"` // movie, tv
-	Status          string    `json:"status"`     // pending, processing, success, failed, manual
+	Status          string    `json:"status"`     // pending, processing, success, failed, manual, skipped, replaced, missing, broken
 	ErrorMessage    string    `json:"error_message"`
+	LeaseOwner      string    `json:"lease_owner"`      // instance processing the file
+	LeaseExpiresAt  time.Time `json:"lease_expires_at"` // when a processing file without heartbeat is abandoned
 	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	ProcessedAt     time.Time `json:"processed_at"`
@@ -29,6 +31,8 @@ type MediaInfo struct {
 	MediaType     string    `json:"media_type"` // movie, tv
 	Season        int       `json:"season"`
 	Episode       int       `json:"episode"`
+	EndEpisode    int       `json:"end_episode"` // last episode of a multi-episode file, 0 for a single episode
+	Part          int       `json:"part"`        // part of a multi-part movie, 0 for a single file
 	EpisodeTitle  string    `json:"episode_title"`
 	Overview      string    `json:"overview"`
 	TMDBID        int64     `json:"tmdb_id"`
@@ -54,28 +58,37 @@ type APICache struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-// LLMRequest represents an LLM request in the database
+// LLMRequest represents a conversation with the LLM about a file or a batch in the database
 type LLMRequest struct {
-	ID           int64     `json:"id" gorm:"primaryKey"`
-	MediaFileID  int64     `json:"media_file_id"`
-	Prompt       string    `json:"prompt" gorm:"type:text"`
-	Response     string    `json:"response" gorm:"type:text"`
-	Model        string    `json:"model"`
-	Tokens       int       `json:"tokens"`
-	Success      bool      `json:"success"`
-	ErrorMessage string    `json:"error_message"`
-	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ID               int64     `json:"id" gorm:"primaryKey"`
+	MediaFileID      int64     `json:"media_file_id" gorm:"index"`    // 0 for batches
+	BatchProcessID   int64     `json:"batch_process_id" gorm:"index"` // 0 for individual files
+	Prompt           string    `json:"prompt" gorm:"type:text"`       // user message that started the conversation
+	Response         string    `json:"response" gorm:"type:text"`     // final answer
+	Messages         string    `json:"messages" gorm:"type:text"`     // all messages as JSON, including tool calls and their results
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Tokens           int       `json:"tokens"`     // prompt and completion tokens
+	LatencyMs        int64     `json:"latency_ms"` // time spent waiting for the LLM
+	Cost             float64   `json:"cost"`       // according to the price table, 0 for models without a price
+	Success          bool      `json:"success"`
+	ErrorMessage     string    `json:"error_message"`
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime;index"`
 }
 
 // BatchProcess represents a batch processing job
 type BatchProcess struct {
-	ID          int64     `json:"id" gorm:"primaryKey"`
-	Directory   string    `json:"directory" gorm:"not null"`
-	FileCount   int       `json:"file_count"`
-	Status      string    `json:"status"` // pending, processing, completed, failed
-	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
-	CompletedAt time.Time `json:"completed_at"`
+	ID             int64     `json:"id" gorm:"primaryKey"`
+	Directory      string    `json:"directory" gorm:"not null"`
+	FileCount      int       `json:"file_count"`
+	Status         string    `json:"status"`           // pending, processing, completed, failed
+	LeaseOwner     string    `json:"lease_owner"`      // instance processing the batch
+	LeaseExpiresAt time.Time `json:"lease_expires_at"` // when a processing batch without heartbeat is abandoned
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	CompletedAt    time.Time `json:"completed_at"`
 }
 
 // BatchProcessFile represents a file in a batch processing job
@@ -88,11 +101,64 @@ type BatchProcessFile struct {
 	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
+// Candidate represents a candidate identification of a media file awaiting manual review
+type Candidate struct {
+	ID            int64     `json:"id" gorm:"primaryKey"`
+	MediaFileID   int64     `json:"media_file_id" gorm:"index;not null"`
+	Rank          int       `json:"rank"`   // 1 is the best candidate
+	Source        string    `json:"source"` // llm, parser, tmdb
+	Title         string    `json:"title"`
+	OriginalTitle string    `json:"original_title"`
+	Year          int       `json:"year"`
+	MediaType     string    `json:"media_type"` // movie, tv
+	Season        int       `json:"season"`
+	Episode       int       `json:"episode"`
+	EndEpisode    int       `json:"end_episode"`
+	Part          int       `json:"part"`
+	TMDBID        int64     `json:"tmdb_id"`
+	TVDBID        int64     `json:"tvdb_id"`
+	BangumiID     int64     `json:"bangumi_id"`
+	ImdbID        string    `json:"imdb_id"`
+	Category      string    `json:"category"`
+	Subcategory   string    `json:"subcategory"`
+	Confidence    float64   `json:"confidence"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Operation is a journal entry of a file organised into the library, used to undo it
+type Operation struct {
+	ID              int64       `json:"id" gorm:"primaryKey"`
+	MediaFileID     int64       `json:"media_file_id" gorm:"index;not null"`
+	BatchProcessID  int64       `json:"batch_process_id" gorm:"index"` // 0 for individual files
+	SourcePath      string      `json:"source_path" gorm:"not null"`
+	DestinationPath string      `json:"destination_path" gorm:"not null"`
+	Mode            string      `json:"mode"`                                          // copy, move, symlink, hardlink, reflink
+	Fallback        string      `json:"fallback"`                                      // why the configured mode was not used
+	CreatedDirs     []string    `json:"created_dirs" gorm:"serializer:json;type:text"` // outermost first
+	Sidecars        []string    `json:"sidecars" gorm:"serializer:json;type:text"`     // NFO and artwork files written
+	Companions      []Companion `json:"companions" gorm:"serializer:json;type:text"`   // subtitles, audio tracks and images organised along with the file
+	Entries         []string    `json:"entries" gorm:"serializer:json;type:text"`      // entries of a disc folder, empty for files
+	ReplacedPath    string      `json:"replaced_path"`                                 // where the file previously at the destination was recycled to
+	ReplacedFrom    string      `json:"replaced_from"`                                 // where the replaced file was, empty if at the destination
+	ReplacedFileID  int64       `json:"replaced_file_id"`                              // media file of the replaced file, 0 if unknown
+	Status          string      `json:"status" gorm:"index"`                           // done, undone
+	CreatedAt       time.Time   `json:"created_at" gorm:"autoCreateTime;index"`
+	UndoneAt        time.Time   `json:"undone_at"`
+}
+
+// Companion is a sidecar file found next to a media file and organised along with it
+type Companion struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Mode        string `json:"mode"`
+	Replaced    string `json:"replaced,omitempty"` // where a file previously at the destination was recycled to
+}
+
 // Notification represents a notification in the database
 type Notification struct {
 	ID          int64     `json:"id" gorm:"primaryKey"`
 	MediaFileID int64     `json:"media_file_id"`
-	Type        string    `json:"type"` // success, error
+	Type        string    `json:"type"` // success, error, attention
 	Message     string    `json:"message" gorm:"type:text"`
 	Sent        bool      `json:"sent"`
 	SentAt      time.Time `json:"sent_at"`
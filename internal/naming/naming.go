@@ -0,0 +1,333 @@
+package naming
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Fields represents the values available to naming templates
+type Fields struct {
+	Title         string
+	OriginalTitle string
+	Year          int
+	MediaType     string
+	Season        int
+	Episode       int
+	EndEpisode    int // Last episode of a multi-episode file, 0 for a single episode
+	Part          int // Part of a multi-part movie, 0 for a single file
+	EpisodeTitle  string
+	TMDBID        int64
+	TVDBID        int64
+	BangumiID     int64
+	ImdbID        string
+	Category      string
+	Subcategory   string
+	Resolution    string // e.g. 1080p, 2160p
+	Ext           string // original extension including the dot, e.g. .mkv
+}
+
+// value returns the value of a template variable.
+// Year, IDs, the end episode and part are empty when unknown, season and episode numbers are always set.
+func (f *Fields) value(name string) (interface{}, bool) {
+	switch name {
+	case "title":
+		return f.Title, true
+	case "original_title":
+		return f.OriginalTitle, true
+	case "year":
+		return optionalInt(int64(f.Year)), true
+	case "media_type":
+		return f.MediaType, true
+	case "season":
+		return f.Season, true
+	case "episode":
+		return f.Episode, true
+	case "end_episode":
+		return optionalInt(int64(f.EndEpisode)), true
+	case "part":
+		return optionalInt(int64(f.Part)), true
+	case "episode_title":
+		return f.EpisodeTitle, true
+	case "tmdb_id":
+		return optionalInt(f.TMDBID), true
+	case "tvdb_id":
+		return optionalInt(f.TVDBID), true
+	case "bangumi_id":
+		return optionalInt(f.BangumiID), true
+	case "imdb_id":
+		return f.ImdbID, true
+	case "category":
+		return f.Category, true
+	case "subcategory":
+		return f.Subcategory, true
+	case "resolution":
+		return f.Resolution, true
+	case "ext":
+		return strings.TrimPrefix(f.Ext, "."), true
+	default:
+		return nil, false
+	}
+}
+
+// optionalInt returns the number, or an empty string when it is zero
+func optionalInt(n int64) interface{} {
+	if n == 0 {
+		return ""
+	}
+	return int(n)
+}
+
+// Render renders a naming template.
+//
+// Variables are written as {name} or {name:spec}. For numbers the spec is a
+// printf-like width such as 02d; for text it is one of upper, lower or initial.
+// Literal braces are written as {{ and }}. Bracket groups whose variables are all
+// empty are removed with their text, e.g. " [tmdbid-{tmdb_id}]" without an ID, as
+// are dangling separators left behind by empty variables.
+//
+// For multi-episode files {episode} renders the range, repeating the letters written
+// before it: "S{season:02d}E{episode:02d}" becomes "S01E01-E02".
+func Render(tmpl string, fields *Fields) (string, error) {
+	var out []byte
+	var groups []bracketGroup
+
+	for i := 0; i < len(tmpl); i++ {
+		c := tmpl[i]
+		switch {
+		case c == '{' && i+1 < len(tmpl) && tmpl[i+1] == '{':
+			out = append(out, '{')
+			i++
+		case c == '}' && i+1 < len(tmpl) && tmpl[i+1] == '}':
+			out = append(out, '}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(tmpl[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed variable in template %q", tmpl)
+			}
+			expr := tmpl[i+1 : i+end]
+			name, spec, _ := strings.Cut(expr, ":")
+			name = strings.TrimSpace(name)
+
+			value, ok := fields.value(name)
+			if !ok {
+				return "", fmt.Errorf("unknown template variable %q", name)
+			}
+
+			text, err := format(value, strings.TrimSpace(spec))
+			if err != nil {
+				return "", fmt.Errorf("template variable %q: %w", name, err)
+			}
+			if name == "episode" && fields.EndEpisode > fields.Episode {
+				end, err := format(fields.EndEpisode, strings.TrimSpace(spec))
+				if err != nil {
+					return "", fmt.Errorf("template variable %q: %w", name, err)
+				}
+				text += "-" + letterSuffix(tmpl[:i]) + end
+			}
+			// Values must not introduce directories or invalid characters
+			out = append(out, invalidChars.Replace(text)...)
+			if len(groups) > 0 {
+				groups[len(groups)-1].vars = true
+				groups[len(groups)-1].filled = groups[len(groups)-1].filled || text != ""
+			}
+			i += end
+		case (c == ')' || c == ']') && len(groups) > 0:
+			group := groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+			out = append(out, c)
+			if group.vars && !group.filled {
+				out = out[:group.start]
+			} else if len(groups) > 0 {
+				groups[len(groups)-1].vars = groups[len(groups)-1].vars || group.vars
+				groups[len(groups)-1].filled = groups[len(groups)-1].filled || group.filled
+			}
+		default:
+			if c == '(' || c == '[' {
+				groups = append(groups, bracketGroup{start: len(out)})
+			}
+			out = append(out, c)
+		}
+	}
+
+	return tidy(string(out)), nil
+}
+
+// bracketGroup is a bracketed part of a rendered template: where it starts in the output
+// and whether it holds variables and any of them rendered text
+type bracketGroup struct {
+	start        int
+	vars, filled bool
+}
+
+// letterSuffix returns the ASCII letters at the end of a string, e.g. "E" of "S{season:02d}E"
+func letterSuffix(s string) string {
+	start := len(s)
+	for start > 0 && (s[start-1] >= 'a' && s[start-1] <= 'z' || s[start-1] >= 'A' && s[start-1] <= 'Z') {
+		start--
+	}
+	return s[start:]
+}
+
+// format formats a template value according to its spec
+func format(value interface{}, spec string) (string, error) {
+	switch v := value.(type) {
+	case int:
+		if spec == "" {
+			return strconv.Itoa(v), nil
+		}
+		return Pad(v, spec)
+	case string:
+		switch spec {
+		case "":
+			return v, nil
+		case "upper":
+			return strings.ToUpper(v), nil
+		case "lower":
+			return strings.ToLower(v), nil
+		case "initial":
+			return Initial(v), nil
+		default:
+			// Number specs on unknown (empty) numbers render nothing
+			if v == "" {
+				if _, err := Pad(0, spec); err == nil {
+					return "", nil
+				}
+			}
+			return "", fmt.Errorf("unsupported format %q for text", spec)
+		}
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+var numberSpec = regexp.MustCompile(`^(0?)(\d*)d$`)
+
+// Pad formats a number with a printf-like spec such as 02d, 3d or d
+func Pad(n int, spec string) (string, error) {
+	m := numberSpec.FindStringSubmatch(spec)
+	if m == nil {
+		return "", fmt.Errorf("unsupported number format %q", spec)
+	}
+	return fmt.Sprintf("%"+m[1]+m[2]+"d", n), nil
+}
+
+// Initial returns the upper-cased first letter of a title, or "#" when it does not start with a letter
+func Initial(title string) string {
+	for _, r := range title {
+		s := strings.ToUpper(string(r))
+		if strings.ToLower(s) != s {
+			return s
+		}
+		if r > 127 {
+			// Letters without case, such as CJK characters
+			return string(r)
+		}
+		return "#"
+	}
+	return ""
+}
+
+var (
+	emptyBrackets = regexp.MustCompile(`\(\s*\)|\[\s*\]|\{\s*\}`)
+	repeatedDash  = regexp.MustCompile(`\s+-(\s+-)+\s+`)
+	multiSpace    = regexp.MustCompile(`\s{2,}`)
+)
+
+// tidy removes the leftovers of empty variables, e.g. "Title ()" or "Show - S01E01 - "
+func tidy(s string) string {
+	parts := strings.Split(s, "/")
+	for i, part := range parts {
+		part = emptyBrackets.ReplaceAllString(part, "")
+		part = repeatedDash.ReplaceAllString(part, " - ")
+		part = multiSpace.ReplaceAllString(part, " ")
+		part = strings.Trim(part, " -_.")
+		parts[i] = part
+	}
+	return strings.Join(parts, "/")
+}
+
+// RenderPath renders a template that may contain "/" separated directories.
+// Every component is sanitised for use as a file name and empty components are dropped.
+func RenderPath(tmpl string, fields *Fields) ([]string, error) {
+	components, err := RenderDirs(tmpl, fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("template %q renders to an empty path", tmpl)
+	}
+	return components, nil
+}
+
+// RenderDirs renders a template of "/" separated directories like RenderPath,
+// but the template may render to no directory at all.
+func RenderDirs(tmpl string, fields *Fields) ([]string, error) {
+	rendered, err := Render(tmpl, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var components []string
+	for _, part := range strings.Split(rendered, "/") {
+		if part = SanitizeComponent(part); part != "" {
+			components = append(components, part)
+		}
+	}
+	return components, nil
+}
+
+// invalidChars holds characters that are not allowed in file names on common file systems
+var invalidChars = strings.NewReplacer(
+	"/", " ",
+	"\\", " ",
+	":", " -",
+	"*", "",
+	"?", "",
+	"\"", "'",
+	"<", "",
+	">", "",
+	"|", " ",
+)
+
+// SanitizeComponent makes a string safe to use as a single file or directory name
+func SanitizeComponent(name string) string {
+	name = invalidChars.Replace(name)
+	name = strings.Map(func(r rune) rune {
+		if r < 32 {
+			return -1
+		}
+		return r
+	}, name)
+	name = multiSpace.ReplaceAllString(name, " ")
+	name = strings.TrimSpace(name)
+	// Trailing dots are not allowed on Windows shares, leading dots hide files
+	name = strings.Trim(name, ".")
+	if name == "." || name == ".." {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+var resolutionPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(\d{3,4})([pi])(?:[^a-z0-9]|$)|(?:^|[^a-z0-9])(4k|uhd|8k)(?:[^a-z0-9]|$)`)
+
+// Resolution detects the video resolution from a file name, e.g. "1080p" or "2160p"
+func Resolution(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	m := resolutionPattern.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	if m[1] != "" {
+		return m[1] + strings.ToLower(m[2])
+	}
+	switch strings.ToLower(m[3]) {
+	case "8k":
+		return "4320p"
+	default:
+		return "2160p"
+	}
+}
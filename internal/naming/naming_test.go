@@ -0,0 +1,108 @@
+package naming
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRender tests the template rendering
+func TestRender(t *testing.T) {
+	fields := &Fields{
+		Title:        "Breaking Bad",
+		Year:         2008,
+		Season:       1,
+		Episode:      2,
+		EpisodeTitle: "Cat's in the Bag...",
+		TMDBID:       1396,
+		Resolution:   "1080p",
+		Ext:          ".mkv",
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		fields   *Fields
+		expected string
+	}{
+		{"Movie folder", "{title} ({year})", fields, "Breaking Bad (2008)"},
+		{"Episode", "{title} - S{season:02d}E{episode:02d} - {episode_title}", fields, "Breaking Bad - S01E02 - Cat's in the Bag"},
+		{"Padding", "{episode:03d}", fields, "002"},
+		{"Text specs", "{title:initial}/{title:upper}", fields, "B/BREAKING BAD"},
+		{"IDs and extension", "{title} [tmdbid-{tmdb_id}] {resolution}.{ext}", fields, "Breaking Bad [tmdbid-1396] 1080p.mkv"},
+		{"Literal braces", "{{x}} {title}", fields, "{x} Breaking Bad"},
+		{"Missing year", "{title} ({year})", &Fields{Title: "Unknown"}, "Unknown"},
+		{"Missing episode title", "{title} - S{season:02d}E{episode:02d} - {episode_title}", &Fields{Title: "Show", Season: 1, Episode: 3}, "Show - S01E03"},
+		{"Missing ID", "{title} [tmdbid-{tmdb_id}]", &Fields{Title: "Show"}, "Show"},
+		{"Missing ID after year", "{title} ({year}) [tmdbid-{tmdb_id}]", &Fields{Title: "Movie", Year: 2001}, "Movie (2001)"},
+		{"Literal brackets", "{title} [Extended]", &Fields{Title: "Movie"}, "Movie [Extended]"},
+		{"Specials", "Season {season:02d}", &Fields{Season: 0}, "Season 00"},
+		{"Multi-episode", "{title} - S{season:02d}E{episode:02d}", &Fields{Title: "Show", Season: 1, Episode: 1, EndEpisode: 2}, "Show - S01E01-E02"},
+		{"Multi-episode cross style", "{season}x{episode:02d}", &Fields{Season: 1, Episode: 1, EndEpisode: 3}, "1x01-x03"},
+		{"Part", "{title} ({year}) - part{part}", &Fields{Title: "Movie", Year: 2001, Part: 2}, "Movie (2001) - part2"},
+		{"Invalid characters", "{title}", &Fields{Title: "Fate/Zero: Part?"}, "Fate Zero - Part"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Render(tc.template, tc.fields)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+// TestRenderErrors tests invalid templates
+func TestRenderErrors(t *testing.T) {
+	templates := []string{
+		"{unknown}",
+		"{title",
+		"{season:x}",
+		"{title:02d}",
+	}
+
+	for _, tmpl := range templates {
+		if _, err := Render(tmpl, &Fields{Title: "Title"}); err == nil {
+			t.Errorf("Expected error for template %q", tmpl)
+		}
+	}
+}
+
+// TestRenderPath tests rendering templates with directories
+func TestRenderPath(t *testing.T) {
+	fields := &Fields{Title: "Movie", Year: 2019}
+
+	result, err := RenderPath("{title:initial}/{title} ({year})/{title}", fields)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"M", "Movie (2019)", "Movie"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	if _, err := RenderPath("{episode_title}", fields); err == nil {
+		t.Errorf("Expected error for empty path")
+	}
+}
+
+// TestResolution tests the resolution detection
+func TestResolution(t *testing.T) {
+	testCases := map[string]string{
+		"Movie.Name.2019.1080p.BluRay.x264-GRP.mkv": "1080p",
+		"Show.S01E01.2160p.WEB-DL.mkv":              "2160p",
+		"Movie.Name.4K.HDR.mkv":                     "2160p",
+		"[Group] Anime - 01 [720p].mkv":             "720p",
+		"Old.Movie.576i.avi":                        "576i",
+		"Movie.Name.2019.mkv":                       "",
+	}
+
+	for filename, expected := range testCases {
+		if result := Resolution(filename); result != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, filename, result)
+		}
+	}
+}
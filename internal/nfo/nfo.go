@@ -0,0 +1,364 @@
+package nfo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// Header is the XML declaration written at the top of every NFO file
+const Header = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// UniqueID represents a provider identifier (<uniqueid type="tmdb">123</uniqueid>)
+type UniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+// Element preserves an element that is not modelled explicitly, such as
+// tags added by a media server or by hand
+type Element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
+}
+
+// Movie represents a Kodi/Emby/Jellyfin movie NFO document
+type Movie struct {
+	XMLName       xml.Name   `xml:"movie"`
+	Title         string     `xml:"title"`
+	OriginalTitle string     `xml:"originaltitle,omitempty"`
+	Year          int        `xml:"year,omitempty"`
+	Plot          string     `xml:"plot,omitempty"`
+	Runtime       int        `xml:"runtime,omitempty"`
+	Rating        float32    `xml:"rating,omitempty"`
+	Genres        []string   `xml:"genre"`
+	Countries     []string   `xml:"country"`
+	UniqueIDs     []UniqueID `xml:"uniqueid"`
+	TMDBID        string     `xml:"tmdbid,omitempty"`
+	ImdbID        string     `xml:"imdbid,omitempty"`
+	Extra         []Element  `xml:",any"`
+}
+
+// TVShow represents a Kodi/Emby/Jellyfin tvshow.nfo document
+type TVShow struct {
+	XMLName       xml.Name   `xml:"tvshow"`
+	Title         string     `xml:"title"`
+	OriginalTitle string     `xml:"originaltitle,omitempty"`
+	Year          int        `xml:"year,omitempty"`
+	Plot          string     `xml:"plot,omitempty"`
+	Rating        float32    `xml:"rating,omitempty"`
+	Genres        []string   `xml:"genre"`
+	Countries     []string   `xml:"country"`
+	UniqueIDs     []UniqueID `xml:"uniqueid"`
+	TMDBID        string     `xml:"tmdbid,omitempty"`
+	TVDBID        string     `xml:"tvdbid,omitempty"`
+	ImdbID        string     `xml:"imdbid,omitempty"`
+	Extra         []Element  `xml:",any"`
+}
+
+// Episode represents a Kodi/Emby/Jellyfin episode NFO document
+type Episode struct {
+	XMLName   xml.Name   `xml:"episodedetails"`
+	Title     string     `xml:"title"`
+	ShowTitle string     `xml:"showtitle,omitempty"`
+	Season    int        `xml:"season"`
+	Episode   int        `xml:"episode"`
+	Plot      string     `xml:"plot,omitempty"`
+	Aired     string     `xml:"aired,omitempty"`
+	Rating    float32    `xml:"rating,omitempty"`
+	UniqueIDs []UniqueID `xml:"uniqueid"`
+	Extra     []Element  `xml:",any"`
+}
+
+// NewMovie builds a movie NFO document from the media info and provider details
+func NewMovie(info *models.MediaInfo, details *api.MediaDetails) *Movie {
+	movie := &Movie{
+		Title:         info.Title,
+		OriginalTitle: info.OriginalTitle,
+		Year:          info.Year,
+		Plot:          info.Overview,
+		Genres:        splitList(info.Genres),
+		Countries:     splitList(info.Countries),
+		UniqueIDs:     uniqueIDs(info),
+		ImdbID:        info.ImdbID,
+	}
+	if info.TMDBID > 0 {
+		movie.TMDBID = strconv.FormatInt(info.TMDBID, 10)
+	}
+
+	if details != nil && details.Movie != nil {
+		m := details.Movie
+		movie.Title = firstNonEmpty(movie.Title, m.Title)
+		movie.OriginalTitle = firstNonEmpty(movie.OriginalTitle, m.OriginalTitle)
+		movie.Plot = firstNonEmpty(movie.Plot, m.Overview)
+		movie.Runtime = m.Runtime
+		movie.Rating = m.VoteAverage
+		if movie.Year == 0 {
+			movie.Year = m.ReleaseYear
+		}
+		movie.Genres = mergeStrings(movie.Genres, m.Genres)
+		movie.Countries = mergeStrings(movie.Countries, m.Countries)
+	}
+
+	return movie
+}
+
+// NewTVShow builds a tvshow.nfo document from the media info and provider details
+func NewTVShow(info *models.MediaInfo, details *api.MediaDetails) *TVShow {
+	show := &TVShow{
+		Title:         info.Title,
+		OriginalTitle: info.OriginalTitle,
+		Year:          info.Year,
+		Plot:          info.Overview,
+		Genres:        splitList(info.Genres),
+		Countries:     splitList(info.Countries),
+		UniqueIDs:     uniqueIDs(info),
+		ImdbID:        info.ImdbID,
+	}
+	if info.TMDBID > 0 {
+		show.TMDBID = strconv.FormatInt(info.TMDBID, 10)
+	}
+	if info.TVDBID > 0 {
+		show.TVDBID = strconv.FormatInt(info.TVDBID, 10)
+	}
+
+	if details == nil {
+		return show
+	}
+
+	if tv := details.TVShow; tv != nil {
+		show.OriginalTitle = firstNonEmpty(show.OriginalTitle, tv.OriginalName)
+		show.Plot = firstNonEmpty(show.Plot, tv.Overview)
+		show.Rating = tv.VoteAverage
+		if show.Year == 0 {
+			show.Year = tv.FirstAirYear
+		}
+		show.Genres = mergeStrings(show.Genres, tv.Genres)
+		show.Countries = mergeStrings(show.Countries, tv.Countries)
+	}
+
+	if tvdb := details.TVDBSeries; tvdb != nil {
+		show.Plot = firstNonEmpty(show.Plot, tvdb.Overview)
+		if show.Year == 0 {
+			show.Year = tvdb.FirstAiredYear
+		}
+		show.Genres = mergeStrings(show.Genres, tvdb.Genres)
+		show.Countries = mergeStrings(show.Countries, tvdb.Countries)
+	}
+
+	if bangumi := details.Bangumi; bangumi != nil {
+		show.OriginalTitle = firstNonEmpty(show.OriginalTitle, bangumi.Name)
+		show.Plot = firstNonEmpty(show.Plot, bangumi.Summary)
+		if show.Year == 0 {
+			show.Year = bangumi.Year
+		}
+		if show.Rating == 0 {
+			show.Rating = float32(bangumi.Rating)
+		}
+	}
+
+	return show
+}
+
+// NewEpisode builds an episode NFO document from the media info and provider details
+func NewEpisode(info *models.MediaInfo, details *api.MediaDetails) *Episode {
+	return newEpisode(info, details, info.Episode, info.EpisodeTitle)
+}
+
+// NewEpisodes builds the episode NFO documents of a file. A file holding several episodes
+// gets one document per episode, which are written one after another into the same NFO.
+func NewEpisodes(info *models.MediaInfo, details *api.MediaDetails) []*Episode {
+	if info.EndEpisode <= info.Episode {
+		return []*Episode{NewEpisode(info, details)}
+	}
+
+	// The joined episode title of the media info covers the whole file
+	episodes := make([]*Episode, 0, info.EndEpisode-info.Episode+1)
+	for number := info.Episode; number <= info.EndEpisode; number++ {
+		episodes = append(episodes, newEpisode(info, details, number, ""))
+	}
+	return episodes
+}
+
+// newEpisode builds the NFO document of a single episode number
+func newEpisode(info *models.MediaInfo, details *api.MediaDetails, number int, title string) *Episode {
+	episode := &Episode{
+		Title:     title,
+		ShowTitle: info.Title,
+		Season:    info.Season,
+		Episode:   number,
+	}
+
+	if details != nil {
+		// TMDB season details
+		if details.Season != nil {
+			for _, e := range details.Season.Episodes {
+				if e.EpisodeNumber == number {
+					episode.Title = firstNonEmpty(episode.Title, e.Name)
+					episode.Plot = e.Overview
+					episode.Aired = e.AirDate
+					episode.Rating = e.VoteAverage
+					episode.UniqueIDs = append(episode.UniqueIDs, UniqueID{Type: "tmdb", Default: true, Value: strconv.FormatInt(e.ID, 10)})
+					break
+				}
+			}
+		}
+
+		// TVDB season episodes
+		if details.TVDBSeason != nil {
+			for _, e := range details.TVDBSeason.Episodes {
+				if e.EpisodeNumber == number && e.SeasonNumber == info.Season {
+					episode.Title = firstNonEmpty(episode.Title, e.Name)
+					episode.Plot = firstNonEmpty(episode.Plot, e.Overview)
+					episode.Aired = firstNonEmpty(episode.Aired, e.AirDate)
+					episode.UniqueIDs = append(episode.UniqueIDs, UniqueID{Type: "tvdb", Default: len(episode.UniqueIDs) == 0, Value: strconv.Itoa(e.ID)})
+					break
+				}
+			}
+		}
+
+		// Bangumi episodes
+		if details.Bangumi != nil {
+			for _, e := range details.Bangumi.Episodes {
+				if e.Sort == number {
+					episode.Title = firstNonEmpty(episode.Title, e.NameCN, e.Name)
+					episode.Aired = firstNonEmpty(episode.Aired, e.AirDate)
+					episode.UniqueIDs = append(episode.UniqueIDs, UniqueID{Type: "bangumi", Default: len(episode.UniqueIDs) == 0, Value: strconv.Itoa(e.ID)})
+					break
+				}
+			}
+		}
+	}
+
+	if episode.Title == "" {
+		episode.Title = fmt.Sprintf("Episode %d", number)
+	}
+
+	return episode
+}
+
+// ParseTVShow parses an existing tvshow.nfo document
+func ParseTVShow(data []byte) (*TVShow, error) {
+	var show TVShow
+	if err := xml.Unmarshal(data, &show); err != nil {
+		return nil, fmt.Errorf("error parsing tvshow NFO: %w", err)
+	}
+	return &show, nil
+}
+
+// Merge merges an updated document into an existing tvshow.nfo. Values that
+// are already present are kept so manual edits survive, missing values are
+// filled in and lists and provider IDs are combined.
+func (s *TVShow) Merge(update *TVShow) {
+	s.Title = firstNonEmpty(s.Title, update.Title)
+	s.OriginalTitle = firstNonEmpty(s.OriginalTitle, update.OriginalTitle)
+	s.Plot = firstNonEmpty(s.Plot, update.Plot)
+	s.TMDBID = firstNonEmpty(s.TMDBID, update.TMDBID)
+	s.TVDBID = firstNonEmpty(s.TVDBID, update.TVDBID)
+	s.ImdbID = firstNonEmpty(s.ImdbID, update.ImdbID)
+	if s.Year == 0 {
+		s.Year = update.Year
+	}
+	if s.Rating == 0 {
+		s.Rating = update.Rating
+	}
+	s.Genres = mergeStrings(s.Genres, update.Genres)
+	s.Countries = mergeStrings(s.Countries, update.Countries)
+	s.UniqueIDs = mergeUniqueIDs(s.UniqueIDs, update.UniqueIDs)
+}
+
+// Marshal renders an NFO document including the XML declaration
+func Marshal(v interface{}) (string, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling NFO: %w", err)
+	}
+	return Header + string(data) + "\n", nil
+}
+
+// uniqueIDs builds the provider identifiers known for a media item
+func uniqueIDs(info *models.MediaInfo) []UniqueID {
+	ids := make([]UniqueID, 0, 4)
+	if info.TMDBID > 0 {
+		ids = append(ids, UniqueID{Type: "tmdb", Value: strconv.FormatInt(info.TMDBID, 10)})
+	}
+	if info.TVDBID > 0 {
+		ids = append(ids, UniqueID{Type: "tvdb", Value: strconv.FormatInt(info.TVDBID, 10)})
+	}
+	if info.ImdbID != "" {
+		ids = append(ids, UniqueID{Type: "imdb", Value: info.ImdbID})
+	}
+	if info.BangumiID > 0 {
+		ids = append(ids, UniqueID{Type: "bangumi", Value: strconv.FormatInt(info.BangumiID, 10)})
+	}
+	if len(ids) > 0 {
+		ids[0].Default = true
+	}
+	return ids
+}
+
+// mergeUniqueIDs adds provider identifiers whose type is not present yet
+func mergeUniqueIDs(existing, update []UniqueID) []UniqueID {
+	hasDefault := false
+	seen := make(map[string]bool, len(existing))
+	for _, id := range existing {
+		seen[id.Type] = true
+		hasDefault = hasDefault || id.Default
+	}
+	for _, id := range update {
+		if seen[id.Type] {
+			continue
+		}
+		id.Default = id.Default && !hasDefault
+		hasDefault = hasDefault || id.Default
+		existing = append(existing, id)
+		seen[id.Type] = true
+	}
+	return existing
+}
+
+// splitList splits a comma separated list stored in the database
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// mergeStrings appends the values that are not present yet, preserving order
+func mergeStrings(existing, update []string) []string {
+	seen := make(map[string]bool, len(existing))
+	for _, value := range existing {
+		seen[strings.ToLower(value)] = true
+	}
+	for _, value := range update {
+		if value == "" || seen[strings.ToLower(value)] {
+			continue
+		}
+		existing = append(existing, value)
+		seen[strings.ToLower(value)] = true
+	}
+	return existing
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
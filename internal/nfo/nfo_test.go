@@ -0,0 +1,153 @@
+package nfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+func TestNewMovie(t *testing.T) {
+	info := &models.MediaInfo{
+		Title:     "Parasite",
+		Year:      2019,
+		MediaType: "movie",
+		TMDBID:    496243,
+		ImdbID:    "tt6751668",
+		Genres:    "Comedy,Thriller",
+	}
+	details := &api.MediaDetails{
+		Movie: &api.MovieDetails{
+			OriginalTitle: "기생충",
+			Overview:      "All unemployed, Ki-taek's family takes peculiar interest in the wealthy Parks.",
+			Genres:        []string{"Thriller", "Drama"},
+			Countries:     []string{"South Korea"},
+			Runtime:       133,
+		},
+	}
+
+	content, err := Marshal(NewMovie(info, details))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		Header,
+		"<movie>",
+		"<title>Parasite</title>",
+		"<originaltitle>기생충</originaltitle>",
+		"<year>2019</year>",
+		"<runtime>133</runtime>",
+		"<genre>Comedy</genre>",
+		"<genre>Thriller</genre>",
+		"<genre>Drama</genre>",
+		"<country>South Korea</country>",
+		`<uniqueid type="tmdb" default="true">496243</uniqueid>`,
+		`<uniqueid type="imdb">tt6751668</uniqueid>`,
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(content, fragment) {
+			t.Errorf("Expected NFO to contain '%s', got:\n%s", fragment, content)
+		}
+	}
+	if strings.Count(content, "<genre>Thriller</genre>") != 1 {
+		t.Errorf("Expected genres to be de-duplicated, got:\n%s", content)
+	}
+}
+
+func TestNewEpisode(t *testing.T) {
+	info := &models.MediaInfo{Title: "The Expanse", MediaType: "tv", Season: 1, Episode: 2}
+	details := &api.MediaDetails{
+		Season: &api.SeasonDetails{
+			Episodes: []api.Episode{
+				{ID: 1001, EpisodeNumber: 1, Name: "Dulcinea"},
+				{ID: 1002, EpisodeNumber: 2, Name: "The Big Empty", AirDate: "2015-12-15"},
+			},
+		},
+	}
+
+	episode := NewEpisode(info, details)
+	if episode.Title != "The Big Empty" {
+		t.Errorf("Expected title 'The Big Empty', got '%s'", episode.Title)
+	}
+	if episode.Aired != "2015-12-15" {
+		t.Errorf("Expected aired '2015-12-15', got '%s'", episode.Aired)
+	}
+	if len(episode.UniqueIDs) != 1 || episode.UniqueIDs[0].Value != "1002" {
+		t.Errorf("Expected TMDB episode ID 1002, got %+v", episode.UniqueIDs)
+	}
+}
+
+func TestNewEpisodesMultiEpisode(t *testing.T) {
+	info := &models.MediaInfo{Title: "The Expanse", MediaType: "tv", Season: 1, Episode: 1, EndEpisode: 2, EpisodeTitle: "Dulcinea + The Big Empty"}
+	details := &api.MediaDetails{
+		Season: &api.SeasonDetails{
+			Episodes: []api.Episode{
+				{ID: 1001, EpisodeNumber: 1, Name: "Dulcinea"},
+				{ID: 1002, EpisodeNumber: 2, Name: "The Big Empty"},
+			},
+		},
+	}
+
+	episodes := NewEpisodes(info, details)
+	if len(episodes) != 2 {
+		t.Fatalf("Expected 2 episodes, got %d", len(episodes))
+	}
+	if episodes[0].Title != "Dulcinea" || episodes[1].Title != "The Big Empty" || episodes[1].Episode != 2 {
+		t.Errorf("Expected the episodes of the range, got %+v and %+v", episodes[0], episodes[1])
+	}
+
+	content, err := Marshal(episodes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Count(content, "<episodedetails>") != 2 {
+		t.Errorf("Expected 2 episodedetails documents, got:\n%s", content)
+	}
+}
+
+func TestTVShowMerge(t *testing.T) {
+	existing := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<tvshow>
+  <title>七宗罪</title>
+  <plot>Edited by hand</plot>
+  <genre>剧情</genre>
+  <uniqueid type="tmdb" default="true">12345</uniqueid>
+  <lockdata>true</lockdata>
+</tvshow>`
+
+	show, err := ParseTVShow([]byte(existing))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	show.Merge(&TVShow{
+		Title:     "Se7en Sins",
+		Year:      2014,
+		Plot:      "Provider plot",
+		Genres:    []string{"剧情", "悬疑"},
+		UniqueIDs: []UniqueID{{Type: "tmdb", Default: true, Value: "12345"}, {Type: "tvdb", Default: false, Value: "678"}},
+	})
+
+	if show.Title != "七宗罪" || show.Plot != "Edited by hand" {
+		t.Errorf("Expected existing values to be kept, got title '%s' plot '%s'", show.Title, show.Plot)
+	}
+	if show.Year != 2014 {
+		t.Errorf("Expected missing year to be filled, got %d", show.Year)
+	}
+	if len(show.Genres) != 2 {
+		t.Errorf("Expected 2 genres, got %v", show.Genres)
+	}
+	if len(show.UniqueIDs) != 2 {
+		t.Errorf("Expected 2 unique IDs, got %+v", show.UniqueIDs)
+	}
+
+	content, err := Marshal(show)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(content, "<lockdata>true</lockdata>") {
+		t.Errorf("Expected unknown elements to be preserved, got:\n%s", content)
+	}
+}
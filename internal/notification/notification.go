@@ -47,7 +47,8 @@ func (n *Notifier) SendPendingNotifications() error {
 		var err error
 		if notification.Type == "success" {
 			err = n.sendSuccessNotification(&notification)
-		} else if notification.Type == "error" {
+		} else if notification.Type == "error" || notification.Type == "attention" {
+			// Files needing attention are reported to the same group as errors
 			err = n.sendErrorNotification(&notification)
 		} else {
 			log.Warn().Str("type", notification.Type).Msg("Unknown notification type")
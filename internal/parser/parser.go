@@ -0,0 +1,516 @@
+// Package parser implements a rule-based media filename parser.
+// It is used as a first pass before the LLM, which is only asked when the
+// parser is not confident about its result.
+package parser
+
+import (
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Result represents the information parsed from a filename
+type Result struct {
+	OriginalFilename string  `json:"original_filename"`
+	Title            string  `json:"title"`
+	Year             int     `json:"year,omitempty"`
+	MediaType        string  `json:"media_type,omitempty"` // movie, tv or empty when unknown
+	Season           int     `json:"season,omitempty"`
+	Episode          int     `json:"episode,omitempty"`
+	EndEpisode       int     `json:"end_episode,omitempty"`      // Last episode of a multi-episode file
+	Part             int     `json:"part,omitempty"`             // Part of a multi-part movie, e.g. CD2
+	AbsoluteEpisode  bool    `json:"absolute_episode,omitempty"` // Episode is an absolute (anime) number
+	Group            string  `json:"group,omitempty"`
+	Resolution       string  `json:"resolution,omitempty"`
+	Source           string  `json:"source,omitempty"`
+	VideoCodec       string  `json:"video_codec,omitempty"`
+	AudioCodec       string  `json:"audio_codec,omitempty"`
+	Confidence       float64 `json:"confidence"`
+}
+
+// tag is a recognised token with its position in the normalised name
+type tag struct {
+	start, end int
+}
+
+var (
+	leadingGroupPattern = regexp.MustCompile(`^\s*[\[【]([^\]】]+)[\]】]`)
+	sceneGroupPattern   = regexp.MustCompile(`-([A-Za-z0-9]+)$`)
+	bracketPattern      = regexp.MustCompile(`[\[【(（]([^\]】)）]*)[\]】)）]`)
+
+	seasonEpisodePattern = regexp.MustCompile(`(?i)\bS(\d{1,2})\s?E(\d{1,4})((?:-?E\d{1,4}|-\d{1,4})*)\b`)
+	crossEpisodePattern  = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})((?:-x?\d{2,3}|x\d{2,3})*)\b`)
+	seasonPattern        = regexp.MustCompile(`(?i)\b(?:S(\d{1,2})|Season\s?(\d{1,2}))\b`)
+	episodeWordPattern   = regexp.MustCompile(`(?i)\b(?:E|EP|Episode\s?)(\d{1,4})\b`)
+	cnSeasonPattern      = regexp.MustCompile(`第\s*([0-9零〇一二两三四五六七八九十百]+)\s*季`)
+	cnEpisodePattern     = regexp.MustCompile(`第\s*([0-9零〇一二两三四五六七八九十百]+)\s*[集话話]`)
+	absoluteEpisode      = regexp.MustCompile(`(?:\s-\s|[\[【]|\s#)(\d{1,4})(?:v\d)?(?:\s|[\]】]|$)`)
+	yearPattern          = regexp.MustCompile(`\b((?:19|20)\d{2})\b`)
+	lastNumberPattern    = regexp.MustCompile(`(\d+)$`)
+
+	// Parts of multi-part movies; "Part 2" is often part of the title and only counts after the year
+	discPattern = regexp.MustCompile(`(?i)\b(?:CD|DISC|DISK)\s?(\d{1,2})\b`)
+	partPattern = regexp.MustCompile(`(?i)\b(?:PART|PT)\s?(\d{1,2})\b`)
+
+	resolutionPattern = regexp.MustCompile(`(?i)\b(\d{3,4})([pi])\b|\b(4K|UHD|8K)\b`)
+	sourcePattern     = regexp.MustCompile(`(?i)\b(UHD\s?Blu-?Ray|Blu-?Ray|BDRip|BRRip|BDRemux|Remux|WEB-?DL|WEB-?Rip|WEB|HDTV|PDTV|DVDRip|DVD|HDRip|HDTC|HDCAM|CAM)\b`)
+	videoCodecPattern = regexp.MustCompile(`(?i)\b(x264|h\s?264|AVC|x265|h\s?265|HEVC|AV1|XviD|DivX|VC-?1|MPEG-?2)\b`)
+	audioCodecPattern = regexp.MustCompile(`(?i)\b(DTS-?HD(?:\sMA)?|DTS-?X|DTS|TrueHD|Atmos|E-?AC-?3|DDP(?:\s?\d\s\d)?|DD\+|DD(?:\s?\d\s\d)?|AC-?3|AAC(?:\s?\d\s\d)?|FLAC|OPUS|MP3)\b`)
+	otherTagPattern   = regexp.MustCompile(`(?i)\b(PROPER|REPACK|EXTENDED|UNRATED|REMASTERED|DIRECTORS\sCUT|HDR10\+?|HDR|DV|DoVi|10bit|8bit|HQ|IMAX|1080|720|2160|COMPLETE|MULTi|SUBBED|DUBBED|CHS|CHT|BIG5|GB)\b`)
+)
+
+// videoExtensions are stripped from the filename before parsing
+var videoExtensions = map[string]bool{
+	".mkv": true, ".mp4": true, ".avi": true, ".ts": true, ".m2ts": true, ".mov": true,
+	".wmv": true, ".flv": true, ".rmvb": true, ".webm": true, ".mpg": true, ".mpeg": true,
+	".iso": true, ".vob": true, ".m4v": true,
+}
+
+// Parse parses a media filename.
+func Parse(filename string) *Result {
+	result := &Result{OriginalFilename: filename}
+
+	name := filepath.Base(filename)
+	if ext := strings.ToLower(filepath.Ext(name)); videoExtensions[ext] {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	// Release group: "[Group] Title - 01" or "Title.2019.1080p.x264-GROUP"
+	if m := leadingGroupPattern.FindStringSubmatchIndex(name); m != nil {
+		group := name[m[2]:m[3]]
+		if !isTagText(group) {
+			result.Group = strings.TrimSpace(group)
+			name = name[m[1]:]
+		}
+	}
+
+	normalized := normalize(name)
+
+	// Scene groups follow the release tags, e.g. "x264-GROUP" but not "Spider-Man" or "WEB-DL"
+	if result.Group == "" {
+		if m := sceneGroupPattern.FindStringSubmatchIndex(normalized); m != nil {
+			candidate := normalized[m[2]:m[3]]
+			prefix := strings.Fields(normalized[:m[0]])
+			if len(prefix) > 0 {
+				last := prefix[len(prefix)-1]
+				if isTagText(last) && !isTagText(last+"-"+candidate) && !isNumber(candidate) {
+					result.Group = candidate
+					normalized = strings.TrimSpace(normalized[:m[0]])
+				}
+			}
+		}
+	}
+
+	// Positions of all tags; the title ends at the first tag
+	var tags []tag
+	add := func(loc []int) {
+		if loc != nil {
+			tags = append(tags, tag{loc[0], loc[1]})
+		}
+	}
+
+	// Release information
+	if m := resolutionPattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		if m[2] >= 0 {
+			result.Resolution = normalized[m[2]:m[3]] + strings.ToLower(normalized[m[4]:m[5]])
+		} else if strings.EqualFold(normalized[m[6]:m[7]], "8K") {
+			result.Resolution = "4320p"
+		} else {
+			result.Resolution = "2160p"
+		}
+	}
+	if m := sourcePattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.Source = normalizeSource(normalized[m[2]:m[3]])
+	}
+	if m := videoCodecPattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.VideoCodec = normalizeVideoCodec(normalized[m[2]:m[3]])
+	}
+	if m := audioCodecPattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.AudioCodec = normalizeAudioCodec(normalized[m[2]:m[3]])
+	}
+
+	// The release year comes before the release information, years after it are not the year
+	releaseStart := len(normalized)
+	for _, t := range tags {
+		releaseStart = min(releaseStart, t.start)
+	}
+
+	for _, m := range otherTagPattern.FindAllStringIndex(normalized, -1) {
+		add(m)
+	}
+
+	// Season and episode
+	var episodeScore float64
+	if m := seasonEpisodePattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.Season = atoi(normalized[m[2]:m[3]])
+		result.Episode = atoi(normalized[m[4]:m[5]])
+		result.EndEpisode = endEpisode(result.Episode, normalized[m[6]:m[7]])
+		episodeScore = 0.45
+	} else if m := crossEpisodePattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.Season = atoi(normalized[m[2]:m[3]])
+		result.Episode = atoi(normalized[m[4]:m[5]])
+		result.EndEpisode = endEpisode(result.Episode, normalized[m[6]:m[7]])
+		episodeScore = 0.4
+	} else if m := cnEpisodePattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.Episode = parseChineseNumber(normalized[m[2]:m[3]])
+		result.Season = 1
+		episodeScore = 0.3
+		if s := cnSeasonPattern.FindStringSubmatchIndex(normalized); s != nil {
+			add(s)
+			result.Season = parseChineseNumber(normalized[s[2]:s[3]])
+			episodeScore = 0.45
+		} else if s := seasonPattern.FindStringSubmatchIndex(normalized); s != nil {
+			add(s)
+			result.Season = atoi(firstGroup(normalized, s))
+			episodeScore = 0.45
+		}
+	} else if m := episodeWordPattern.FindStringSubmatchIndex(normalized); m != nil {
+		add(m)
+		result.Episode = atoi(normalized[m[2]:m[3]])
+		result.Season = 1
+		episodeScore = 0.3
+		if s := seasonPattern.FindStringSubmatchIndex(normalized); s != nil && s[0] < m[0] {
+			add(s)
+			result.Season = atoi(firstGroup(normalized, s))
+			episodeScore = 0.4
+		} else if s := cnSeasonPattern.FindStringSubmatchIndex(normalized); s != nil {
+			add(s)
+			result.Season = parseChineseNumber(normalized[s[2]:s[3]])
+			episodeScore = 0.4
+		}
+	} else if m := absoluteEpisode.FindStringSubmatchIndex(normalized); m != nil && !isYear(normalized[m[2]:m[3]]) {
+		// Anime releases usually only carry an absolute episode number
+		add([]int{m[0], m[1]})
+		result.Episode = atoi(normalized[m[2]:m[3]])
+		result.Season = 1
+		result.AbsoluteEpisode = true
+		episodeScore = 0.25
+	} else if s := cnSeasonPattern.FindStringSubmatchIndex(normalized); s != nil {
+		// Season packs such as "第二季" without episode
+		add(s)
+		result.Season = parseChineseNumber(normalized[s[2]:s[3]])
+	}
+	if episodeScore > 0 {
+		result.MediaType = "tv"
+	}
+
+	// Year: the last year before the release information. Earlier years are part of the title,
+	// as in "2012.2009.1080p" or "Blade.Runner.2049.2017.1080p".
+	var yearTag *tag
+	years := yearPattern.FindAllStringSubmatchIndex(normalized, -1)
+	var year []int
+	for _, m := range years {
+		if m[2] < releaseStart {
+			year = m
+		}
+	}
+	if year == nil && len(years) > 0 {
+		// Names with the year after the release information
+		year = years[0]
+	}
+	if year != nil && !(year[2] == 0 && len(tags) == 0) {
+		// A name that is only a year, e.g. "1917", has no year
+		result.Year = atoi(normalized[year[2]:year[3]])
+		yearTag = &tag{year[2], year[3]}
+		tags = append(tags, *yearTag)
+	}
+
+	// Parts of multi-part movies
+	if result.MediaType != "tv" {
+		if m := discPattern.FindStringSubmatchIndex(normalized); m != nil {
+			add(m)
+			result.Part = atoi(normalized[m[2]:m[3]])
+		} else if m := partPattern.FindStringSubmatchIndex(normalized); m != nil && yearTag != nil && m[0] > yearTag.start {
+			add(m)
+			result.Part = atoi(normalized[m[2]:m[3]])
+		}
+	}
+
+	// Title: the text before the first tag
+	end := len(normalized)
+	for _, t := range tags {
+		if t.start < end && t.start > 0 {
+			end = t.start
+		}
+	}
+	result.Title = cleanTitle(normalized[:end])
+	if result.Title == "" {
+		// Names like "[Group][Title][01][1080p]" keep the title in brackets
+		result.Title = bracketTitle(normalized)
+	}
+
+	if result.MediaType == "" && result.Year > 0 {
+		result.MediaType = "movie"
+	}
+
+	result.Confidence = confidence(result, episodeScore, len(tags) > 0)
+	return result
+}
+
+// endEpisode returns the last episode of a multi-episode tag such as "-E03" or "E02E03",
+// or 0 when the tag does not extend the first episode
+func endEpisode(episode int, extension string) int {
+	m := lastNumberPattern.FindString(extension)
+	if m == "" || isYear(m) {
+		return 0
+	}
+	if end := atoi(m); end > episode {
+		return end
+	}
+	return 0
+}
+
+// confidence estimates how reliable a parse result is
+func confidence(r *Result, episodeScore float64, hasTags bool) float64 {
+	if r.Title == "" {
+		return 0
+	}
+
+	score := 0.3
+	switch r.MediaType {
+	case "tv":
+		score += episodeScore
+		if r.Year > 0 {
+			score += 0.05
+		}
+	case "movie":
+		score += 0.4
+	default:
+		score += 0.1
+	}
+
+	// Scene-style release information indicates a machine-generated, well-formed name
+	if r.Resolution != "" || r.Source != "" || r.VideoCodec != "" {
+		score += 0.15
+	} else if hasTags {
+		score += 0.05
+	}
+
+	// Penalise titles that are unlikely to be correct
+	letters := 0
+	for _, c := range r.Title {
+		if unicode.IsLetter(c) {
+			letters++
+		}
+	}
+	if letters < 2 {
+		score -= 0.3
+	}
+	if strings.ContainsAny(r.Title, "[]【】()（）{}") {
+		score -= 0.2
+	}
+	if utf8.RuneCountInString(r.Title) > 80 {
+		score -= 0.2
+	}
+
+	score = math.Max(0, math.Min(1, score))
+	return math.Round(score*100) / 100
+}
+
+// normalize replaces word separators with spaces. Tokens such as "H.264" and
+// "DD5.1" become "H 264" and "DD5 1", which the tag patterns accept.
+func normalize(name string) string {
+	name = strings.NewReplacer(".", " ", "_", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// cleanTitle removes brackets and separators around a title
+func cleanTitle(title string) string {
+	title = bracketPattern.ReplaceAllString(title, " ")
+	title = strings.Join(strings.Fields(title), " ")
+	return strings.Trim(title, " -–—:|,[](){}【】（）")
+}
+
+// bracketTitle returns the first bracketed text that is not a tag or number
+func bracketTitle(name string) string {
+	for _, m := range bracketPattern.FindAllStringSubmatch(name, -1) {
+		text := strings.TrimSpace(m[1])
+		if text == "" || isNumber(text) || isTagText(text) || isYear(text) {
+			continue
+		}
+		if cnEpisodePattern.MatchString(text) || cnSeasonPattern.MatchString(text) {
+			continue
+		}
+		return cleanTitle(text)
+	}
+	return ""
+}
+
+// isTagText reports whether a text only consists of release tags such as "1080p" or "x264"
+func isTagText(text string) bool {
+	text = strings.TrimSpace(normalize(text))
+	if text == "" {
+		return false
+	}
+	for _, word := range strings.Fields(text) {
+		if !matchesWhole(resolutionPattern, word) && !matchesWhole(sourcePattern, word) &&
+			!matchesWhole(videoCodecPattern, word) && !matchesWhole(audioCodecPattern, word) &&
+			!matchesWhole(otherTagPattern, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesWhole reports whether a pattern matches the whole word
+func matchesWhole(pattern *regexp.Regexp, word string) bool {
+	loc := pattern.FindStringIndex(word)
+	return loc != nil && loc[0] == 0 && loc[1] == len(word)
+}
+
+func normalizeSource(source string) string {
+	s := strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(source, " ", ""), "-", ""))
+	switch {
+	case strings.Contains(s, "remux"):
+		return "Remux"
+	case strings.HasPrefix(s, "uhd"):
+		return "UHD BluRay"
+	case s == "bluray" || s == "bdrip" || s == "brrip":
+		return "BluRay"
+	case s == "webdl" || s == "web":
+		return "WEB-DL"
+	case s == "webrip":
+		return "WEBRip"
+	case s == "hdtv" || s == "pdtv":
+		return "HDTV"
+	case s == "dvdrip" || s == "dvd":
+		return "DVD"
+	case s == "hdrip":
+		return "HDRip"
+	default:
+		return strings.ToUpper(s)
+	}
+}
+
+func normalizeVideoCodec(codec string) string {
+	s := strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(codec, " ", ""), "-", ""))
+	switch s {
+	case "x264", "h264", "avc":
+		return "H.264"
+	case "x265", "h265", "hevc":
+		return "H.265"
+	case "av1":
+		return "AV1"
+	case "xvid":
+		return "XviD"
+	case "divx":
+		return "DivX"
+	case "vc1":
+		return "VC-1"
+	case "mpeg2":
+		return "MPEG-2"
+	default:
+		return codec
+	}
+}
+
+func normalizeAudioCodec(codec string) string {
+	s := strings.ToLower(strings.ReplaceAll(codec, "-", ""))
+	switch {
+	case strings.HasPrefix(s, "dtshd"):
+		return "DTS-HD"
+	case s == "dtsx":
+		return "DTS:X"
+	case s == "dts":
+		return "DTS"
+	case s == "truehd":
+		return "TrueHD"
+	case s == "atmos":
+		return "Atmos"
+	case s == "eac3" || strings.HasPrefix(s, "ddp") || s == "dd+":
+		return "E-AC-3"
+	case strings.HasPrefix(s, "dd") || s == "ac3":
+		return "AC-3"
+	case strings.HasPrefix(s, "aac"):
+		return "AAC"
+	default:
+		return strings.ToUpper(s)
+	}
+}
+
+// firstGroup returns the first non-empty submatch
+func firstGroup(s string, m []int) string {
+	for i := 2; i+1 < len(m); i += 2 {
+		if m[i] >= 0 {
+			return s[m[i]:m[i+1]]
+		}
+	}
+	return ""
+}
+
+var chineseDigits = map[rune]int{
+	'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4,
+	'五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+// parseChineseNumber parses Arabic or Chinese numerals such as "12", "十二" or "一百零五"
+func parseChineseNumber(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+
+	total, current := 0, 0
+	for _, r := range s {
+		switch r {
+		case '十':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 10
+			current = 0
+		case '百':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 100
+			current = 0
+		default:
+			if d, ok := chineseDigits[r]; ok {
+				current = d
+			} else if unicode.IsDigit(r) {
+				current = current*10 + int(r-'0')
+			}
+		}
+	}
+	return total + current
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isYear(s string) bool {
+	if len(s) != 4 || !isNumber(s) {
+		return false
+	}
+	year := atoi(s)
+	return year >= 1900 && year < 2100
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"testing"
+)
+
+// TestParse tests parsing of common filename styles
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		filename string
+		expected Result
+	}{
+		{
+			filename: "Movie.Name.2019.1080p.BluRay.x264-GRP.mkv",
+			expected: Result{Title: "Movie Name", Year: 2019, MediaType: "movie", Group: "GRP", Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"},
+		},
+		{
+			filename: "Spider-Man.No.Way.Home.2021.2160p.WEB-DL.DDP5.1.HDR.HEVC.mkv",
+			expected: Result{Title: "Spider-Man No Way Home", Year: 2021, MediaType: "movie", Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC-3"},
+		},
+		{
+			filename: "2012.2009.720p.BluRay.mkv",
+			expected: Result{Title: "2012", Year: 2009, MediaType: "movie", Resolution: "720p", Source: "BluRay"},
+		},
+		{
+			filename: "Blade.Runner.2049.2017.1080p.mkv",
+			expected: Result{Title: "Blade Runner 2049", Year: 2017, MediaType: "movie", Resolution: "1080p"},
+		},
+		{
+			filename: "1917.2019.1080p.mkv",
+			expected: Result{Title: "1917", Year: 2019, MediaType: "movie", Resolution: "1080p"},
+		},
+		{
+			filename: "The.Office.US.S02E05.720p.HDTV.x264.mkv",
+			expected: Result{Title: "The Office US", MediaType: "tv", Season: 2, Episode: 5, Resolution: "720p", Source: "HDTV", VideoCodec: "H.264"},
+		},
+		{
+			filename: "Doctor Who 2005 - 3x07 - 42.avi",
+			expected: Result{Title: "Doctor Who", Year: 2005, MediaType: "tv", Season: 3, Episode: 7},
+		},
+		{
+			filename: "[SubsPlease] Sousou no Frieren - 12 (1080p) [ABCDEF12].mkv",
+			expected: Result{Title: "Sousou no Frieren", MediaType: "tv", Season: 1, Episode: 12, AbsoluteEpisode: true, Group: "SubsPlease", Resolution: "1080p"},
+		},
+		{
+			filename: "Show.Name.S01E01-E02.1080p.WEB-DL.mkv",
+			expected: Result{Title: "Show Name", MediaType: "tv", Season: 1, Episode: 1, EndEpisode: 2, Resolution: "1080p", Source: "WEB-DL"},
+		},
+		{
+			filename: "Show.Name.S01E03E04.mkv",
+			expected: Result{Title: "Show Name", MediaType: "tv", Season: 1, Episode: 3, EndEpisode: 4},
+		},
+		{
+			filename: "Show.Name.S01E05-2019.mkv",
+			expected: Result{Title: "Show Name", Year: 2019, MediaType: "tv", Season: 1, Episode: 5},
+		},
+		{
+			filename: "Movie.Name.2001.DVDRip.XviD.CD2.avi",
+			expected: Result{Title: "Movie Name", Year: 2001, MediaType: "movie", Part: 2, Source: "DVD", VideoCodec: "XviD"},
+		},
+		{
+			filename: "Harry.Potter.and.the.Deathly.Hallows.Part.1.2010.1080p.mkv",
+			expected: Result{Title: "Harry Potter and the Deathly Hallows Part 1", Year: 2010, MediaType: "movie", Resolution: "1080p"},
+		},
+		{
+			filename: "Movie.Name.2001.1080p.Part2.mkv",
+			expected: Result{Title: "Movie Name", Year: 2001, MediaType: "movie", Part: 2, Resolution: "1080p"},
+		},
+		{
+			filename: "权力的游戏.第一季.第02集.mkv",
+			expected: Result{Title: "权力的游戏", MediaType: "tv", Season: 1, Episode: 2},
+		},
+		{
+			filename: "[字幕组][进击的巨人][第二季][第十二话][1080p].mp4",
+			expected: Result{Title: "进击的巨人", MediaType: "tv", Season: 2, Episode: 12, Group: "字幕组", Resolution: "1080p"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			result := Parse(tc.filename)
+			tc.expected.OriginalFilename = tc.filename
+			tc.expected.Confidence = result.Confidence
+			if *result != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *result)
+			}
+		})
+	}
+}
+
+// TestParseConfidence tests that clean names score higher than ambiguous ones
+func TestParseConfidence(t *testing.T) {
+	threshold := 0.8
+
+	confident := []string{
+		"Movie.Name.2019.1080p.BluRay.x264-GRP.mkv",
+		"Breaking.Bad.S01E02.720p.WEB-DL.mkv",
+	}
+	for _, filename := range confident {
+		if result := Parse(filename); result.Confidence < threshold {
+			t.Errorf("Expected confidence >= %.2f for %s, got %.2f", threshold, filename, result.Confidence)
+		}
+	}
+
+	uncertain := []string{
+		"movie.mkv",
+		"[SubsPlease] Sousou no Frieren - 12 (1080p).mkv",
+		"VID_0001.mp4",
+		"01.mkv",
+	}
+	for _, filename := range uncertain {
+		if result := Parse(filename); result.Confidence >= threshold {
+			t.Errorf("Expected confidence < %.2f for %s, got %.2f", threshold, filename, result.Confidence)
+		}
+	}
+}
+
+// TestParseChineseNumber tests Chinese numeral parsing
+func TestParseChineseNumber(t *testing.T) {
+	testCases := map[string]int{
+		"12":   12,
+		"一":    1,
+		"十":    10,
+		"十二":   12,
+		"二十":   20,
+		"二十三":  23,
+		"一百零五": 105,
+		"两":    2,
+	}
+
+	for input, expected := range testCases {
+		if result := parseChineseNumber(input); result != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, input, result)
+		}
+	}
+}
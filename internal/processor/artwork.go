@@ -0,0 +1,360 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// artwork represents a single image to download
+type artwork struct {
+	URL      string
+	Provider string // tmdb, tvdb, bangumi; used for rate limiting
+	Path     string
+}
+
+// downloadArtwork downloads the artwork set for a media file and returns the downloaded files.
+// Failed downloads are logged and do not abort the remaining downloads.
+func (p *Processor) downloadArtwork(ctx context.Context, mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, details *api.MediaDetails, showDir string) ([]string, error) {
+	if !p.config.FileOps.Artwork.Enabled {
+		return nil, nil
+	}
+
+	var artworks []artwork
+	switch mediaInfo.MediaType {
+	case "movie":
+		artworks = p.movieArtwork(ctx, mediaFile, mediaInfo, details)
+	case "tv":
+		if showDir == "" {
+			return nil, fmt.Errorf("TV show has no show directory")
+		}
+		artworks = p.tvArtwork(ctx, mediaFile, mediaInfo, details, showDir)
+	default:
+		return nil, fmt.Errorf("unknown media type: %s", mediaInfo.MediaType)
+	}
+
+	var downloaded []string
+	var failed int
+	for _, a := range artworks {
+		ok, err := p.downloadImage(ctx, a)
+		if err != nil {
+			failed++
+			log.Warn().Err(err).Str("url", a.URL).Str("path", a.Path).Msg("Failed to download artwork")
+			continue
+		}
+		if ok {
+			downloaded = append(downloaded, a.Path)
+		}
+	}
+
+	if failed > 0 {
+		return downloaded, fmt.Errorf("%d of %d artwork downloads failed", failed, len(artworks))
+	}
+	return downloaded, nil
+}
+
+// downloadImage downloads a single image, honouring the provider rate limit.
+// It reports whether the image was downloaded or already existed.
+func (p *Processor) downloadImage(ctx context.Context, a artwork) (bool, error) {
+	if p.apiClient.RateLimiter != nil {
+		if err := p.apiClient.RateLimiter.Wait(ctx, a.Provider); err != nil {
+			return false, fmt.Errorf("rate limiter error: %w", err)
+		}
+	}
+
+	downloaded, err := p.fileOps.DownloadImage(ctx, a.URL, a.Path)
+	if err != nil {
+		return false, err
+	}
+
+	log.Debug().Str("path", a.Path).Msg("Artwork downloaded")
+	return downloaded, nil
+}
+
+// movieArtwork collects the artwork of a movie: poster, backdrop and clearlogo
+func (p *Processor) movieArtwork(ctx context.Context, mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, details *api.MediaDetails) []artwork {
+	cfg := p.config.FileOps.Artwork
+	movieDir := filepath.Dir(mediaFile.DestinationPath)
+
+	var artworks []artwork
+	addTMDB := func(path, size, name string) {
+		if path != "" {
+			artworks = append(artworks, artwork{
+				URL:      p.apiClient.TMDB.GetImageURL(path, size),
+				Provider: "tmdb",
+				Path:     filepath.Join(movieDir, name),
+			})
+		}
+	}
+
+	posterPath := mediaInfo.PosterPath
+	backdropPath := mediaInfo.BackdropPath
+	var logoPath string
+
+	if mediaInfo.TMDBID > 0 {
+		images, err := p.apiClient.TMDB.GetMovieImages(ctx, int(mediaInfo.TMDBID))
+		if err != nil {
+			log.Warn().Err(err).Int64("tmdb_id", mediaInfo.TMDBID).Msg("Failed to fetch movie images from TMDB")
+		} else {
+			language := p.config.APIs.TMDB.Language
+			if posterPath == "" {
+				posterPath = selectImage(images.Posters, language, false)
+			}
+			if backdropPath == "" {
+				backdropPath = selectImage(images.Backdrops, language, true)
+			}
+			logoPath = selectImage(images.Logos, language, false)
+		}
+	}
+
+	addTMDB(posterPath, cfg.PosterSize, "poster.jpg")
+	addTMDB(backdropPath, cfg.BackdropSize, "backdrop.jpg")
+	addTMDB(logoPath, cfg.LogoSize, "clearlogo.png")
+
+	return artworks
+}
+
+// tvArtwork collects the artwork of a TV show in showDir, and of the episode next to it
+func (p *Processor) tvArtwork(ctx context.Context, mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, details *api.MediaDetails, showDir string) []artwork {
+	cfg := p.config.FileOps.Artwork
+	seasonDir := filepath.Dir(mediaFile.DestinationPath)
+
+	// Collected URLs per file name, the first provider to fill a slot wins
+	slots := []string{"poster.jpg", "backdrop.jpg", "background.jpg", "banner.jpg", "clearlogo.png", seasonPosterName(mediaInfo.Season), thumbNameFor(mediaFile.DestinationPath)}
+	found := make(map[string]artwork)
+	set := func(name, url, provider string) {
+		if url == "" {
+			return
+		}
+		if _, ok := found[name]; ok {
+			return
+		}
+		dir := showDir
+		if name == thumbNameFor(mediaFile.DestinationPath) {
+			dir = seasonDir
+		}
+		found[name] = artwork{URL: url, Provider: provider, Path: filepath.Join(dir, name)}
+	}
+
+	// TMDB
+	if mediaInfo.TMDBID > 0 {
+		tmdbURL := func(path, size string) string {
+			if path == "" {
+				return ""
+			}
+			return p.apiClient.TMDB.GetImageURL(path, size)
+		}
+
+		posterPath := mediaInfo.PosterPath
+		backdropPath := mediaInfo.BackdropPath
+		var logoPath string
+
+		images, err := p.apiClient.TMDB.GetTVImages(ctx, int(mediaInfo.TMDBID))
+		if err != nil {
+			log.Warn().Err(err).Int64("tmdb_id", mediaInfo.TMDBID).Msg("Failed to fetch TV images from TMDB")
+		} else {
+			language := p.config.APIs.TMDB.Language
+			if posterPath == "" {
+				posterPath = selectImage(images.Posters, language, false)
+			}
+			if backdropPath == "" {
+				backdropPath = selectImage(images.Backdrops, language, true)
+			}
+			logoPath = selectImage(images.Logos, language, false)
+		}
+
+		set("poster.jpg", tmdbURL(posterPath, cfg.PosterSize), "tmdb")
+		set("backdrop.jpg", tmdbURL(backdropPath, cfg.BackdropSize), "tmdb")
+		set("background.jpg", tmdbURL(backdropPath, cfg.BackdropSize), "tmdb")
+		set("clearlogo.png", tmdbURL(logoPath, cfg.LogoSize), "tmdb")
+
+		if details != nil && details.Season != nil {
+			set(seasonPosterName(mediaInfo.Season), tmdbURL(details.Season.PosterPath, cfg.PosterSize), "tmdb")
+			for _, episode := range details.Season.Episodes {
+				if episode.EpisodeNumber == mediaInfo.Episode {
+					set(thumbNameFor(mediaFile.DestinationPath), tmdbURL(episode.StillPath, cfg.StillSize), "tmdb")
+					break
+				}
+			}
+		}
+	}
+
+	// TVDB, also used to fill slots TMDB has no images for, such as banners
+	if mediaInfo.TVDBID > 0 {
+		if details != nil && details.TVDBSeries != nil {
+			series := details.TVDBSeries
+			set("poster.jpg", series.PosterURL, "tvdb")
+			set("backdrop.jpg", series.BackdropURL, "tvdb")
+			set("background.jpg", series.BackdropURL, "tvdb")
+			for _, season := range series.Seasons {
+				if season.Number == mediaInfo.Season {
+					set(seasonPosterName(mediaInfo.Season), season.PosterURL, "tvdb")
+					break
+				}
+			}
+		}
+
+		if details != nil && details.TVDBSeason != nil {
+			for _, episode := range details.TVDBSeason.Episodes {
+				if episode.EpisodeNumber == mediaInfo.Episode && episode.SeasonNumber == mediaInfo.Season {
+					set(thumbNameFor(mediaFile.DestinationPath), episode.ImageURL, "tvdb")
+					break
+				}
+			}
+		}
+
+		if needsAny(found, "poster.jpg", "backdrop.jpg", "background.jpg", "banner.jpg", "clearlogo.png") {
+			artworks, err := p.apiClient.TVDB.GetSeriesArtworks(ctx, int(mediaInfo.TVDBID))
+			if err != nil {
+				log.Warn().Err(err).Int64("tvdb_id", mediaInfo.TVDBID).Msg("Failed to fetch series artworks from TVDB")
+			} else {
+				language := p.config.APIs.TVDB.Language
+				set("poster.jpg", selectTVDBArtwork(artworks.Artworks, api.TVDBArtworkPoster, language), "tvdb")
+				set("backdrop.jpg", selectTVDBArtwork(artworks.Artworks, api.TVDBArtworkBackground, language), "tvdb")
+				set("background.jpg", selectTVDBArtwork(artworks.Artworks, api.TVDBArtworkBackground, language), "tvdb")
+				set("banner.jpg", selectTVDBArtwork(artworks.Artworks, api.TVDBArtworkBanner, language), "tvdb")
+				set("clearlogo.png", selectTVDBArtwork(artworks.Artworks, api.TVDBArtworkClearLogo, language), "tvdb")
+			}
+		}
+	}
+
+	// Bangumi only provides a cover image
+	if details != nil && details.Bangumi != nil {
+		set("poster.jpg", details.Bangumi.ImageURL, "bangumi")
+	}
+
+	artworks := make([]artwork, 0, len(found))
+	for _, name := range slots {
+		if a, ok := found[name]; ok {
+			artworks = append(artworks, a)
+		}
+	}
+	return artworks
+}
+
+// needsAny reports whether any of the named slots is still empty
+func needsAny(found map[string]artwork, names ...string) bool {
+	for _, name := range names {
+		if _, ok := found[name]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// seasonPosterName returns the Emby/Jellyfin/Kodi file name of a season poster
+func seasonPosterName(season int) string {
+	if season == 0 {
+		return "season-specials-poster.jpg"
+	}
+	return fmt.Sprintf("season%02d-poster.jpg", season)
+}
+
+// thumbNameFor returns the thumbnail file name that belongs to an episode file
+func thumbNameFor(videoPath string) string {
+	base := filepath.Base(videoPath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-thumb.jpg"
+}
+
+// selectImage picks the best TMDB image. Images in the preferred language come first,
+// then English and then images without text; textless images are preferred for backdrops.
+// Within the same language the highest voted image wins.
+func selectImage(images []api.Image, language string, preferTextless bool) string {
+	if len(images) == 0 {
+		return ""
+	}
+
+	rank := imageLanguageRank(language, preferTextless)
+	sorted := make([]api.Image, len(images))
+	copy(sorted, images)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i].Language), rank(sorted[j].Language)
+		if ri != rj {
+			return ri < rj
+		}
+		return sorted[i].VoteAverage > sorted[j].VoteAverage
+	})
+
+	return sorted[0].FilePath
+}
+
+// selectTVDBArtwork picks the best TVDB artwork of a type, preferring the configured language
+func selectTVDBArtwork(artworks []api.TVDBArtwork, artworkType int, language string) string {
+	var candidates []api.TVDBArtwork
+	for _, a := range artworks {
+		if a.Type == artworkType && a.ImageURL != "" {
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	rank := imageLanguageRank(language, false)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := rank(candidates[i].Language), rank(candidates[j].Language)
+		if ri != rj {
+			return ri < rj
+		}
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	return candidates[0].ImageURL
+}
+
+// imageLanguageRank returns a function ranking image languages, lower is better.
+// Both ISO 639-1 (TMDB) and ISO 639-2 (TVDB) codes are accepted.
+func imageLanguageRank(language string, preferTextless bool) func(string) int {
+	preferred := normalizeImageLanguage(language)
+	return func(lang string) int {
+		lang = normalizeImageLanguage(lang)
+		switch {
+		case lang == "" && preferTextless:
+			return 0
+		case lang == preferred && preferred != "":
+			return 1
+		case lang == "en":
+			return 2
+		case lang == "":
+			return 3
+		default:
+			return 4
+		}
+	}
+}
+
+// normalizeImageLanguage reduces a language code such as "zh-CN", "zho" or "eng" to ISO 639-1
+func normalizeImageLanguage(language string) string {
+	language = strings.ToLower(language)
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+
+	switch language {
+	case "null", "":
+		return ""
+	case "eng":
+		return "en"
+	case "zho", "chi":
+		return "zh"
+	case "jpn":
+		return "ja"
+	case "kor":
+		return "ko"
+	case "fra", "fre":
+		return "fr"
+	case "deu", "ger":
+		return "de"
+	case "spa":
+		return "es"
+	case "rus":
+		return "ru"
+	}
+	return language
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/api"
+)
+
+// TestSelectImage tests the language preference of the TMDB image selection
+func TestSelectImage(t *testing.T) {
+	images := []api.Image{
+		{FilePath: "/en.jpg", Language: "en", VoteAverage: 5.0},
+		{FilePath: "/none.jpg", Language: "", VoteAverage: 4.0},
+		{FilePath: "/zh-low.jpg", Language: "zh", VoteAverage: 1.0},
+		{FilePath: "/zh-high.jpg", Language: "zh", VoteAverage: 3.0},
+		{FilePath: "/fr.jpg", Language: "fr", VoteAverage: 9.0},
+	}
+
+	testCases := []struct {
+		name           string
+		language       string
+		preferTextless bool
+		expected       string
+	}{
+		{"Preferred language", "zh-CN", false, "/zh-high.jpg"},
+		{"English fallback", "de-DE", false, "/en.jpg"},
+		{"Textless backdrop", "zh-CN", true, "/none.jpg"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := selectImage(images, tc.language, tc.preferTextless)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	if result := selectImage(nil, "en", false); result != "" {
+		t.Errorf("Expected empty path for no images, got %s", result)
+	}
+}
+
+// TestSelectTVDBArtwork tests the TVDB artwork selection
+func TestSelectTVDBArtwork(t *testing.T) {
+	artworks := []api.TVDBArtwork{
+		{ImageURL: "https://example.com/poster-eng.jpg", Type: api.TVDBArtworkPoster, Language: "eng", Score: 10},
+		{ImageURL: "https://example.com/poster-zho.jpg", Type: api.TVDBArtworkPoster, Language: "zho", Score: 1},
+		{ImageURL: "https://example.com/banner.jpg", Type: api.TVDBArtworkBanner, Language: "eng", Score: 5},
+	}
+
+	if result := selectTVDBArtwork(artworks, api.TVDBArtworkPoster, "zh-CN"); result != "https://example.com/poster-zho.jpg" {
+		t.Errorf("Expected Chinese poster, got %s", result)
+	}
+	if result := selectTVDBArtwork(artworks, api.TVDBArtworkBanner, "zh-CN"); result != "https://example.com/banner.jpg" {
+		t.Errorf("Expected banner, got %s", result)
+	}
+	if result := selectTVDBArtwork(artworks, api.TVDBArtworkClearLogo, "zh-CN"); result != "" {
+		t.Errorf("Expected no clearlogo, got %s", result)
+	}
+}
+
+// TestArtworkNames tests the season poster and episode thumbnail names
+func TestArtworkNames(t *testing.T) {
+	if name := seasonPosterName(1); name != "season01-poster.jpg" {
+		t.Errorf("Expected season01-poster.jpg, got %s", name)
+	}
+	if name := seasonPosterName(0); name != "season-specials-poster.jpg" {
+		t.Errorf("Expected season-specials-poster.jpg, got %s", name)
+	}
+	if name := thumbNameFor("/tv/Show/Season 1/Show - S01E02.mkv"); name != "Show - S01E02-thumb.jpg" {
+		t.Errorf("Expected Show - S01E02-thumb.jpg, got %s", name)
+	}
+}
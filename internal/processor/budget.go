@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// budgetWindow is the calendar period an LLM budget applies to
+type budgetWindow struct {
+	name       string
+	start, end time.Time
+	tokens     int64
+	cost       float64
+}
+
+// budgetWindows returns the windows of the configured budgets at a point in time
+func budgetWindows(budget config.LLMBudgetConfig, now time.Time) []budgetWindow {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	var windows []budgetWindow
+	if budget.DailyTokens > 0 || budget.DailyCost > 0 {
+		windows = append(windows, budgetWindow{"daily", day, day.AddDate(0, 0, 1), budget.DailyTokens, budget.DailyCost})
+	}
+	if budget.MonthlyTokens > 0 || budget.MonthlyCost > 0 {
+		windows = append(windows, budgetWindow{"monthly", month, month.AddDate(0, 1, 0), budget.MonthlyTokens, budget.MonthlyCost})
+	}
+	return windows
+}
+
+// exhausted describes how the budget of the window is used up by the tokens and cost spent,
+// or returns an empty string while it is not
+func (w budgetWindow) exhausted(tokens int64, cost float64) string {
+	switch {
+	case w.tokens > 0 && tokens >= w.tokens:
+		return fmt.Sprintf("%s token budget of %d is used up (%d tokens)", w.name, w.tokens, tokens)
+	case w.cost > 0 && cost >= w.cost:
+		return fmt.Sprintf("%s cost budget of %.2f is used up (%.2f)", w.name, w.cost, cost)
+	default:
+		return ""
+	}
+}
+
+// LLMDeferredUntil returns when the exhausted LLM budget resets, or the zero time while
+// the budgets allow requests. An alert is raised when a budget runs out.
+func (p *Processor) LLMDeferredUntil() time.Time {
+	windows := budgetWindows(p.config.LLM.Budget, time.Now())
+	if len(windows) == 0 {
+		return time.Time{}
+	}
+
+	p.budgetMu.Lock()
+	defer p.budgetMu.Unlock()
+	if time.Now().Before(p.deferredUntil) {
+		return p.deferredUntil
+	}
+
+	var reasons []string
+	var until time.Time
+	for _, window := range windows {
+		tokens, cost, err := p.db.GetLLMSpendSince(window.start)
+		if err != nil {
+			log.Error().Err(err).Str("budget", window.name).Msg("Failed to get LLM spending")
+			continue
+		}
+		if reason := window.exhausted(tokens, cost); reason != "" {
+			reasons = append(reasons, reason)
+			if window.end.After(until) {
+				until = window.end
+			}
+		}
+	}
+	if until.IsZero() {
+		return until
+	}
+
+	p.deferredUntil = until
+	p.alertBudget(reasons, until)
+	return until
+}
+
+// budgetError returns an error while the LLM budget is exhausted
+func (p *Processor) budgetError() error {
+	if until := p.LLMDeferredUntil(); !until.IsZero() {
+		return fmt.Errorf("LLM budget exhausted until %s", until.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// TakeDeferred returns the IDs of the media files deferred for the LLM budget once it allows
+// requests again, and nil until then. Each ID is returned once.
+func (p *Processor) TakeDeferred() []int64 {
+	p.budgetMu.Lock()
+	none := len(p.deferred) == 0
+	p.budgetMu.Unlock()
+	if none || !p.LLMDeferredUntil().IsZero() {
+		return nil
+	}
+
+	p.budgetMu.Lock()
+	defer p.budgetMu.Unlock()
+	deferred := make([]int64, 0, len(p.deferred))
+	for id := range p.deferred {
+		deferred = append(deferred, id)
+	}
+	p.deferred = nil
+	return deferred
+}
+
+// deferFile returns a claimed media file to pending until the LLM budget resets. A file
+// deferred again, as happens on every tick without a worker pool, is remembered once.
+func (p *Processor) deferFile(mediaFile *models.MediaFile, until time.Time) error {
+	mediaFile.Status = "pending"
+	mediaFile.LeaseOwner = ""
+	mediaFile.UpdatedAt = time.Now()
+	if err := p.db.UpdateMediaFile(mediaFile); err != nil {
+		return fmt.Errorf("error updating media file status: %w", err)
+	}
+
+	p.budgetMu.Lock()
+	if p.deferred == nil {
+		p.deferred = make(map[int64]bool)
+	}
+	p.deferred[mediaFile.ID] = true
+	p.budgetMu.Unlock()
+	log.Info().Str("file", mediaFile.OriginalPath).Time("until", until).Msg("LLM budget exhausted, media file deferred")
+	return nil
+}
+
+// deferBatch releases a claimed batch process until the LLM budget resets. Released batches
+// are resumed by the recovery.
+func (p *Processor) deferBatch(batchProcess *models.BatchProcess, until time.Time) error {
+	if err := p.ReleaseBatch(batchProcess); err != nil {
+		return fmt.Errorf("error releasing batch process: %w", err)
+	}
+	log.Info().Int64("batch_id", batchProcess.ID).Time("until", until).Msg("LLM budget exhausted, batch deferred")
+	return nil
+}
+
+// alertBudget reports an exhausted LLM budget in the log and as a needs-attention notification
+func (p *Processor) alertBudget(reasons []string, until time.Time) {
+	log.Warn().Strs("budgets", reasons).Time("until", until).Msg("LLM budget exhausted, deferring work")
+	if !p.config.Notification.Enabled {
+		return
+	}
+
+	notification := &models.Notification{
+		Type: "attention",
+		Message: fmt.Sprintf("LLM budget exhausted: %s\nFiles needing the LLM are deferred until %s.",
+			strings.Join(reasons, "; "), until.Format("2006-01-02 15:04")),
+		CreatedAt: time.Now(),
+	}
+	if err := p.db.CreateNotification(notification); err != nil {
+		log.Error().Err(err).Msg("Failed to create budget notification")
+	}
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/database/dbtest"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestBudgetWindows tests the calendar windows of the LLM budgets
+func TestBudgetWindows(t *testing.T) {
+	now := time.Date(2024, 12, 31, 18, 30, 0, 0, time.Local)
+
+	if windows := budgetWindows(config.LLMBudgetConfig{}, now); len(windows) != 0 {
+		t.Errorf("budgetWindows() without budgets = %v, expected none", windows)
+	}
+
+	windows := budgetWindows(config.LLMBudgetConfig{DailyCost: 1, MonthlyTokens: 1000000}, now)
+	if len(windows) != 2 {
+		t.Fatalf("budgetWindows() returned %d windows, expected 2", len(windows))
+	}
+	expected := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"daily", time.Date(2024, 12, 31, 0, 0, 0, 0, time.Local), time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"monthly", time.Date(2024, 12, 1, 0, 0, 0, 0, time.Local), time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)},
+	}
+	for i, e := range expected {
+		w := windows[i]
+		if w.name != e.name || !w.start.Equal(e.start) || !w.end.Equal(e.end) {
+			t.Errorf("window %d = %s %v-%v, expected %s %v-%v", i, w.name, w.start, w.end, e.name, e.start, e.end)
+		}
+	}
+}
+
+// TestBudgetExhausted tests when the tokens and cost spent use up a budget
+func TestBudgetExhausted(t *testing.T) {
+	tests := []struct {
+		window    budgetWindow
+		tokens    int64
+		cost      float64
+		exhausted bool
+	}{
+		{budgetWindow{name: "daily", tokens: 1000}, 999, 100, false},
+		{budgetWindow{name: "daily", tokens: 1000}, 1000, 0, true},
+		{budgetWindow{name: "daily", cost: 5}, 1000000, 4.99, false},
+		{budgetWindow{name: "daily", cost: 5}, 0, 5.01, true},
+		{budgetWindow{name: "monthly", tokens: 1000, cost: 5}, 10, 6, true},
+	}
+
+	for _, test := range tests {
+		reason := test.window.exhausted(test.tokens, test.cost)
+		if (reason != "") != test.exhausted {
+			t.Errorf("exhausted(%d, %.2f) for %+v = %q, expected exhausted %v", test.tokens, test.cost, test.window, reason, test.exhausted)
+		}
+	}
+}
+
+// TestDeferFile tests that a file deferred on every tick is taken back once
+func TestDeferFile(t *testing.T) {
+	db := dbtest.New(t, nil)
+	p := &Processor{config: config.DefaultConfig(), db: db.Database}
+
+	until := time.Now().Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := p.deferFile(&models.MediaFile{ID: 1}, until); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.deferFile(&models.MediaFile{ID: 2}, until); err != nil {
+		t.Fatal(err)
+	}
+
+	if deferred := p.TakeDeferred(); len(deferred) != 2 {
+		t.Errorf("TakeDeferred() = %v, expected each file once", deferred)
+	}
+	if deferred := p.TakeDeferred(); deferred != nil {
+		t.Errorf("TakeDeferred() = %v after the files were taken, expected nil", deferred)
+	}
+}
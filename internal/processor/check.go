@@ -0,0 +1,326 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/parser"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+// Kinds of issues found by Check
+const (
+	IssueMissingSource      = "missing-source"      // a file that was not organised is gone
+	IssueMissingDestination = "missing-destination" // an organised file is gone from the library
+	IssueBrokenSymlink      = "broken-symlink"      // a library symlink points nowhere
+	IssueUntracked          = "untracked"           // a library video has no record
+	IssueStaleProcessing    = "stale-processing"    // a file is processing without a live worker
+)
+
+// CheckOptions controls a library check
+type CheckOptions struct {
+	Repair bool
+
+	// Files processing without a lease and without an update for this long are considered abandoned
+	StaleAfter time.Duration
+}
+
+// Issue is a disagreement between the database and the filesystem
+type Issue struct {
+	Kind      string
+	Path      string
+	MediaFile *models.MediaFile // nil for library files without a record
+	Detail    string
+	Repair    string // what was done to repair the issue, empty if nothing was done
+	Err       error  // why the repair failed
+}
+
+// Check compares the media file records with the media and library directories and
+// reports the issues found, repairing them if requested: gone files are retired, abandoned
+// and lost files are queued again, broken symlinks are relinked to the file they lost and
+// untracked library files are imported.
+func (p *Processor) Check(opts CheckOptions) ([]Issue, error) {
+	mediaFiles, err := p.db.GetMediaFiles()
+	if err != nil {
+		return nil, fmt.Errorf("error getting media files: %w", err)
+	}
+
+	c := &checker{p: p, opts: opts, byDestination: make(map[string]*models.MediaFile)}
+	for i := range mediaFiles {
+		mediaFile := &mediaFiles[i]
+		if mediaFile.DestinationPath != "" && (mediaFile.Status == "success" || mediaFile.Status == "broken") {
+			c.byDestination[mediaFile.DestinationPath] = mediaFile
+		}
+	}
+
+	for i := range mediaFiles {
+		c.checkMediaFile(&mediaFiles[i])
+	}
+	if root := p.config.FileOps.DestinationRoot; root != "" {
+		if err := c.checkLibrary(root); err != nil {
+			return c.issues, fmt.Errorf("error checking library: %w", err)
+		}
+	}
+	return c.issues, nil
+}
+
+// checker holds the state of a single Check run
+type checker struct {
+	p             *Processor
+	opts          CheckOptions
+	byDestination map[string]*models.MediaFile
+	issues        []Issue
+
+	// Files in the media directories by name, built when the first broken symlink is found
+	sources map[string][]string
+}
+
+// checkMediaFile checks the paths of a media file record
+func (c *checker) checkMediaFile(mediaFile *models.MediaFile) {
+	switch mediaFile.Status {
+	case "pending", "failed", "manual", "skipped", "processing":
+		if !exists(mediaFile.OriginalPath) {
+			issue := Issue{Kind: IssueMissingSource, Path: mediaFile.OriginalPath, MediaFile: mediaFile, Detail: "source file is gone"}
+			if c.opts.Repair {
+				issue.Repair, issue.Err = "retired", c.updateMediaFile(mediaFile, "missing", "Source file is gone")
+			}
+			c.issues = append(c.issues, issue)
+			return
+		}
+		if mediaFile.Status == "processing" && c.abandoned(mediaFile) {
+			issue := Issue{
+				Kind:      IssueStaleProcessing,
+				Path:      mediaFile.OriginalPath,
+				MediaFile: mediaFile,
+				Detail:    fmt.Sprintf("processing since %s", mediaFile.UpdatedAt.Format(time.RFC3339)),
+			}
+			if c.opts.Repair {
+				mediaFile.LeaseOwner = ""
+				issue.Repair, issue.Err = "re-queued", c.updateMediaFile(mediaFile, "pending", "")
+			}
+			c.issues = append(c.issues, issue)
+		}
+	case "success":
+		if exists(mediaFile.DestinationPath) || isSymlink(mediaFile.DestinationPath) {
+			// Broken symlinks are found with the library
+			return
+		}
+		issue := Issue{Kind: IssueMissingDestination, Path: mediaFile.DestinationPath, MediaFile: mediaFile, Detail: "organised file is gone"}
+		if c.opts.Repair {
+			if exists(mediaFile.OriginalPath) {
+				mediaFile.DestinationPath = ""
+				issue.Repair, issue.Err = "re-queued", c.updateMediaFile(mediaFile, "pending", "")
+			} else {
+				issue.Repair, issue.Err = "flagged as broken", c.updateMediaFile(mediaFile, "broken", "Organised file and source file are gone")
+			}
+		}
+		c.issues = append(c.issues, issue)
+	}
+}
+
+// abandoned reports whether a processing media file has no live worker: its lease expired, or
+// for files claimed without a lease it has not been updated for the stale duration
+func (c *checker) abandoned(mediaFile *models.MediaFile) bool {
+	if mediaFile.LeaseOwner != "" {
+		return time.Now().After(mediaFile.LeaseExpiresAt)
+	}
+	return c.opts.StaleAfter > 0 && time.Since(mediaFile.UpdatedAt) > c.opts.StaleAfter
+}
+
+// checkLibrary looks for broken symlinks and untracked videos in the library
+func (c *checker) checkLibrary(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != root {
+			// Hidden files are replaced files and interrupted copies
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case d.IsDir():
+			if path != root && scanner.IsDiscRoot(path) {
+				c.checkLibraryFile(path)
+				return filepath.SkipDir
+			}
+		case d.Type()&os.ModeSymlink != 0:
+			if !exists(path) {
+				c.checkBrokenSymlink(path)
+			} else if c.p.isVideo(path) {
+				c.checkLibraryFile(path)
+			}
+		case d.Type().IsRegular():
+			if c.p.isVideo(path) {
+				c.checkLibraryFile(path)
+			}
+		}
+		return nil
+	})
+}
+
+// checkLibraryFile reports a library video or disc without a media file record
+func (c *checker) checkLibraryFile(path string) {
+	if c.byDestination[path] != nil {
+		return
+	}
+
+	issue := Issue{Kind: IssueUntracked, Path: path, Detail: "no record"}
+	if c.opts.Repair {
+		issue.Repair, issue.Err = "imported", c.importFile(path)
+	}
+	c.issues = append(c.issues, issue)
+}
+
+// importFile records a library file as organised
+func (c *checker) importFile(path string) error {
+	size, err := pathSize(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	mediaFile := &models.MediaFile{
+		OriginalPath:    path,
+		OriginalName:    filepath.Base(path),
+		DestinationPath: path,
+		FileSize:        size,
+		MediaType:       parser.Parse(filepath.Base(path)).MediaType,
+		Status:          "success",
+		ErrorMessage:    "Imported from the library",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ProcessedAt:     now,
+	}
+	if err := c.p.db.CreateMediaFile(mediaFile); err != nil {
+		return fmt.Errorf("error creating media file record: %w", err)
+	}
+	c.byDestination[path] = mediaFile
+	return nil
+}
+
+// checkBrokenSymlink reports a library symlink whose target is gone
+func (c *checker) checkBrokenSymlink(path string) {
+	target, _ := os.Readlink(path)
+
+	// Disc entries are linked one by one, the record names the disc folder
+	owner := c.byDestination[path]
+	if owner == nil {
+		owner = c.byDestination[filepath.Dir(path)]
+	}
+
+	issue := Issue{Kind: IssueBrokenSymlink, Path: path, MediaFile: owner, Detail: fmt.Sprintf("target %s is gone", target)}
+	if c.opts.Repair {
+		issue.Repair, issue.Err = c.relinkSymlink(path, target, owner)
+	}
+	c.issues = append(c.issues, issue)
+}
+
+// relinkSymlink points a broken symlink at the file its target was renamed to. The file is
+// looked up by name in the media directories and must be the only one of that name, and of
+// the recorded size for the file of a record.
+func (c *checker) relinkSymlink(path, target string, owner *models.MediaFile) (string, error) {
+	var candidates []string
+	for _, candidate := range c.sourcesNamed(filepath.Base(target)) {
+		if owner != nil && owner.DestinationPath == path {
+			if info, err := os.Stat(candidate); err != nil || info.Size() != owner.FileSize {
+				continue
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) != 1 {
+		return "", fmt.Errorf("%d candidate files named %s", len(candidates), filepath.Base(target))
+	}
+
+	if err := fileops.Relink(path, candidates[0]); err != nil {
+		return "", err
+	}
+	repair := fmt.Sprintf("relinked to %s", candidates[0])
+
+	// Keep the record pointing at the source, for the main file only
+	if owner != nil && owner.DestinationPath == path {
+		owner.OriginalPath = candidates[0]
+		owner.OriginalName = scanner.MediaName(candidates[0], c.p.config.Scanner.MediaDirs)
+		if err := c.updateMediaFile(owner, "success", ""); err != nil {
+			return repair, err
+		}
+	}
+	return repair, nil
+}
+
+// sourcesNamed returns the files in the media directories with the given name
+func (c *checker) sourcesNamed(name string) []string {
+	if c.sources == nil {
+		c.sources = make(map[string][]string)
+		for _, mediaDir := range c.p.config.Scanner.MediaDirs {
+			_ = filepath.WalkDir(mediaDir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && path != mediaDir {
+					c.sources[d.Name()] = append(c.sources[d.Name()], path)
+				}
+				return nil
+			})
+		}
+	}
+	return c.sources[name]
+}
+
+// updateMediaFile sets the status of a media file record
+func (c *checker) updateMediaFile(mediaFile *models.MediaFile, status, message string) error {
+	mediaFile.Status = status
+	mediaFile.ErrorMessage = message
+	mediaFile.UpdatedAt = time.Now()
+	if err := c.p.db.UpdateMediaFile(mediaFile); err != nil {
+		return fmt.Errorf("error updating media file record: %w", err)
+	}
+	return nil
+}
+
+// exists reports whether a path exists, following symlinks
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// isSymlink reports whether a path is a symlink
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// pathSize returns the size of a file, or of all files in a directory
+func pathSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	var size int64
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestCheckLibrary tests finding broken symlinks and untracked videos in the library
+func TestCheckLibrary(t *testing.T) {
+	root := t.TempDir()
+	library := filepath.Join(root, "library")
+	files := []string{
+		"Movies/Tracked (2020)/Tracked (2020).mkv",
+		"Movies/Untracked (2021)/Untracked (2021).mkv",
+		"Movies/Untracked (2021)/movie.nfo",
+		"Movies/Disc (2019)/BDMV/index.bdmv",
+		"Movies/.Replaced (2018).mkv",
+		"source/Linked.mkv",
+	}
+	for _, name := range files {
+		path := filepath.Join(library, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	linked := filepath.Join(library, "Movies/Linked (2022).mkv")
+	broken := filepath.Join(library, "Movies/Broken (2023).mkv")
+	if err := os.Symlink(filepath.Join(library, "source/Linked.mkv"), linked); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "gone.mkv"), broken); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	tracked := filepath.Join(library, "Movies/Tracked (2020)/Tracked (2020).mkv")
+	c := &checker{
+		p: &Processor{config: cfg},
+		byDestination: map[string]*models.MediaFile{
+			tracked: {DestinationPath: tracked, Status: "success"},
+			linked:  {DestinationPath: linked, Status: "success"},
+		},
+	}
+	if err := c.checkLibrary(library); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		filepath.Join(library, "Movies/Untracked (2021)/Untracked (2021).mkv"): IssueUntracked,
+		filepath.Join(library, "Movies/Disc (2019)"):                           IssueUntracked,
+		filepath.Join(library, "source/Linked.mkv"):                            IssueUntracked,
+		broken: IssueBrokenSymlink,
+	}
+	for _, issue := range c.issues {
+		if expected[issue.Path] != issue.Kind {
+			t.Errorf("unexpected %s issue for %s", issue.Kind, issue.Path)
+		}
+		delete(expected, issue.Path)
+	}
+	for path, kind := range expected {
+		t.Errorf("missing %s issue for %s", kind, path)
+	}
+}
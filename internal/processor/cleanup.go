@@ -0,0 +1,226 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+// cleanupSource cleans up the download directory a media file was moved out of, once every
+// media file in it has been organised. Junk files are deleted, then the directories left
+// empty. Only directories inside a media directory are cleaned, the media directory stays.
+func (p *Processor) cleanupSource(mediaFile *models.MediaFile, result *fileops.Result) {
+	if !p.config.FileOps.Cleanup.Enabled || result.Mode != "move" {
+		return
+	}
+
+	downloadDir := downloadDirOf(mediaFile.OriginalPath, result.Entries != nil, p.config.Scanner.MediaDirs)
+	if downloadDir == "" {
+		return
+	}
+
+	// Files of the same download finish concurrently, clean up once
+	p.cleanupMu.Lock()
+	defer p.cleanupMu.Unlock()
+
+	junk := compilePatterns(p.config.FileOps.Cleanup.JunkPatterns)
+	if reason := p.downloadPending(downloadDir, junk); reason != "" {
+		log.Debug().Str("directory", downloadDir).Str("reason", reason).Msg("Download directory is not cleaned up yet")
+		return
+	}
+
+	deleted, err := cleanupDir(downloadDir, junk)
+	if err != nil {
+		log.Warn().Err(err).Str("directory", downloadDir).Msg("Failed to clean up download directory")
+	}
+	if len(deleted) == 0 {
+		return
+	}
+
+	for _, path := range deleted {
+		log.Info().Str("path", path).Msg("Deleted from download directory")
+	}
+	if err := writeDeletionLog(p.config.FileOps.Cleanup.LogFile, deleted); err != nil {
+		log.Warn().Err(err).Str("file", p.config.FileOps.Cleanup.LogFile).Msg("Failed to write cleanup log")
+	}
+	log.Info().Str("directory", downloadDir).Int("count", len(deleted)).Msg("Download directory cleaned up")
+}
+
+// downloadDirOf returns the download directory of a media file: the directory directly inside
+// a media directory that holds it, or the disc folder itself. Files lying directly in a media
+// directory have none and an empty string is returned.
+func downloadDirOf(path string, isDir bool, mediaDirs []string) string {
+	for _, mediaDir := range mediaDirs {
+		mediaDir = filepath.Clean(mediaDir)
+		rel, err := filepath.Rel(mediaDir, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		parts := strings.Split(rel, string(filepath.Separator))
+		if len(parts) == 1 && !isDir {
+			return ""
+		}
+		return filepath.Join(mediaDir, parts[0])
+	}
+	return ""
+}
+
+// downloadPending returns why a download directory cannot be cleaned up yet, or an empty
+// string when all of its media files have been organised
+func (p *Processor) downloadPending(dir string, junk []*regexp.Regexp) string {
+	mediaFiles, err := p.db.GetMediaFilesByDirectory(dir)
+	if err != nil {
+		return fmt.Sprintf("error getting media files: %v", err)
+	}
+	for _, mediaFile := range mediaFiles {
+		if mediaFile.OriginalPath != dir && !strings.HasPrefix(mediaFile.OriginalPath, dir+string(filepath.Separator)) {
+			continue
+		}
+		switch mediaFile.Status {
+		case "success", "replaced", "missing":
+		default:
+			return fmt.Sprintf("%s is %s", mediaFile.OriginalName, mediaFile.Status)
+		}
+	}
+
+	// Videos that have not been picked up yet may still be downloading
+	excluded := compilePatterns(p.config.Scanner.ExcludePatterns)
+	reason := ""
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		if d.IsDir() {
+			if scanner.IsDiscRoot(path) {
+				reason = fmt.Sprintf("%s holds a disc", path)
+				return filepath.SkipAll
+			}
+			return nil
+		}
+		if !p.isVideo(path) || matchesAny(excluded, d.Name()) || matchesAny(junk, relSlash(dir, path)) {
+			return nil
+		}
+		reason = fmt.Sprintf("%s has not been organised", path)
+		return filepath.SkipAll
+	})
+	return reason
+}
+
+// isVideo reports whether a file is a video file or a disc image
+func (p *Processor) isVideo(path string) bool {
+	if scanner.IsDiscImage(path) {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, videoExt := range p.config.Scanner.VideoExtensions {
+		if ext == strings.ToLower(videoExt) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupDir deletes the files of a directory tree matching a junk pattern, then the
+// directories left empty including the directory itself, and returns the deleted paths
+func cleanupDir(dir string, junk []*regexp.Regexp) ([]string, error) {
+	var deleted []string
+	var dirs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if !matchesAny(junk, relSlash(dir, path)) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error deleting %s: %w", path, err)
+		}
+		deleted = append(deleted, path)
+		return nil
+	})
+
+	// Deepest directories come last in walk order
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, readErr := os.ReadDir(dirs[i])
+		if readErr != nil || len(entries) > 0 {
+			continue
+		}
+		if os.Remove(dirs[i]) == nil {
+			deleted = append(deleted, dirs[i])
+		}
+	}
+	return deleted, err
+}
+
+// writeDeletionLog appends deleted paths to the cleanup log
+func writeDeletionLog(logFile string, deleted []string) error {
+	if logFile == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+	defer file.Close()
+
+	now := time.Now().Format(time.RFC3339)
+	var b strings.Builder
+	for _, path := range deleted {
+		fmt.Fprintf(&b, "%s\tdeleted\t%s\n", now, path)
+	}
+	if _, err := file.WriteString(b.String()); err != nil {
+		return fmt.Errorf("error writing log file: %w", err)
+	}
+	return nil
+}
+
+// compilePatterns compiles case-insensitive patterns, skipping invalid ones
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			log.Warn().Err(err).Str("pattern", pattern).Msg("Invalid pattern")
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// matchesAny reports whether a text matches any of the patterns
+func matchesAny(patterns []*regexp.Regexp, text string) bool {
+	for _, re := range patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// relSlash returns the path of a file relative to a directory with forward slashes
+func relSlash(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// TestDownloadDirOf tests finding the download directory of a media file
+func TestDownloadDirOf(t *testing.T) {
+	mediaDirs := []string{"/downloads", "/incoming/"}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected string
+	}{
+		{"/downloads/Movie.2020/Movie.2020.mkv", false, "/downloads/Movie.2020"},
+		{"/downloads/Show.S01/Season 1/Show.S01E01.mkv", false, "/downloads/Show.S01"},
+		{"/incoming/Movie.2020/Movie.2020.mkv", false, "/incoming/Movie.2020"},
+		{"/downloads/Movie.2020.mkv", false, ""},
+		{"/downloads/Movie.2020.BluRay", true, "/downloads/Movie.2020.BluRay"},
+		{"/downloads", true, ""},
+		{"/elsewhere/Movie.2020/Movie.2020.mkv", false, ""},
+		{"/downloads2/Movie.2020/Movie.2020.mkv", false, ""},
+	}
+
+	for _, test := range tests {
+		if actual := downloadDirOf(test.path, test.isDir, mediaDirs); actual != test.expected {
+			t.Errorf("downloadDirOf(%q) = %q, expected %q", test.path, actual, test.expected)
+		}
+	}
+}
+
+// TestCleanupDir tests that junk and empty directories are deleted and everything else is kept
+func TestCleanupDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "Movie.2020.1080p")
+	files := []string{
+		"Movie.2020.1080p.nfo",
+		"RARBG.txt",
+		"Sample/movie.sample.mkv",
+		"Screens/01.png",
+		"Extras/Interview.mkv",
+	}
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "Subs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	junk := compilePatterns(config.DefaultConfig().FileOps.Cleanup.JunkPatterns)
+	deleted, err := cleanupDir(dir, junk)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 4 junk files and the Sample, Screens and Subs directories
+	if len(deleted) != 7 {
+		t.Errorf("Expected 7 deletions, got %v", deleted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Extras", "Interview.mkv")); err != nil {
+		t.Errorf("Expected other files to be kept, got %v", err)
+	}
+
+	// Once the directory is empty it is removed, its parent is not
+	if err := os.RemoveAll(filepath.Join(dir, "Extras")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cleanupDir(dir, junk); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected empty download directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("Expected parent directory to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// companionFile is a sidecar file found next to a video, e.g. "Movie.2020.1080p.zh-CN.forced.ass"
+type companionFile struct {
+	Path string
+	Ext  string   // lower case extension
+	Tags []string // normalised language and flag tags, e.g. zh-CN, forced
+	Kind string   // image kind, e.g. poster; empty for subtitles and audio tracks
+}
+
+// imageExtensions are the companion extensions named as artwork rather than by language
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// imageKinds maps the artwork names found next to videos to the Emby/Jellyfin/Kodi names
+var imageKinds = map[string]string{
+	"poster":    "poster",
+	"cover":     "poster",
+	"folder":    "poster",
+	"fanart":    "fanart",
+	"backdrop":  "fanart",
+	"banner":    "banner",
+	"thumb":     "thumb",
+	"landscape": "landscape",
+	"clearlogo": "clearlogo",
+	"logo":      "clearlogo",
+}
+
+// languageTags maps common subtitle and audio language tags to the tags used in the library.
+// Tags that are not listed are kept as they are.
+var languageTags = map[string]string{
+	"zh-cn": "zh-CN", "zh-hans": "zh-CN", "chs": "zh-CN", "sc": "zh-CN", "gb": "zh-CN", "简体": "zh-CN", "简中": "zh-CN",
+	"zh-tw": "zh-TW", "zh-hant": "zh-TW", "cht": "zh-TW", "tc": "zh-TW", "big5": "zh-TW", "繁体": "zh-TW", "繁中": "zh-TW",
+	"zh-hk": "zh-HK", "粤语": "zh-HK",
+	"zh": "chi", "chi": "chi", "zho": "chi", "chinese": "chi", "中文": "chi",
+	"en": "eng", "eng": "eng", "english": "eng",
+	"ja": "jpn", "jp": "jpn", "jpn": "jpn", "japanese": "jpn",
+	"ko": "kor", "kor": "kor", "korean": "kor",
+	"fr": "fre", "fre": "fre", "fra": "fre", "french": "fre",
+	"de": "ger", "ger": "ger", "deu": "ger", "german": "ger",
+	"es": "spa", "spa": "spa", "spanish": "spa",
+	"it": "ita", "ita": "ita", "italian": "ita",
+	"ru": "rus", "rus": "rus", "russian": "rus",
+	"pt": "por", "por": "por", "portuguese": "por",
+}
+
+// flagTags are subtitle flags understood by media servers
+var flagTags = map[string]bool{"forced": true, "sdh": true, "cc": true, "hi": true, "default": true, "foreign": true}
+
+// findCompanions finds the files next to a video that share its name and have one of the
+// given extensions, e.g. "Movie.2020.1080p.eng.srt" for "Movie.2020.1080p.mkv"
+func findCompanions(videoPath string, extensions []string) []companionFile {
+	if len(extensions) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		allowed[strings.ToLower(ext)] = true
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(videoPath))
+	if err != nil {
+		return nil
+	}
+
+	videoName := filepath.Base(videoPath)
+	stem := strings.TrimSuffix(videoName, filepath.Ext(videoName))
+
+	var companions []companionFile
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if entry.IsDir() || name == videoName || !allowed[ext] || !strings.HasPrefix(name, stem) {
+			continue
+		}
+
+		// The rest of the name must be tags, so "Show.S01E01E02.srt" is no companion of "Show.S01E01"
+		rest := name[len(stem) : len(name)-len(ext)]
+		if rest != "" && !strings.ContainsRune(".-_ ", rune(rest[0])) {
+			continue
+		}
+
+		companion := companionFile{Path: filepath.Join(filepath.Dir(videoPath), name), Ext: ext}
+		tags := strings.FieldsFunc(rest, func(r rune) bool { return r == '.' || r == ' ' || r == '_' })
+		if imageExtensions[ext] {
+			// Other images, e.g. screenshots, are no artwork of the video
+			suffix := strings.Trim(rest, ".-_ ")
+			companion.Kind = imageKind(suffix)
+			if suffix != "" && companion.Kind == "" {
+				continue
+			}
+		} else {
+			for _, tag := range tags {
+				if tag = strings.Trim(tag, "-"); tag != "" {
+					companion.Tags = append(companion.Tags, normaliseTag(tag))
+				}
+			}
+		}
+		companions = append(companions, companion)
+	}
+	return companions
+}
+
+// imageKind returns the artwork kind of an image name suffix such as "-poster"
+func imageKind(suffix string) string {
+	if kind, ok := imageKinds[strings.ToLower(suffix)]; ok {
+		return kind
+	}
+	return ""
+}
+
+// normaliseTag normalises a language or flag tag
+func normaliseTag(tag string) string {
+	lower := strings.ToLower(tag)
+	if language, ok := languageTags[lower]; ok {
+		return language
+	}
+	if flagTags[lower] {
+		return lower
+	}
+	return tag
+}
+
+// companionName returns the file name of a companion of an organised video. Images without
+// a kind become the poster of a movie or the thumbnail of an episode.
+func companionName(destVideo, mediaType string, companion companionFile) string {
+	stem := strings.TrimSuffix(filepath.Base(destVideo), filepath.Ext(destVideo))
+	if imageExtensions[companion.Ext] {
+		kind := companion.Kind
+		if kind == "" {
+			kind = "poster"
+			if mediaType == "tv" {
+				kind = "thumb"
+			}
+		}
+		return stem + "-" + kind + companion.Ext
+	}
+	if len(companion.Tags) == 0 {
+		return stem + companion.Ext
+	}
+	return stem + "." + strings.Join(companion.Tags, ".") + companion.Ext
+}
+
+// organiseCompanions organises the sidecar files of a video next to its destination, with the
+// same file operation. They replace existing files when the conflict policy replaces videos.
+func (p *Processor) organiseCompanions(mediaType string, result *fileops.Result) []models.Companion {
+	if result.Entries != nil {
+		// Disc folders carry their own subtitles and artwork
+		return nil
+	}
+
+	process := p.fileOps.ProcessFile
+	if policy := p.config.FileOps.ConflictPolicy; policy == "overwrite" || policy == "upgrade" {
+		process = p.fileOps.ReplaceFile
+	}
+
+	var organised []models.Companion
+	for _, companion := range findCompanions(result.Source, p.config.FileOps.SidecarExtensions) {
+		destPath := filepath.Join(filepath.Dir(result.Destination), companionName(result.Destination, mediaType, companion))
+		companionResult, err := process(companion.Path, destPath)
+		if err != nil {
+			log.Warn().Err(err).Str("file", companion.Path).Msg("Failed to organise sidecar file")
+			continue
+		}
+		organised = append(organised, models.Companion{
+			Source:      companionResult.Source,
+			Destination: companionResult.Destination,
+			Mode:        companionResult.Mode,
+			Replaced:    companionResult.Replaced,
+		})
+	}
+
+	if len(organised) > 0 {
+		log.Info().Str("file", result.Destination).Int("count", len(organised)).Msg("Sidecar files organised")
+	}
+	return organised
+}
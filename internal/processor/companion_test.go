@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestFindCompanions tests finding and renaming the sidecar files of a video
+func TestFindCompanions(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"Movie.2020.1080p.mkv",
+		"Movie.2020.1080p.srt",
+		"Movie.2020.1080p.chs.ass",
+		"Movie.2020.1080p.en.forced.srt",
+		"Movie.2020.1080p.Commentary.mka",
+		"Movie.2020.1080p-poster.jpg",
+		"Movie.2020.1080p.jpg",
+		"Movie.2020.1080p.screenshot1.png",
+		"Movie.2020.1080p.nfo",
+		"Movie.2020.1080p.Extended.mkv",
+		"Movie.2020.1080pX.srt",
+	}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extensions := []string{".srt", ".ass", ".mka", ".jpg", ".png"}
+	companions := findCompanions(filepath.Join(dir, "Movie.2020.1080p.mkv"), extensions)
+
+	var names []string
+	for _, companion := range companions {
+		names = append(names, filepath.Base(companion.Path)+" -> "+companionName("/library/Movie (2020)/Movie (2020).mkv", "movie", companion))
+	}
+	sort.Strings(names)
+
+	expected := []string{
+		"Movie.2020.1080p-poster.jpg -> Movie (2020)-poster.jpg",
+		"Movie.2020.1080p.Commentary.mka -> Movie (2020).Commentary.mka",
+		"Movie.2020.1080p.chs.ass -> Movie (2020).zh-CN.ass",
+		"Movie.2020.1080p.en.forced.srt -> Movie (2020).eng.forced.srt",
+		"Movie.2020.1080p.jpg -> Movie (2020)-poster.jpg",
+		"Movie.2020.1080p.srt -> Movie (2020).srt",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected companions %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], names[i])
+		}
+	}
+}
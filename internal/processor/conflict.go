@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+// placement is the outcome of placing a file into the library
+type placement struct {
+	Result   *fileops.Result   // nil when the file was skipped
+	Skipped  string            // why the file was not organised
+	Replaced *models.MediaFile // record of the file replaced at the destination, if known
+}
+
+// placeFile processes a file to its destination, applying the conflict policy when a video
+// already takes the destination, under its name or with another extension
+func (p *Processor) placeFile(ctx context.Context, mediaFile *models.MediaFile, destPath string) (*placement, error) {
+	policy := p.config.FileOps.ConflictPolicy
+	if isDir(mediaFile.OriginalPath) {
+		return p.placeDir(mediaFile, destPath)
+	}
+	existingPath := p.existingVideo(destPath)
+	if existingPath == "" || policy == "keep-both" || policy == "" {
+		// Keep both: ProcessFile appends a " (n)" suffix to the new file
+		result, err := p.fileOps.ProcessFile(mediaFile.OriginalPath, destPath)
+		if err != nil {
+			return nil, err
+		}
+		return &placement{Result: result}, nil
+	}
+
+	existing, err := p.db.GetMediaFileByDestinationPath(existingPath)
+	if err != nil || existing.ID == mediaFile.ID {
+		existing = nil
+	}
+
+	switch policy {
+	case "skip":
+		return &placement{Skipped: fmt.Sprintf("Destination already exists: %s", existingPath)}, nil
+	case "overwrite":
+	case "upgrade":
+		existingName := filepath.Base(existingPath)
+		if existing != nil {
+			existingName = existing.OriginalName
+		}
+		newQuality := p.fileQuality(ctx, mediaFile.OriginalName, mediaFile.OriginalPath)
+		oldQuality := p.fileQuality(ctx, existingName, existingPath)
+		if compareQuality(newQuality, oldQuality) <= 0 {
+			return &placement{Skipped: fmt.Sprintf("Destination already exists with equal or better quality: %s", existingPath)}, nil
+		}
+		log.Info().
+			Str("file", mediaFile.OriginalPath).
+			Str("existing", existingPath).
+			Int("resolution", newQuality.Resolution).
+			Int("existing_resolution", oldQuality.Resolution).
+			Str("source", newQuality.Source).
+			Str("existing_source", oldQuality.Source).
+			Msg("Upgrading existing file")
+	default:
+		return nil, fmt.Errorf("unknown conflict policy: %s", policy)
+	}
+
+	result, err := p.fileOps.ReplaceExisting(mediaFile.OriginalPath, destPath, existingPath)
+	if err != nil {
+		return nil, err
+	}
+	p.markReplaced(existing, mediaFile, result)
+	return &placement{Result: result, Replaced: existing}, nil
+}
+
+// existingVideo returns the path of the video taking a destination: the destination itself, or
+// a video sharing its name with another extension. The name carries the episode or part, so
+// other episodes and parts do not match. It returns an empty string when there is none.
+func (p *Processor) existingVideo(destPath string) string {
+	if _, err := os.Lstat(destPath); err == nil {
+		return destPath
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(destPath), filepath.Ext(destPath))
+	entries, err := os.ReadDir(filepath.Dir(destPath))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.TrimSuffix(name, filepath.Ext(name)) != stem {
+			continue
+		}
+		if path := filepath.Join(filepath.Dir(destPath), name); p.isVideo(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// placeDir processes a disc folder to its destination directory. Discs are not compared or
+// replaced: unless the policy skips existing destinations, both are kept.
+func (p *Processor) placeDir(mediaFile *models.MediaFile, destDir string) (*placement, error) {
+	if _, err := os.Lstat(destDir); err == nil && p.config.FileOps.ConflictPolicy == "skip" &&
+		(p.containsVideo(destDir) || scanner.IsDiscRoot(destDir)) {
+		return &placement{Skipped: fmt.Sprintf("Destination already exists: %s", destDir)}, nil
+	}
+
+	result, err := p.fileOps.ProcessDir(mediaFile.OriginalPath, destDir)
+	if err != nil {
+		return nil, err
+	}
+	return &placement{Result: result}, nil
+}
+
+// markReplaced records that the organised file at a destination was replaced by another
+func (p *Processor) markReplaced(existing, mediaFile *models.MediaFile, result *fileops.Result) {
+	log.Info().
+		Str("file", mediaFile.OriginalPath).
+		Str("destination", result.Destination).
+		Str("replaced", result.Replaced).
+		Msg("Existing file replaced")
+	if existing == nil {
+		return
+	}
+
+	existing.Status = "replaced"
+	existing.DestinationPath = result.Replaced
+	existing.ErrorMessage = fmt.Sprintf("Replaced by %s", mediaFile.OriginalPath)
+	existing.UpdatedAt = time.Now()
+	if err := p.db.UpdateMediaFile(existing); err != nil {
+		log.Warn().Err(err).Str("file", existing.OriginalPath).Msg("Failed to mark media file as replaced")
+	}
+}
+
+// skipFile records that a file was not organised because of the conflict policy
+func (p *Processor) skipFile(mediaFile *models.MediaFile, reason string) error {
+	mediaFile.Status = "skipped"
+	mediaFile.ErrorMessage = reason
+	mediaFile.UpdatedAt = time.Now()
+	if err := p.db.UpdateMediaFile(mediaFile); err != nil {
+		return fmt.Errorf("error updating media file record: %w", err)
+	}
+
+	log.Info().Str("file", mediaFile.OriginalPath).Str("reason", reason).Msg("Media file skipped")
+	return nil
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/database/dbtest"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestPlaceFile tests the conflict policies against a video at the destination, under the
+// same name or with another extension
+func TestPlaceFile(t *testing.T) {
+	const dest = "Movies/Movie (2020)/Movie (2020).mkv"
+
+	testCases := []struct {
+		name         string
+		policy       string
+		incoming     string // release name of the new file
+		existing     string // video already in the library
+		existingName string // release name recorded for the existing video, if any
+		skipped      bool
+		replaced     bool   // the existing video was recycled
+		destination  string // where the new file ends up, if not skipped
+	}{
+		{"Keep both", "keep-both", "Movie.2020.1080p.mkv", dest, "", false, false, "Movies/Movie (2020)/Movie (2020) (1).mkv"},
+		{"Keep both, other extension", "keep-both", "Movie.2020.1080p.mkv", "Movies/Movie (2020)/Movie (2020).mp4", "", false, false, dest},
+		{"Skip", "skip", "Movie.2020.1080p.mkv", dest, "", true, false, ""},
+		{"Skip, other extension", "skip", "Movie.2020.1080p.mkv", "Movies/Movie (2020)/Movie (2020).mp4", "", true, false, ""},
+		{"Skip, other part", "skip", "Movie.2020.1080p.mkv", "Movies/Movie (2020)/Movie (2020) - part2.mkv", "", false, false, dest},
+		{"Upgrade", "upgrade", "Movie.2020.1080p.mkv", dest, "Movie.2020.720p.mkv", false, true, dest},
+		{"Upgrade, other extension", "upgrade", "Movie.2020.1080p.mkv", "Movies/Movie (2020)/Movie (2020).mp4", "Movie.2020.720p.mp4", false, true, dest},
+		{"Upgrade, worse", "upgrade", "Movie.2020.720p.mkv", dest, "Movie.2020.1080p.mkv", true, false, ""},
+		{"Upgrade, worse with other extension", "upgrade", "Movie.2020.720p.mkv", "Movies/Movie (2020)/Movie (2020).mp4", "Movie.2020.2160p.mp4", true, false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			library := filepath.Join(root, "library")
+			source := filepath.Join(root, "downloads", tc.incoming)
+			existing := filepath.Join(library, filepath.FromSlash(tc.existing))
+			for path, content := range map[string]string{source: "new", existing: "old"} {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			db := dbtest.New(t, func(query string, args []driver.Value) *dbtest.Rows {
+				if tc.existingName != "" && strings.Contains(query, "destination_path") && args[0] == existing {
+					return dbtest.RowsOf(&models.MediaFile{ID: 1, OriginalName: tc.existingName, DestinationPath: existing, Status: "success"})
+				}
+				return nil
+			})
+			cfg := config.DefaultConfig()
+			cfg.FileOps.Mode = "copy"
+			cfg.FileOps.DestinationRoot = library
+			cfg.FileOps.RecycleDir = filepath.Join(root, "recycle")
+			cfg.FileOps.ConflictPolicy = tc.policy
+			cfg.FileOps.FFprobePath = ""
+			p := &Processor{config: cfg, db: db.Database, fileOps: fileops.New(&cfg.FileOps)}
+
+			mediaFile := &models.MediaFile{ID: 2, OriginalName: tc.incoming, OriginalPath: source}
+			placed, err := p.placeFile(context.Background(), mediaFile, filepath.Join(library, filepath.FromSlash(dest)))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tc.skipped {
+				if placed.Skipped == "" || placed.Result != nil {
+					t.Fatalf("Expected the file to be skipped, got %+v", placed)
+				}
+			} else {
+				if placed.Skipped != "" {
+					t.Fatalf("Expected the file to be placed, got skipped: %s", placed.Skipped)
+				}
+				expected := filepath.Join(library, filepath.FromSlash(tc.destination))
+				if placed.Result.Destination != expected {
+					t.Errorf("Expected destination %s, got %s", expected, placed.Result.Destination)
+				}
+				if data, _ := os.ReadFile(expected); string(data) != "new" {
+					t.Errorf("Expected the destination to hold the new file, got %q", data)
+				}
+			}
+
+			_, statErr := os.Stat(existing)
+			if tc.replaced {
+				if existing != placed.Result.Destination && statErr == nil {
+					t.Errorf("Expected the existing file %s to be recycled", existing)
+				}
+				if placed.Result.ReplacedFrom != existing {
+					t.Errorf("Expected the replaced file to come from %s, got %s", existing, placed.Result.ReplacedFrom)
+				}
+				if data, _ := os.ReadFile(placed.Result.Replaced); string(data) != "old" {
+					t.Errorf("Expected the recycled file to hold the old file, got %q", data)
+				}
+				if placed.Replaced == nil || placed.Replaced.Status != "replaced" {
+					t.Errorf("Expected the existing media file to be marked as replaced, got %+v", placed.Replaced)
+				}
+			} else if data, _ := os.ReadFile(existing); statErr != nil || string(data) != "old" {
+				t.Errorf("Expected the existing file to be kept, got %q (%v)", data, statErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/parser"
+)
+
+// parsedResult converts a parse result to an identification result. IDs and categories are
+// not known to the parser and are left empty.
+func parsedResult(parsed *parser.Result) *llm.MediaFileResult {
+	return &llm.MediaFileResult{
+		OriginalFilename: parsed.OriginalFilename,
+		Title:            parsed.Title,
+		Year:             parsed.Year,
+		MediaType:        parsed.MediaType,
+		Season:           parsed.Season,
+		Episode:          parsed.Episode,
+		EndEpisode:       parsed.EndEpisode,
+		Part:             parsed.Part,
+		Confidence:       parsed.Confidence,
+	}
+}
+
+// identifyLocally identifies a file with the local filename parser and TMDB.
+// It returns nil when the file has to be identified by the LLM: the parser is not
+// confident enough, TMDB has no unambiguous match or no category rule matches.
+func (p *Processor) identifyLocally(ctx context.Context, filename string) *llm.MediaFileResult {
+	cfg := p.config.Parser
+	if !cfg.Enabled {
+		return nil
+	}
+
+	parsed := parser.Parse(filename)
+	if parsed.MediaType == "" || parsed.Confidence < cfg.ConfidenceThreshold {
+		log.Debug().
+			Str("file", filename).
+			Float64("confidence", parsed.Confidence).
+			Msg("Parser confidence below threshold, using LLM")
+		return nil
+	}
+
+	result := parsedResult(parsed)
+	var genres, countries []string
+	var language string
+
+	switch parsed.MediaType {
+	case "movie":
+		search, err := p.apiClient.TMDB.SearchMovie(ctx, parsed.Title, parsed.Year)
+		if err != nil {
+			log.Warn().Err(err).Str("file", filename).Msg("TMDB search failed, using LLM")
+			return nil
+		}
+		match := matchMovie(search.Movies, parsed)
+		if match == nil {
+			log.Debug().Str("file", filename).Str("title", parsed.Title).Msg("No unambiguous TMDB match, using LLM")
+			return nil
+		}
+
+		details, err := p.apiClient.TMDB.GetMovieDetails(ctx, int(match.ID))
+		if err != nil {
+			log.Warn().Err(err).Str("file", filename).Msg("TMDB movie details failed, using LLM")
+			return nil
+		}
+
+		result.Title = details.Title
+		result.OriginalTitle = details.OriginalTitle
+		result.Year = details.ReleaseYear
+		result.TMDBID = details.ID
+		result.ImdbID = details.ImdbID
+		genres, countries, language = details.Genres, details.CountryCodes, details.OriginalLanguage
+	case "tv":
+		search, err := p.apiClient.TMDB.SearchTV(ctx, parsed.Title, parsed.Year)
+		if err != nil {
+			log.Warn().Err(err).Str("file", filename).Msg("TMDB search failed, using LLM")
+			return nil
+		}
+		match := matchTVShow(search.Shows, parsed)
+		if match == nil {
+			log.Debug().Str("file", filename).Str("title", parsed.Title).Msg("No unambiguous TMDB match, using LLM")
+			return nil
+		}
+
+		details, err := p.apiClient.TMDB.GetTVDetails(ctx, int(match.ID))
+		if err != nil {
+			log.Warn().Err(err).Str("file", filename).Msg("TMDB TV details failed, using LLM")
+			return nil
+		}
+
+		result.Title = details.Name
+		result.OriginalTitle = details.OriginalName
+		result.Year = details.FirstAirYear
+		result.TMDBID = details.ID
+		result.ImdbID = details.ImdbID
+		if details.TVDBID > 0 {
+			result.TVDBID = int64(details.TVDBID)
+		}
+		genres, countries, language = details.Genres, details.CountryCodes, details.OriginalLanguage
+	}
+
+	rule := matchCategoryRule(cfg.CategoryRules, p.config.FileOps.DirectoryStructure, parsed.MediaType, genres, countries, language)
+	if rule == nil {
+		log.Debug().Str("file", filename).Msg("No category rule matches, using LLM")
+		return nil
+	}
+	result.Category = rule.Category
+	result.Subcategory = rule.Subcategory
+
+	log.Info().
+		Str("file", filename).
+		Str("title", result.Title).
+		Int64("tmdb_id", result.TMDBID).
+		Float64("confidence", result.Confidence).
+		Msg("Identified locally without LLM")
+	return result
+}
+
+// matchMovie returns the only search result whose title and year match the parsed file
+func matchMovie(movies []api.Movie, parsed *parser.Result) *api.Movie {
+	var match *api.Movie
+	for i := range movies {
+		movie := &movies[i]
+		if !titlesMatch(parsed.Title, movie.Title) && !titlesMatch(parsed.Title, movie.OriginalTitle) {
+			continue
+		}
+		if parsed.Year > 0 && abs(movie.ReleaseYear-parsed.Year) > 1 {
+			continue
+		}
+		if match != nil {
+			// Several movies share the title, e.g. remakes without a year in the filename
+			return nil
+		}
+		match = movie
+	}
+	return match
+}
+
+// matchTVShow returns the only search result whose title (and year, if known) match the parsed file
+func matchTVShow(shows []api.TVShow, parsed *parser.Result) *api.TVShow {
+	var match *api.TVShow
+	for i := range shows {
+		show := &shows[i]
+		if !titlesMatch(parsed.Title, show.Name) && !titlesMatch(parsed.Title, show.OriginalName) {
+			continue
+		}
+		if parsed.Year > 0 && show.FirstAirYear != parsed.Year {
+			continue
+		}
+		if match != nil {
+			return nil
+		}
+		match = show
+	}
+	return match
+}
+
+// titlesMatch compares titles ignoring case, punctuation and spacing
+func titlesMatch(a, b string) bool {
+	na, nb := normalizeTitle(a), normalizeTitle(b)
+	return na != "" && na == nb
+}
+
+// normalizeTitle keeps only the letters and digits of a title
+func normalizeTitle(title string) string {
+	title = strings.ReplaceAll(strings.ToLower(title), "&", "and")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, title)
+}
+
+// matchCategoryRule returns the first rule matching the metadata whose category exists in the directory structure
+func matchCategoryRule(rules []config.CategoryRule, structure map[string][]string, mediaType string, genres, countries []string, language string) *config.CategoryRule {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.MediaType != "" && rule.MediaType != mediaType {
+			continue
+		}
+		if len(rule.Genres) > 0 && !containsAny(rule.Genres, genres) {
+			continue
+		}
+		if len(rule.Countries) > 0 && !containsAny(rule.Countries, countries) {
+			continue
+		}
+		if len(rule.Languages) > 0 && !containsAny(rule.Languages, []string{language}) {
+			continue
+		}
+		if !categoryExists(structure, rule.Category, rule.Subcategory) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+// categoryExists reports whether a category is part of the directory structure.
+// Any category is accepted when no directory structure is configured.
+func categoryExists(structure map[string][]string, category, subcategory string) bool {
+	if len(structure) == 0 {
+		return true
+	}
+	subcategories, ok := structure[category]
+	if !ok {
+		return false
+	}
+	if subcategory == "" {
+		return true
+	}
+	for _, s := range subcategories {
+		if s == subcategory {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether any value is in the list, ignoring case
+func containsAny(list, values []string) bool {
+	for _, item := range list {
+		for _, value := range values {
+			if value != "" && strings.EqualFold(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
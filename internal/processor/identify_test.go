@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/parser"
+)
+
+// TestMatchCategoryRule tests the category rule selection
+func TestMatchCategoryRule(t *testing.T) {
+	rules := []config.CategoryRule{
+		{MediaType: "movie", Genres: []string{"Animation"}, Category: "Movies", Subcategory: "Animation"},
+		{MediaType: "movie", Languages: []string{"zh"}, Category: "Movies", Subcategory: "Chinese"},
+		{MediaType: "movie", Category: "Movies", Subcategory: "Foreign"},
+		{MediaType: "tv", Countries: []string{"JP", "KR"}, Category: "TV", Subcategory: "Asian"},
+		{MediaType: "tv", Category: "Missing", Subcategory: "Other"},
+	}
+	structure := map[string][]string{
+		"Movies": {"Animation", "Chinese", "Foreign"},
+		"TV":     {"Asian"},
+	}
+
+	testCases := []struct {
+		name        string
+		mediaType   string
+		genres      []string
+		countries   []string
+		language    string
+		subcategory string
+	}{
+		{"Animated movie", "movie", []string{"Comedy", "animation"}, nil, "en", "Animation"},
+		{"Chinese movie", "movie", []string{"Drama"}, []string{"CN"}, "zh", "Chinese"},
+		{"Default movie", "movie", []string{"Drama"}, []string{"US"}, "en", "Foreign"},
+		{"Korean show", "tv", nil, []string{"KR"}, "ko", "Asian"},
+		{"Category not in structure", "tv", nil, []string{"US"}, "en", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := matchCategoryRule(rules, structure, tc.mediaType, tc.genres, tc.countries, tc.language)
+			if tc.subcategory == "" {
+				if rule != nil {
+					t.Errorf("Expected no rule, got %+v", rule)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatalf("Expected subcategory %s, got no rule", tc.subcategory)
+			}
+			if rule.Subcategory != tc.subcategory {
+				t.Errorf("Expected subcategory %s, got %s", tc.subcategory, rule.Subcategory)
+			}
+		})
+	}
+}
+
+// TestMatchMovie tests matching parsed files against TMDB search results
+func TestMatchMovie(t *testing.T) {
+	movies := []api.Movie{
+		{ID: 1, Title: "寄生虫", OriginalTitle: "기생충", ReleaseYear: 2019},
+		{ID: 2, Title: "Parasite", OriginalTitle: "Parasite", ReleaseYear: 1982},
+		{ID: 3, Title: "Parasite", OriginalTitle: "Parasite", ReleaseYear: 2019},
+	}
+
+	if match := matchMovie(movies, &parser.Result{Title: "Parasite", Year: 2019}); match == nil || match.ID != 3 {
+		t.Errorf("Expected movie 3, got %+v", match)
+	}
+	if match := matchMovie(movies, &parser.Result{Title: "Parasite"}); match != nil {
+		t.Errorf("Expected no match for ambiguous title, got %+v", match)
+	}
+	if match := matchMovie(movies, &parser.Result{Title: "Parasites", Year: 2019}); match != nil {
+		t.Errorf("Expected no match for different title, got %+v", match)
+	}
+}
+
+// TestTitlesMatch tests title normalisation
+func TestTitlesMatch(t *testing.T) {
+	if !titlesMatch("Marvel's Agents of S.H.I.E.L.D.", "marvels agents of shield") {
+		t.Error("Expected titles to match ignoring punctuation")
+	}
+	if !titlesMatch("Law & Order", "Law and Order") {
+		t.Error("Expected & to match and")
+	}
+	if titlesMatch("", "") {
+		t.Error("Expected empty titles not to match")
+	}
+}
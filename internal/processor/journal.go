@@ -0,0 +1,249 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// UndoResult is the outcome of undoing a single operation
+type UndoResult struct {
+	Operation models.Operation
+	Err       error
+}
+
+// recordOperation journals a file organised into the library. The file has already been
+// organised at this point, so failures are logged and nil is returned.
+func (p *Processor) recordOperation(mediaFile *models.MediaFile, batchID int64, placed *placement) *models.Operation {
+	result := placed.Result
+	operation := &models.Operation{
+		MediaFileID:     mediaFile.ID,
+		BatchProcessID:  batchID,
+		SourcePath:      result.Source,
+		DestinationPath: result.Destination,
+		Mode:            result.Mode,
+		Fallback:        result.Fallback,
+		CreatedDirs:     result.CreatedDirs,
+		Entries:         result.Entries,
+		ReplacedPath:    result.Replaced,
+		Status:          "done",
+		CreatedAt:       time.Now(),
+	}
+	if result.ReplacedFrom != result.Destination {
+		operation.ReplacedFrom = result.ReplacedFrom
+	}
+	if placed.Replaced != nil {
+		operation.ReplacedFileID = placed.Replaced.ID
+	}
+	if result.Fallback != "" {
+		log.Warn().
+			Str("file", mediaFile.OriginalPath).
+			Str("mode", p.config.FileOps.Mode).
+			Str("reason", result.Fallback).
+			Msg("File copied instead of linked")
+	}
+
+	if err := p.db.CreateOperation(operation); err != nil {
+		log.Error().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to record operation, it cannot be undone")
+		return nil
+	}
+	return operation
+}
+
+// recordSidecars adds the metadata files written for a media file to its operation
+func (p *Processor) recordSidecars(operation *models.Operation, sidecars []string) {
+	if operation == nil || len(sidecars) == 0 {
+		return
+	}
+
+	operation.Sidecars = append(operation.Sidecars, sidecars...)
+	if err := p.db.UpdateOperation(operation); err != nil {
+		log.Error().Err(err).Str("file", operation.DestinationPath).Msg("Failed to record metadata files")
+	}
+}
+
+// recordCompanions adds the sidecar files organised along with a media file to its operation
+func (p *Processor) recordCompanions(operation *models.Operation, companions []models.Companion) {
+	if operation == nil || len(companions) == 0 {
+		return
+	}
+
+	operation.Companions = append(operation.Companions, companions...)
+	if err := p.db.UpdateOperation(operation); err != nil {
+		log.Error().Err(err).Str("file", operation.DestinationPath).Msg("Failed to record sidecar files")
+	}
+}
+
+// UndoMediaFile undoes the latest operation of a media file
+func (p *Processor) UndoMediaFile(mediaFileID int64) ([]UndoResult, error) {
+	operations, err := p.db.GetOperationsByMediaFileID(mediaFileID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting operations: %w", err)
+	}
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("media file %d has no operation to undo", mediaFileID)
+	}
+	return p.undoOperations(operations[:1]), nil
+}
+
+// UndoBatch undoes the operations of a batch
+func (p *Processor) UndoBatch(batchID int64) ([]UndoResult, error) {
+	operations, err := p.db.GetOperationsByBatchID(batchID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting operations: %w", err)
+	}
+	return p.undoOperations(operations), nil
+}
+
+// UndoSince undoes all operations since a point in time
+func (p *Processor) UndoSince(since time.Time) ([]UndoResult, error) {
+	operations, err := p.db.GetOperationsSince(since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting operations: %w", err)
+	}
+	return p.undoOperations(operations), nil
+}
+
+// undoOperations undoes operations in the given order, newest first.
+// A failed operation does not stop the remaining ones.
+func (p *Processor) undoOperations(operations []models.Operation) []UndoResult {
+	results := make([]UndoResult, 0, len(operations))
+	for i := range operations {
+		err := p.undoOperation(&operations[i])
+		if err != nil {
+			log.Error().Err(err).Str("file", operations[i].DestinationPath).Msg("Failed to undo operation")
+		}
+		results = append(results, UndoResult{Operation: operations[i], Err: err})
+	}
+	return results
+}
+
+// undoOperation puts an organised file back, removes its metadata files and the directories
+// created for it, and returns the media file to manual review
+func (p *Processor) undoOperation(operation *models.Operation) error {
+	var err error
+	if len(operation.Entries) > 0 {
+		// Disc folders are put back entry by entry
+		err = p.fileOps.RevertDir(operation.SourcePath, operation.DestinationPath, operation.Mode, operation.Entries)
+	} else {
+		err = p.fileOps.Revert(operation.SourcePath, operation.DestinationPath, operation.Mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Put the sidecar files organised along with the file back
+	for _, companion := range operation.Companions {
+		if err := p.fileOps.Revert(companion.Source, companion.Destination, companion.Mode); err != nil {
+			log.Warn().Err(err).Str("file", companion.Destination).Msg("Failed to revert sidecar file")
+			continue
+		}
+		if companion.Replaced != "" {
+			if err := p.fileOps.RestoreReplaced(companion.Replaced, companion.Destination); err != nil {
+				log.Warn().Err(err).Str("file", companion.Replaced).Msg("Failed to restore replaced sidecar file")
+			}
+		}
+	}
+
+	// Metadata shared with other files, e.g. tvshow.nfo, stays while the library still uses it
+	for _, sidecar := range operation.Sidecars {
+		if !ownsSidecar(operation.DestinationPath, sidecar) && p.containsVideo(filepath.Dir(sidecar)) {
+			continue
+		}
+		if err := p.fileOps.RemoveFile(sidecar); err != nil {
+			log.Warn().Err(err).Str("file", sidecar).Msg("Failed to remove metadata file")
+		}
+	}
+	p.fileOps.PruneDirs(operation.CreatedDirs)
+
+	// Put back the file this one replaced
+	if operation.ReplacedPath != "" {
+		if err := p.restoreReplaced(operation); err != nil {
+			log.Warn().Err(err).Str("file", operation.ReplacedPath).Msg("Failed to restore replaced file")
+		}
+	}
+
+	operation.Status = "undone"
+	operation.UndoneAt = time.Now()
+	if err := p.db.UpdateOperation(operation); err != nil {
+		return fmt.Errorf("error updating operation: %w", err)
+	}
+
+	mediaFile, err := p.db.GetMediaFileByID(operation.MediaFileID)
+	if err != nil {
+		return fmt.Errorf("error getting media file: %w", err)
+	}
+	mediaFile.Status = "manual"
+	mediaFile.ErrorMessage = fmt.Sprintf("Organisation into %s was undone", operation.DestinationPath)
+	mediaFile.DestinationPath = ""
+	mediaFile.UpdatedAt = time.Now()
+	if err := p.db.UpdateMediaFile(mediaFile); err != nil {
+		return fmt.Errorf("error updating media file: %w", err)
+	}
+
+	log.Info().
+		Str("source", operation.SourcePath).
+		Str("destination", operation.DestinationPath).
+		Str("mode", operation.Mode).
+		Msg("Operation undone")
+	return nil
+}
+
+// restoreReplaced moves the file replaced by an operation back to where it was and marks its
+// media file as organised again
+func (p *Processor) restoreReplaced(operation *models.Operation) error {
+	restorePath := operation.DestinationPath
+	if operation.ReplacedFrom != "" {
+		restorePath = operation.ReplacedFrom
+	}
+	if err := p.fileOps.RestoreReplaced(operation.ReplacedPath, restorePath); err != nil {
+		return err
+	}
+	if operation.ReplacedFileID == 0 {
+		return nil
+	}
+
+	replaced, err := p.db.GetMediaFileByID(operation.ReplacedFileID)
+	if err != nil {
+		return fmt.Errorf("error getting replaced media file: %w", err)
+	}
+	replaced.Status = "success"
+	replaced.DestinationPath = restorePath
+	replaced.ErrorMessage = ""
+	replaced.UpdatedAt = time.Now()
+	if err := p.db.UpdateMediaFile(replaced); err != nil {
+		return fmt.Errorf("error updating replaced media file: %w", err)
+	}
+	return nil
+}
+
+// ownsSidecar reports whether a metadata file belongs to a single video file,
+// e.g. "Show - S01E01.nfo" or "Show - S01E01-thumb.jpg"
+func ownsSidecar(videoPath, sidecar string) bool {
+	if filepath.Dir(videoPath) != filepath.Dir(sidecar) {
+		return false
+	}
+	stem := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	return strings.HasPrefix(filepath.Base(sidecar), stem)
+}
+
+// containsVideo reports whether a directory tree contains a video file
+func (p *Processor) containsVideo(dir string) bool {
+	found := false
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if p.isVideo(path) {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,25 @@
+package processor
+
+import "testing"
+
+// TestOwnsSidecar tests telling per-file metadata from shared metadata
+func TestOwnsSidecar(t *testing.T) {
+	video := "/library/TV/Show (2020)/Season 1/Show - S01E01 - Pilot.mkv"
+
+	testCases := []struct {
+		sidecar  string
+		expected bool
+	}{
+		{"/library/TV/Show (2020)/Season 1/Show - S01E01 - Pilot.nfo", true},
+		{"/library/TV/Show (2020)/Season 1/Show - S01E01 - Pilot-thumb.jpg", true},
+		{"/library/TV/Show (2020)/Season 1/Show - S01E02 - Second.nfo", false},
+		{"/library/TV/Show (2020)/tvshow.nfo", false},
+		{"/library/TV/Show (2020)/season01-poster.jpg", false},
+	}
+
+	for _, tc := range testCases {
+		if result := ownsSidecar(video, tc.sidecar); result != tc.expected {
+			t.Errorf("Expected %v for %s, got %v", tc.expected, tc.sidecar, result)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// reviewStatuses are the media file statuses awaiting manual review
+var reviewStatuses = []string{"manual", "failed"}
+
+// ReviewItem is a media file awaiting manual review
+type ReviewItem struct {
+	File       *models.MediaFile
+	MediaInfo  *models.MediaInfo // nil when the file was never identified
+	Candidates []models.Candidate
+}
+
+// Correction is an identification supplied by an operator during review.
+// Fields left empty are taken from the stored identification or the metadata.
+type Correction struct {
+	MediaType   string // movie, tv
+	TMDBID      int64
+	TVDBID      int64
+	BangumiID   int64
+	Season      int
+	Episode     int
+	EndEpisode  int // last episode of a multi-episode file
+	Part        int // part of a multi-part movie
+	Category    string
+	Subcategory string
+}
+
+// ListReviewItems lists the media files awaiting manual review
+func (p *Processor) ListReviewItems() ([]ReviewItem, error) {
+	files, err := p.db.GetMediaFilesByStatus(reviewStatuses...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting media files: %w", err)
+	}
+
+	items := make([]ReviewItem, 0, len(files))
+	for i := range files {
+		item, err := p.reviewItem(&files[i])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// GetReviewItem returns a media file with its stored identification and candidates
+func (p *Processor) GetReviewItem(mediaFileID int64) (*ReviewItem, error) {
+	mediaFile, err := p.db.GetMediaFileByID(mediaFileID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting media file %d: %w", mediaFileID, err)
+	}
+	return p.reviewItem(mediaFile)
+}
+
+// reviewItem loads the stored identification and candidates of a media file
+func (p *Processor) reviewItem(mediaFile *models.MediaFile) (*ReviewItem, error) {
+	item := &ReviewItem{File: mediaFile}
+	if info, err := p.db.GetMediaInfoByMediaFileID(mediaFile.ID); err == nil {
+		item.MediaInfo = info
+	}
+
+	candidates, err := p.db.GetCandidatesByMediaFileID(mediaFile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting candidates of media file %d: %w", mediaFile.ID, err)
+	}
+	item.Candidates = candidates
+	return item, nil
+}
+
+// AcceptCandidate organises a media file with one of its review candidates
+func (p *Processor) AcceptCandidate(ctx context.Context, mediaFileID int64, rank int) error {
+	item, err := p.GetReviewItem(mediaFileID)
+	if err != nil {
+		return err
+	}
+	if err := checkReviewable(item.File); err != nil {
+		return err
+	}
+
+	var candidate *models.Candidate
+	for i := range item.Candidates {
+		if item.Candidates[i].Rank == rank {
+			candidate = &item.Candidates[i]
+			break
+		}
+	}
+	if candidate == nil {
+		return fmt.Errorf("media file %d has no candidate %d", mediaFileID, rank)
+	}
+
+	result := &llm.MediaFileResult{
+		OriginalFilename: item.File.OriginalName,
+		Title:            candidate.Title,
+		OriginalTitle:    candidate.OriginalTitle,
+		Year:             candidate.Year,
+		MediaType:        candidate.MediaType,
+		Season:           candidate.Season,
+		Episode:          candidate.Episode,
+		EndEpisode:       candidate.EndEpisode,
+		Part:             candidate.Part,
+		TMDBID:           candidate.TMDBID,
+		TVDBID:           candidate.TVDBID,
+		BangumiID:        candidate.BangumiID,
+		ImdbID:           candidate.ImdbID,
+		Category:         candidate.Category,
+		Subcategory:      candidate.Subcategory,
+		Confidence:       candidate.Confidence,
+	}
+
+	log.Info().
+		Str("file", item.File.OriginalPath).
+		Int("candidate", rank).
+		Str("title", candidate.Title).
+		Msg("Candidate accepted during review")
+	return p.organiseReviewed(ctx, item.File, result)
+}
+
+// ApplyCorrection organises a media file with an identification supplied by an operator
+func (p *Processor) ApplyCorrection(ctx context.Context, mediaFileID int64, correction *Correction) error {
+	item, err := p.GetReviewItem(mediaFileID)
+	if err != nil {
+		return err
+	}
+	if err := checkReviewable(item.File); err != nil {
+		return err
+	}
+
+	result, err := correctionResult(item, correction)
+	if err != nil {
+		return err
+	}
+	if result.Category != "" && !categoryExists(p.config.FileOps.DirectoryStructure, result.Category, result.Subcategory) {
+		return fmt.Errorf("category %s/%s is not part of the directory structure", result.Category, result.Subcategory)
+	}
+
+	log.Info().
+		Str("file", item.File.OriginalPath).
+		Str("media_type", result.MediaType).
+		Int64("tmdb_id", result.TMDBID).
+		Int64("tvdb_id", result.TVDBID).
+		Int64("bangumi_id", result.BangumiID).
+		Msg("Identification corrected during review")
+	return p.organiseReviewed(ctx, item.File, result)
+}
+
+// organiseReviewed organises a reviewed media file and drops its candidates
+func (p *Processor) organiseReviewed(ctx context.Context, mediaFile *models.MediaFile, result *llm.MediaFileResult) error {
+	// Claim the file unless it changed since it was listed
+	if err := p.claim(mediaFile, mediaFile.Status); err != nil {
+		return err
+	}
+
+	if err := p.organise(ctx, mediaFile, result); err != nil {
+		return err
+	}
+
+	if err := p.db.DeleteCandidatesByMediaFileID(mediaFile.ID); err != nil {
+		log.Warn().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to delete review candidates")
+	}
+	return nil
+}
+
+// checkReviewable returns an error unless the media file awaits manual review
+func checkReviewable(mediaFile *models.MediaFile) error {
+	for _, status := range reviewStatuses {
+		if mediaFile.Status == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("media file %d is %s, not awaiting review", mediaFile.ID, mediaFile.Status)
+}
+
+// correctionResult builds the identification result of a correction. The title is left
+// empty, it is taken from the metadata of the given IDs when the file is organised.
+func correctionResult(item *ReviewItem, correction *Correction) (*llm.MediaFileResult, error) {
+	if correction.TMDBID == 0 && correction.TVDBID == 0 && correction.BangumiID == 0 {
+		return nil, fmt.Errorf("a TMDB, TVDB or Bangumi ID is required")
+	}
+
+	result := &llm.MediaFileResult{
+		OriginalFilename: item.File.OriginalName,
+		MediaType:        correction.MediaType,
+		Season:           correction.Season,
+		Episode:          correction.Episode,
+		EndEpisode:       correction.EndEpisode,
+		Part:             correction.Part,
+		TMDBID:           correction.TMDBID,
+		TVDBID:           correction.TVDBID,
+		BangumiID:        correction.BangumiID,
+		Category:         correction.Category,
+		Subcategory:      correction.Subcategory,
+		Confidence:       1,
+	}
+
+	// Infer the media type: TVDB and Bangumi IDs and episode numbers only exist for shows
+	if result.MediaType == "" {
+		switch {
+		case result.TVDBID > 0 || result.BangumiID > 0 || result.Season > 0 || result.Episode > 0:
+			result.MediaType = "tv"
+		case item.MediaInfo != nil && item.MediaInfo.MediaType != "":
+			result.MediaType = item.MediaInfo.MediaType
+		default:
+			return nil, fmt.Errorf("the media type of media file %d is unknown", item.File.ID)
+		}
+	}
+	if result.MediaType != "movie" && result.MediaType != "tv" {
+		return nil, fmt.Errorf("invalid media type: %s", result.MediaType)
+	}
+	if result.MediaType == "movie" && result.TMDBID == 0 {
+		return nil, fmt.Errorf("movies are identified by their TMDB ID")
+	}
+
+	// Keep the episode numbers of the stored identification when none are given
+	if result.MediaType == "tv" && result.Season == 0 && result.Episode == 0 && item.MediaInfo != nil {
+		result.Season = item.MediaInfo.Season
+		result.Episode = item.MediaInfo.Episode
+		result.EndEpisode = item.MediaInfo.EndEpisode
+	}
+	if result.MediaType == "tv" && result.Episode == 0 {
+		return nil, fmt.Errorf("an episode number is required for TV shows")
+	}
+
+	// Keep the category of the best candidate when none is given
+	if result.Category == "" && len(item.Candidates) > 0 {
+		result.Category = item.Candidates[0].Category
+		result.Subcategory = item.Candidates[0].Subcategory
+	}
+
+	return result, nil
+}
+
+// completeIdentification fills the title and category of an identification given by ID only
+// from the fetched metadata. Complete identifications are left unchanged.
+func (p *Processor) completeIdentification(result *llm.MediaFileResult, mediaInfo *models.MediaInfo, details *api.MediaDetails) error {
+	if mediaInfo.Title == "" {
+		mediaInfo.Title, mediaInfo.OriginalTitle, mediaInfo.Year = titleFromDetails(details)
+		if mediaInfo.Title == "" {
+			return fmt.Errorf("no title found for the given IDs")
+		}
+		result.Title, result.OriginalTitle, result.Year = mediaInfo.Title, mediaInfo.OriginalTitle, mediaInfo.Year
+	}
+
+	if result.Category == "" {
+		genres, countries, language := categoryMetadata(details)
+		rule := matchCategoryRule(p.config.Parser.CategoryRules, p.config.FileOps.DirectoryStructure, mediaInfo.MediaType, genres, countries, language)
+		if rule == nil {
+			return fmt.Errorf("no category given and no category rule matches")
+		}
+		result.Category = rule.Category
+		result.Subcategory = rule.Subcategory
+	}
+
+	return nil
+}
+
+// titleFromDetails returns the title, original title and year of the fetched metadata
+func titleFromDetails(details *api.MediaDetails) (string, string, int) {
+	switch {
+	case details == nil:
+		return "", "", 0
+	case details.Movie != nil:
+		return details.Movie.Title, details.Movie.OriginalTitle, details.Movie.ReleaseYear
+	case details.TVShow != nil:
+		return details.TVShow.Name, details.TVShow.OriginalName, details.TVShow.FirstAirYear
+	case details.TVDBSeries != nil:
+		return details.TVDBSeries.Name, details.TVDBSeries.Name, details.TVDBSeries.FirstAiredYear
+	case details.Bangumi != nil:
+		if details.Bangumi.NameCN != "" {
+			return details.Bangumi.NameCN, details.Bangumi.Name, details.Bangumi.Year
+		}
+		return details.Bangumi.Name, details.Bangumi.Name, details.Bangumi.Year
+	}
+	return "", "", 0
+}
+
+// categoryMetadata returns the genres, countries and original language used by the category rules
+func categoryMetadata(details *api.MediaDetails) ([]string, []string, string) {
+	switch {
+	case details == nil:
+		return nil, nil, ""
+	case details.Movie != nil:
+		return details.Movie.Genres, details.Movie.CountryCodes, details.Movie.OriginalLanguage
+	case details.TVShow != nil:
+		return details.TVShow.Genres, details.TVShow.CountryCodes, details.TVShow.OriginalLanguage
+	case details.TVDBSeries != nil:
+		return details.TVDBSeries.Genres, details.TVDBSeries.Countries, ""
+	case details.Bangumi != nil:
+		return details.Bangumi.Tags, nil, ""
+	}
+	return nil, nil, ""
+}
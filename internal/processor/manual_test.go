@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/api"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestCorrectionResult tests building identifications from operator corrections
+func TestCorrectionResult(t *testing.T) {
+	item := &ReviewItem{
+		File:      &models.MediaFile{ID: 7, OriginalName: "show.s02e03.mkv"},
+		MediaInfo: &models.MediaInfo{MediaType: "tv", Season: 2, Episode: 3},
+		Candidates: []models.Candidate{
+			{Rank: 1, Category: "TV", Subcategory: "Foreign"},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		item        *ReviewItem
+		correction  Correction
+		mediaType   string
+		season      int
+		episode     int
+		category    string
+		expectError bool
+	}{
+		{"Keeps stored episode", item, Correction{TMDBID: 1399}, "tv", 2, 3, "TV", false},
+		{"Given episode", item, Correction{TVDBID: 121361, Season: 1, Episode: 9, Category: "Anime"}, "tv", 1, 9, "Anime", false},
+		{"Movie", item, Correction{MediaType: "movie", TMDBID: 603}, "movie", 0, 0, "TV", false},
+		{"Missing ID", item, Correction{Season: 1, Episode: 1}, "", 0, 0, "", true},
+		{"Movie without TMDB ID", item, Correction{MediaType: "movie", BangumiID: 1}, "", 0, 0, "", true},
+		{"Unknown media type", &ReviewItem{File: &models.MediaFile{ID: 8}}, Correction{TMDBID: 603}, "", 0, 0, "", true},
+		{"Missing episode", &ReviewItem{File: &models.MediaFile{ID: 9}}, Correction{TVDBID: 121361}, "", 0, 0, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := correctionResult(tc.item, &tc.correction)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.MediaType != tc.mediaType {
+				t.Errorf("Expected media type %s, got %s", tc.mediaType, result.MediaType)
+			}
+			if result.Season != tc.season || result.Episode != tc.episode {
+				t.Errorf("Expected S%02dE%02d, got S%02dE%02d", tc.season, tc.episode, result.Season, result.Episode)
+			}
+			if result.Category != tc.category {
+				t.Errorf("Expected category %s, got %s", tc.category, result.Category)
+			}
+		})
+	}
+}
+
+// TestTitleFromDetails tests taking titles from fetched metadata
+func TestTitleFromDetails(t *testing.T) {
+	testCases := []struct {
+		name     string
+		details  *api.MediaDetails
+		title    string
+		original string
+		year     int
+	}{
+		{"Movie", &api.MediaDetails{Movie: &api.MovieDetails{Title: "寄生虫", OriginalTitle: "기생충", ReleaseYear: 2019}}, "寄生虫", "기생충", 2019},
+		{"TMDB show", &api.MediaDetails{TVShow: &api.TVDetails{Name: "Dark", OriginalName: "Dark", FirstAirYear: 2017}}, "Dark", "Dark", 2017},
+		{"Bangumi", &api.MediaDetails{Bangumi: &api.BangumiAnimeDetails{Name: "進撃の巨人", NameCN: "进击的巨人", Year: 2013}}, "进击的巨人", "進撃の巨人", 2013},
+		{"Nothing fetched", &api.MediaDetails{}, "", "", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			title, original, year := titleFromDetails(tc.details)
+			if title != tc.title || original != tc.original || year != tc.year {
+				t.Errorf("Expected %s/%s/%d, got %s/%s/%d", tc.title, tc.original, tc.year, title, original, year)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/scanner"
+)
+
+// Plan is the outcome of a dry run: how the scanned files would be organised
+type Plan struct {
+	CreatedAt       time.Time   `json:"created_at"`
+	Mode            string      `json:"mode"`
+	DestinationRoot string      `json:"destination_root"`
+	Entries         []PlanEntry `json:"entries"`
+}
+
+// PlanEntry is the planned organisation of a single file
+type PlanEntry struct {
+	SourcePath     string               `json:"source_path"`
+	Destination    string               `json:"destination,omitempty"`
+	Identification *llm.MediaFileResult `json:"identification,omitempty"`
+	IdentifiedBy   string               `json:"identified_by,omitempty"` // parser, llm
+	NeedsReview    bool                 `json:"needs_review,omitempty"`
+	Error          string               `json:"error,omitempty"`
+}
+
+// ApplyResult is the outcome of applying a single plan entry
+type ApplyResult struct {
+	SourcePath  string
+	Destination string
+	Status      string // success, manual, skipped, failed
+	Reason      string
+}
+
+// PlanFiles identifies files and computes their destinations without writing to the
+// filesystem or changing any media file. Files of a batch directory are identified together.
+func (p *Processor) PlanFiles(ctx context.Context, files []string, batchDirs map[string][]string) *Plan {
+	plan := &Plan{
+		CreatedAt:       time.Now(),
+		Mode:            p.config.FileOps.Mode,
+		DestinationRoot: p.config.FileOps.DestinationRoot,
+		Entries:         make([]PlanEntry, 0, len(files)),
+	}
+
+	inBatch := make(map[string]bool)
+	for dir, batchFiles := range batchDirs {
+		for _, file := range batchFiles {
+			inBatch[file] = true
+		}
+		plan.Entries = append(plan.Entries, p.planBatch(ctx, dir, batchFiles)...)
+	}
+
+	for _, file := range files {
+		if inBatch[file] {
+			continue
+		}
+		plan.Entries = append(plan.Entries, p.planFile(ctx, file))
+	}
+
+	sort.Slice(plan.Entries, func(i, j int) bool {
+		return plan.Entries[i].SourcePath < plan.Entries[j].SourcePath
+	})
+	return plan
+}
+
+// planFile plans a single file
+func (p *Processor) planFile(ctx context.Context, path string) PlanEntry {
+	entry := PlanEntry{SourcePath: path, IdentifiedBy: "parser"}
+
+	result := p.identifyLocally(ctx, p.mediaName(path))
+	if result == nil {
+		p.registerFunctionHandlers()
+
+		err := p.budgetError()
+		if err == nil {
+			result, err = p.llmClient.ProcessMediaFile(ctx, p.mediaName(path), p.config.FileOps.DirectoryStructure)
+		}
+		if err != nil {
+			entry.Error = fmt.Sprintf("LLM processing error: %v", err)
+			return entry
+		}
+		entry.IdentifiedBy = "llm"
+	}
+
+	p.planDestination(ctx, &entry, result)
+	return entry
+}
+
+// planBatch plans the files of a batch directory
+func (p *Processor) planBatch(ctx context.Context, dir string, files []string) []PlanEntry {
+	entries := make([]PlanEntry, 0, len(files))
+	results := make(map[string]*llm.MediaFileResult)
+	identifiedBy := make(map[string]string)
+
+	llmFilenames := make([]string, 0, len(files))
+	for _, file := range files {
+		filename := p.mediaName(file)
+		if result := p.identifyLocally(ctx, filename); result != nil {
+			results[filename] = result
+			identifiedBy[filename] = "parser"
+			continue
+		}
+		llmFilenames = append(llmFilenames, filename)
+	}
+
+	var batchErr error
+	if len(llmFilenames) > 0 {
+		p.registerFunctionHandlers()
+
+		var batchResults []*llm.MediaFileResult
+		err := p.budgetError()
+		if err == nil {
+			batchResults, err = p.llmClient.ProcessBatchFiles(ctx, llmFilenames, p.config.FileOps.DirectoryStructure)
+		}
+		if err != nil {
+			batchErr = err
+			log.Error().Err(err).Str("directory", dir).Msg("Failed to plan batch with LLM")
+		}
+		for _, result := range batchResults {
+			results[result.OriginalFilename] = result
+			identifiedBy[result.OriginalFilename] = "llm"
+		}
+	}
+
+	for _, file := range files {
+		filename := p.mediaName(file)
+		entry := PlanEntry{SourcePath: file, IdentifiedBy: identifiedBy[filename]}
+
+		result, ok := results[filename]
+		switch {
+		case ok:
+			p.planDestination(ctx, &entry, result)
+		case batchErr != nil:
+			entry.Error = fmt.Sprintf("LLM processing error: %v", batchErr)
+		default:
+			entry.Error = "No result found for this file in batch processing"
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// planDestination fetches the metadata of an identification and records the destination
+func (p *Processor) planDestination(ctx context.Context, entry *PlanEntry, result *llm.MediaFileResult) {
+	entry.Identification = result
+	entry.NeedsReview = p.needsReview(result)
+
+	mediaInfo := newMediaInfo(&models.MediaFile{OriginalPath: entry.SourcePath}, result)
+	_, destPath, _, err := p.resolveDestination(ctx, result, mediaInfo, entry.SourcePath)
+	if err != nil {
+		entry.Error = fmt.Sprintf("Generating destination path error: %v", err)
+		return
+	}
+
+	result.EpisodeTitle = mediaInfo.EpisodeTitle
+	entry.Destination = destPath
+}
+
+// ApplyPlan organises the files of a saved plan with their planned identifications,
+// without calling the LLM. Entries that failed to plan and files that have been
+// organised since are skipped, uncertain identifications are held for review.
+func (p *Processor) ApplyPlan(ctx context.Context, plan *Plan) []ApplyResult {
+	if plan.Mode != p.config.FileOps.Mode {
+		log.Warn().Str("plan", plan.Mode).Str("config", p.config.FileOps.Mode).Msg("Plan was made for a different file operation mode")
+	}
+
+	results := make([]ApplyResult, 0, len(plan.Entries))
+	for i := range plan.Entries {
+		results = append(results, p.applyEntry(ctx, &plan.Entries[i]))
+	}
+	return results
+}
+
+// applyEntry applies a single plan entry
+func (p *Processor) applyEntry(ctx context.Context, entry *PlanEntry) ApplyResult {
+	result := ApplyResult{SourcePath: entry.SourcePath, Status: "skipped"}
+	if entry.Error != "" || entry.Identification == nil {
+		result.Reason = "not planned: " + entry.Error
+		return result
+	}
+
+	mediaFile, err := p.planMediaFile(entry.SourcePath)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+
+	if entry.NeedsReview {
+		if err := p.holdForReview(ctx, mediaFile, entry.Identification); err != nil {
+			result.Status, result.Reason = "failed", err.Error()
+			return result
+		}
+		result.Status = mediaFile.Status
+		return result
+	}
+
+	if err := p.organise(ctx, mediaFile, entry.Identification); err != nil {
+		result.Status, result.Reason = "failed", err.Error()
+		return result
+	}
+
+	result.Status = mediaFile.Status
+	result.Destination = mediaFile.DestinationPath
+	if mediaFile.DestinationPath != entry.Destination {
+		log.Warn().
+			Str("planned", entry.Destination).
+			Str("actual", mediaFile.DestinationPath).
+			Msg("File organised to a different destination than planned")
+	}
+	return result
+}
+
+// mediaName returns the name a planned file is identified by, disc images are named
+// after their folder as the scanner does
+func (p *Processor) mediaName(path string) string {
+	return scanner.MediaName(path, p.config.Scanner.MediaDirs)
+}
+
+// planMediaFile returns the media file record of a planned file in processing state,
+// creating it if the file has not been seen by the scanner yet
+func (p *Processor) planMediaFile(path string) (*models.MediaFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file info: %w", err)
+	}
+
+	mediaFile, err := p.db.GetMediaFileByPath(path)
+	if err != nil {
+		mediaFile = &models.MediaFile{
+			OriginalPath:   path,
+			OriginalName:   p.mediaName(path),
+			FileSize:       info.Size(),
+			Status:         "processing",
+			LeaseOwner:     p.instanceID,
+			LeaseExpiresAt: time.Now().Add(p.leaseDuration()),
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+		if err := p.db.CreateMediaFile(mediaFile); err != nil {
+			return nil, fmt.Errorf("error creating media file record: %w", err)
+		}
+		return mediaFile, nil
+	}
+
+	if mediaFile.Status == "success" || mediaFile.Status == "processing" {
+		return nil, fmt.Errorf("media file is already %s", mediaFile.Status)
+	}
+
+	if err := p.claim(mediaFile, mediaFile.Status); err != nil {
+		return nil, err
+	}
+	return mediaFile, nil
+}
+
+// SavePlan writes a plan as JSON
+func SavePlan(plan *Plan, path string) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding plan: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing plan: %w", err)
+	}
+	return nil
+}
+
+// LoadPlan reads a plan written by SavePlan
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan: %w", err)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("error decoding plan: %w", err)
+	}
+	return &plan, nil
+}
@@ -0,0 +1,212 @@
+package processor
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/database/dbtest"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// newPlanTestProcessor returns a processor organising into a library under root, with the
+// parser disabled so that files are identified by the LLM served by handler
+func newPlanTestProcessor(t *testing.T, root string, answer dbtest.Answer, handler http.HandlerFunc) (*Processor, *dbtest.DB) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Parser.Enabled = false
+	cfg.LLM.APIKey = "test"
+	cfg.LLM.BaseURL = server.URL
+	cfg.LLM.MaxRetries = 0
+	cfg.FileOps.Mode = "copy"
+	cfg.FileOps.DestinationRoot = filepath.Join(root, "library")
+	cfg.FileOps.DirectoryStructure = map[string][]string{"Movies": nil, "TV": nil}
+	cfg.FileOps.FFprobePath = ""
+	cfg.FileOps.Artwork.Enabled = false
+
+	llmClient, err := llm.New(&cfg.LLM, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := dbtest.New(t, answer)
+	return New(cfg, db.Database, llmClient, nil, fileops.New(&cfg.FileOps), nil), db
+}
+
+// writeFiles creates files under root, each holding its name
+func writeFiles(t *testing.T, root string, names ...string) {
+	for _, name := range names {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// treeOf returns the paths under root with their contents
+func treeOf(t *testing.T, root string) map[string]string {
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		tree[path] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// chatAnswer writes a chat completion holding content
+func chatAnswer(w http.ResponseWriter, content string) {
+	_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	})
+}
+
+// TestPlanFiles tests that planning identifies files without touching the library, the
+// source files or the media files
+func TestPlanFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "downloads/Heat.1995.mkv", "downloads/Show/Show.S01E01.mkv", "downloads/Show/Show.S01E02.mkv")
+	before := treeOf(t, root)
+
+	p, db := newPlanTestProcessor(t, root, func(string, []driver.Value) *dbtest.Rows { return nil },
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), "Show.S01E02.mkv") {
+				chatAnswer(w, `{"results":[
+					{"original_filename":"Show.S01E01.mkv","title":"Show","year":2020,"media_type":"tv","category":"TV","season":1,"episode":1,"confidence":0.9},
+					{"original_filename":"Show.S01E02.mkv","title":"Show","year":2020,"media_type":"tv","category":"TV","season":1,"episode":2,"confidence":0.9}
+				]}`)
+				return
+			}
+			chatAnswer(w, `{"title":"Heat","year":1995,"media_type":"movie","category":"Movies","confidence":0.9}`)
+		})
+
+	heat := filepath.Join(root, "downloads", "Heat.1995.mkv")
+	show := filepath.Join(root, "downloads", "Show")
+	episodes := []string{filepath.Join(show, "Show.S01E01.mkv"), filepath.Join(show, "Show.S01E02.mkv")}
+	plan := p.PlanFiles(context.Background(), append([]string{heat}, episodes...), map[string][]string{show: episodes})
+
+	if len(plan.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(plan.Entries))
+	}
+	for _, entry := range plan.Entries {
+		if entry.Error != "" || entry.Destination == "" || entry.IdentifiedBy != "llm" {
+			t.Errorf("Expected %s to be planned by the LLM, got %+v", entry.SourcePath, entry)
+		}
+	}
+
+	after := treeOf(t, root)
+	if len(after) != len(before) {
+		t.Errorf("Expected the files %v, got %v", before, after)
+	}
+	for path, content := range before {
+		if after[path] != content {
+			t.Errorf("Expected %s to be left unchanged", path)
+		}
+	}
+
+	// Conversations with the LLM are recorded, nothing else is written
+	for _, statement := range db.Writes() {
+		if !strings.HasPrefix(statement.Query, `INSERT INTO "llm_requests"`) {
+			t.Errorf("Unexpected write while planning: %s", statement.Query)
+		}
+	}
+}
+
+// TestApplyPlan tests that applying a plan organises files with their planned identifications,
+// skips entries that failed to plan and files organised or in progress since, and holds
+// uncertain identifications for review
+func TestApplyPlan(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "downloads/Failed.mkv", "downloads/Done.mkv", "downloads/Busy.mkv", "downloads/Uncertain.mkv", "downloads/Heat.1995.mkv")
+	path := func(name string) string { return filepath.Join(root, "downloads", name) }
+
+	statuses := map[string]string{
+		path("Failed.mkv"):    "failed",
+		path("Done.mkv"):      "success",
+		path("Busy.mkv"):      "processing",
+		path("Uncertain.mkv"): "pending",
+		path("Heat.1995.mkv"): "pending",
+	}
+	var id int64
+	p, _ := newPlanTestProcessor(t, root, func(query string, args []driver.Value) *dbtest.Rows {
+		if !strings.Contains(query, "original_path = ") {
+			return nil
+		}
+		if status := statuses[args[0].(string)]; status != "" {
+			id++
+			return dbtest.RowsOf(&models.MediaFile{ID: id, OriginalPath: args[0].(string), Status: status})
+		}
+		return nil
+	}, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The LLM was called while applying a plan")
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+	})
+
+	movie := func(title string, confidence float64) *llm.MediaFileResult {
+		return &llm.MediaFileResult{Title: title, Year: 1995, MediaType: "movie", Category: "Movies", Confidence: confidence}
+	}
+	uncertain := movie("Uncertain", 0.3)
+	uncertain.Candidates = []llm.Candidate{{Title: "Uncertain Two", MediaType: "movie"}, {Title: "Uncertain Three", MediaType: "movie"}}
+	heatDest := filepath.Join(root, "library", "Movies", "Heat (1995)", "Heat (1995).mkv")
+	plan := &Plan{Mode: "copy", Entries: []PlanEntry{
+		{SourcePath: path("Failed.mkv"), Error: "LLM processing error: unavailable"},
+		{SourcePath: path("Done.mkv"), Identification: movie("Done", 0.9)},
+		{SourcePath: path("Busy.mkv"), Identification: movie("Busy", 0.9)},
+		{SourcePath: path("Uncertain.mkv"), Identification: uncertain, NeedsReview: true},
+		{SourcePath: path("Heat.1995.mkv"), Identification: movie("Heat", 0.9), Destination: heatDest},
+	}}
+
+	results := p.ApplyPlan(context.Background(), plan)
+
+	expected := map[string]string{
+		path("Failed.mkv"):    "skipped",
+		path("Done.mkv"):      "skipped",
+		path("Busy.mkv"):      "skipped",
+		path("Uncertain.mkv"): "manual",
+		path("Heat.1995.mkv"): "success",
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for _, result := range results {
+		if result.Status != expected[result.SourcePath] {
+			t.Errorf("Expected %s to be %s, got %s (%s)", result.SourcePath, expected[result.SourcePath], result.Status, result.Reason)
+		}
+	}
+
+	library := treeOf(t, filepath.Join(root, "library"))
+	if _, ok := library[heatDest]; !ok {
+		t.Errorf("Expected %s to be organised, got %v", heatDest, library)
+	}
+	for dest := range library {
+		if strings.HasSuffix(dest, ".mkv") && dest != heatDest {
+			t.Errorf("Unexpected file organised to %s", dest)
+		}
+	}
+}
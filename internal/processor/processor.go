@@ -3,9 +3,12 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -15,6 +18,8 @@ import (
 	"github.com/sleepstars/mediascanner/internal/fileops"
 	"github.com/sleepstars/mediascanner/internal/llm"
 	"github.com/sleepstars/mediascanner/internal/models"
+	"github.com/sleepstars/mediascanner/internal/naming"
+	"github.com/sleepstars/mediascanner/internal/nfo"
 	"github.com/sleepstars/mediascanner/internal/notification"
 	"github.com/sleepstars/mediascanner/internal/worker"
 )
@@ -28,17 +33,41 @@ type Processor struct {
 	fileOps    *fileops.FileOps
 	notifier   *notification.Notifier
 	workerPool worker.WorkerPool
+
+	// instanceID identifies this instance as the holder of leases on files and batches
+	instanceID string
+
+	// budgetMu guards the end of the window of an exhausted LLM budget and the IDs of the
+	// media files deferred until then
+	budgetMu      sync.Mutex
+	deferredUntil time.Time
+	deferred      map[int64]bool
+
+	// nfoMu serialises updates of shared NFO files such as tvshow.nfo
+	nfoMu sync.Mutex
+
+	// cleanupMu serialises the cleanup of download directories
+	cleanupMu sync.Mutex
+
+	// batchDone is called with the ID of a batch process once it has been processed
+	batchDone func(batchID int64)
 }
 
 // New creates a new processor
 func New(cfg *config.Config, db *database.Database, llmClient *llm.LLM, apiClient *api.API, fileOps *fileops.FileOps, notifier *notification.Notifier) *Processor {
 	p := &Processor{
-		config:    cfg,
-		db:        db,
-		llmClient: llmClient,
-		apiClient: apiClient,
-		fileOps:   fileOps,
-		notifier:  notifier,
+		config:     cfg,
+		db:         db,
+		llmClient:  llmClient,
+		apiClient:  apiClient,
+		fileOps:    fileOps,
+		notifier:   notifier,
+		instanceID: newInstanceID(),
+	}
+
+	// Record every conversation with the LLM
+	if llmClient != nil {
+		llmClient.SetRecorder(p.recordExchange)
 	}
 
 	// Create worker pool if enabled
@@ -84,64 +113,81 @@ func (p *Processor) handleProcessingError(mediaFile *models.MediaFile, err error
 func (p *Processor) ProcessMediaFile(ctx context.Context, mediaFile *models.MediaFile) error {
 	log.Info().Str("file", mediaFile.OriginalPath).Msg("Starting media file processing")
 
-	// Update status to processing
-	mediaFile.Status = "processing"
-	mediaFile.UpdatedAt = time.Now()
-	if err := p.db.UpdateMediaFile(mediaFile); err != nil {
-		return fmt.Errorf("error updating media file status: %w", err)
+	// Claim the file, it may have been picked up by another worker or instance in the meantime
+	if err := p.claim(mediaFile, "pending"); err != nil {
+		if errors.Is(err, errClaimed) {
+			log.Info().Str("file", mediaFile.OriginalPath).Msg("Media file is no longer pending, skipping")
+			return nil
+		}
+		return err
 	}
 
-	// Register API function handlers
-	p.registerFunctionHandlers()
+	// Try the local filename parser first, fall back to the LLM
+	result := p.identifyLocally(ctx, mediaFile.OriginalName)
+	if result == nil {
+		// Register API function handlers
+		p.registerFunctionHandlers()
 
-	// Process the file with LLM
-	result, err := p.llmClient.ProcessMediaFile(ctx, mediaFile.OriginalName, p.config.FileOps.DirectoryStructure)
-	if err != nil {
-		return p.handleProcessingError(mediaFile, err, "LLM processing")
+		// Files needing the LLM wait for the next budget window
+		if until := p.LLMDeferredUntil(); !until.IsZero() {
+			return p.deferFile(mediaFile, until)
+		}
+
+		// Process the file with LLM
+		var err error
+		result, err = p.llmClient.ProcessMediaFile(withLLMSubject(ctx, mediaFile.ID, 0), mediaFile.OriginalName, p.config.FileOps.DirectoryStructure)
+		if err != nil {
+			return p.handleProcessingError(mediaFile, err, "LLM processing")
+		}
 	}
 
-	// Create media info record
-	mediaInfo := &models.MediaInfo{
-		MediaFileID:   mediaFile.ID,
-		Title:         result.Title,
-		OriginalTitle: result.OriginalTitle,
-		Year:          result.Year,
-		MediaType:     result.MediaType,
-		Season:        result.Season,
-		Episode:       result.Episode,
-		EpisodeTitle:  result.EpisodeTitle,
-		TMDBID:        result.TMDBID,
-		TVDBID:        result.TVDBID,
-		BangumiID:     result.BangumiID,
-		ImdbID:        result.ImdbID,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
-	}
-
-	if err := p.db.CreateMediaInfo(mediaInfo); err != nil {
-		return p.handleProcessingError(mediaFile, err, "Creating media info record")
+	// Uncertain identifications are held for manual review instead of organising the file
+	if p.needsReview(result) {
+		return p.holdForReview(ctx, mediaFile, result)
 	}
 
-	// Fetch additional metadata
-	if err := p.fetchAdditionalMetadata(ctx, mediaInfo); err != nil {
-		log.Warn().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to fetch additional metadata")
+	return p.organise(ctx, mediaFile, result)
+}
+
+// organise stores the identification of a media file, fetches its metadata and moves the
+// file into the library. It is shared by automatic processing and manual review.
+func (p *Processor) organise(ctx context.Context, mediaFile *models.MediaFile, result *llm.MediaFileResult) error {
+	// Create media info record
+	mediaInfo := newMediaInfo(mediaFile, result)
+	if err := p.storeMediaInfo(mediaInfo); err != nil {
+		return p.handleProcessingError(mediaFile, err, "Creating media info record")
 	}
 
-	// Generate destination path
-	destPath, err := p.generateDestinationPath(result)
+	// Fetch additional metadata and generate destination path
+	details, destPath, showDir, err := p.resolveDestination(ctx, result, mediaInfo, mediaFile.OriginalPath)
 	if err != nil {
 		return p.handleProcessingError(mediaFile, err, "Generating destination path")
 	}
 
+	// Save the fetched metadata
+	if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
+		log.Warn().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to save additional metadata")
+	}
+
 	// Process the file
-	destFilePath, err := p.fileOps.ProcessFile(mediaFile.OriginalPath, destPath)
+	placed, err := p.placeFile(ctx, mediaFile, destPath)
 	if err != nil {
 		return p.handleProcessingError(mediaFile, err, "Processing file")
 	}
+	if placed.Result == nil {
+		return p.skipFile(mediaFile, placed.Skipped)
+	}
+	fileResult := placed.Result
+
+	// Record the operation so that it can be undone, and organise the sidecar files with it
+	operation := p.recordOperation(mediaFile, 0, placed)
+	p.recordCompanions(operation, p.organiseCompanions(mediaInfo.MediaType, fileResult))
 
 	// Update media file record
-	mediaFile.DestinationPath = destFilePath
+	mediaFile.DestinationPath = fileResult.Destination
+	mediaFile.MediaType = mediaInfo.MediaType
 	mediaFile.Status = "success"
+	mediaFile.ErrorMessage = ""
 	mediaFile.ProcessedAt = time.Now()
 	mediaFile.UpdatedAt = time.Now()
 	if err := p.db.UpdateMediaFile(mediaFile); err != nil {
@@ -149,9 +195,14 @@ func (p *Processor) ProcessMediaFile(ctx context.Context, mediaFile *models.Medi
 	}
 
 	// Create NFO files and download images
-	if err := p.createMetadataFiles(ctx, mediaFile, mediaInfo, result); err != nil {
+	sidecars, err := p.createMetadataFiles(ctx, mediaFile, mediaInfo, details, showDir)
+	if err != nil {
 		log.Warn().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to create metadata files")
 	}
+	p.recordSidecars(operation, sidecars)
+
+	// Clean up the download directory once everything in it has been moved
+	p.cleanupSource(mediaFile, fileResult)
 
 	// Create success notification
 	if err := p.createSuccessNotification(mediaFile, mediaInfo); err != nil {
@@ -165,19 +216,32 @@ func (p *Processor) ProcessMediaFile(ctx context.Context, mediaFile *models.Medi
 	return nil
 }
 
-// ProcessBatchFiles processes a batch of media files
+// ProcessBatchFiles processes a batch of media files. An interrupted batch is resumed with
+// the files that have not been processed yet.
 func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.BatchProcess) error {
 	log.Printf("Processing batch: %s (%d files)", batchProcess.Directory, batchProcess.FileCount)
 
-	// Update status to processing
-	batchProcess.Status = "processing"
-	batchProcess.UpdatedAt = time.Now()
-	if err := p.db.UpdateBatchProcess(batchProcess); err != nil {
-		return fmt.Errorf("error updating batch process status: %w", err)
+	// Tell the dispatcher when the batch ends, unless it is deferred and resumed later.
+	// A batch that cannot be claimed has ended here as well.
+	deferred := false
+	defer func() {
+		if !deferred && p.batchDone != nil {
+			p.batchDone(batchProcess.ID)
+		}
+	}()
+
+	// Claim the batch, it may be processed by another instance
+	claimed, err := p.claimBatch(batchProcess)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Printf("Batch %d is not pending anymore, skipping", batchProcess.ID)
+		return nil
 	}
 
 	// Get batch process files
-	batchFiles, err := p.db.GetBatchProcessFilesByBatchID(batchProcess.ID)
+	allBatchFiles, err := p.db.GetBatchProcessFilesByBatchID(batchProcess.ID)
 	if err != nil {
 		batchProcess.Status = "failed"
 		batchProcess.UpdatedAt = time.Now()
@@ -185,55 +249,116 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 		return fmt.Errorf("error getting batch process files: %w", err)
 	}
 
-	// Get media files
-	mediaFiles := make([]*models.MediaFile, 0, len(batchFiles))
-	filenames := make([]string, 0, len(batchFiles))
-	for _, batchFile := range batchFiles {
+	// Get media files that still need processing
+	batchFiles := make([]models.BatchProcessFile, 0, len(allBatchFiles))
+	mediaFiles := make([]*models.MediaFile, 0, len(allBatchFiles))
+	filenames := make([]string, 0, len(allBatchFiles))
+	for _, batchFile := range allBatchFiles {
+		if batchFileDone(batchFile.Status) {
+			continue
+		}
 		mediaFile, err := p.db.GetMediaFileByID(batchFile.MediaFileID)
 		if err != nil {
 			log.Printf("Error getting media file %d: %v", batchFile.MediaFileID, err)
 			continue
 		}
+		if mediaFile.Status != "pending" && mediaFile.Status != "processing" {
+			// Settled before the batch was interrupted, or outside of the batch
+			batchFile.Status = mediaFile.Status
+			batchFile.UpdatedAt = time.Now()
+			_ = p.db.UpdateBatchProcessFile(&batchFile)
+			continue
+		}
+		if mediaFile.Status == "processing" && mediaFile.LeaseExpiresAt.After(time.Now()) {
+			// Being processed under a live lease. Should that lease expire, the file is
+			// released and picked up on its own.
+			log.Printf("Media file %s is being processed elsewhere, leaving it out of the batch", mediaFile.OriginalPath)
+			continue
+		}
+		batchFiles = append(batchFiles, batchFile)
 		mediaFiles = append(mediaFiles, mediaFile)
 		filenames = append(filenames, mediaFile.OriginalName)
 	}
-
-	// Register API function handlers
-	p.registerFunctionHandlers()
-
-	// Process the files with LLM
-	results, err := p.llmClient.ProcessBatchFiles(ctx, filenames, p.config.FileOps.DirectoryStructure)
-	if err != nil {
-		batchProcess.Status = "failed"
-		batchProcess.UpdatedAt = time.Now()
-		_ = p.db.UpdateBatchProcess(batchProcess)
-		return fmt.Errorf("error processing batch files with LLM: %w", err)
+	if len(mediaFiles) < len(allBatchFiles) {
+		log.Info().
+			Int64("batch_id", batchProcess.ID).
+			Int("remaining", len(mediaFiles)).
+			Int("total", len(allBatchFiles)).
+			Msg("Resuming batch with the files not processed yet")
 	}
 
-	// Create a map of results by filename
+	// Identify files with the local filename parser first
+	var llmErr error
 	resultMap := make(map[string]*llm.MediaFileResult)
-	for _, result := range results {
-		resultMap[result.OriginalFilename] = result
+	llmFilenames := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		if result := p.identifyLocally(ctx, filename); result != nil {
+			resultMap[filename] = result
+			continue
+		}
+		llmFilenames = append(llmFilenames, filename)
 	}
 
+	// Process the remaining files with LLM
+	if len(llmFilenames) > 0 {
+		// The batch waits for the next budget window and is resumed by the recovery
+		if until := p.LLMDeferredUntil(); !until.IsZero() {
+			deferred = true
+			return p.deferBatch(batchProcess, until)
+		}
+
+		// Register API function handlers
+		p.registerFunctionHandlers()
+
+		results, err := p.llmClient.ProcessBatchFiles(withLLMSubject(ctx, 0, batchProcess.ID), llmFilenames, p.config.FileOps.DirectoryStructure)
+		if err != nil {
+			// Interrupted batches are resumed, otherwise the files without a result fail below
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Error processing batch files with LLM: %v", err)
+			llmErr = err
+		}
+
+		// Add the results by filename
+		for _, result := range results {
+			resultMap[result.OriginalFilename] = result
+		}
+	}
+
+	log.Info().
+		Int("local", len(filenames)-len(llmFilenames)).
+		Int("llm", len(llmFilenames)).
+		Str("directory", batchProcess.Directory).
+		Msg("Batch files identified")
+
 	// Process each file
 	for i, mediaFile := range mediaFiles {
 		batchFile := batchFiles[i]
 
-		// Update status to processing
-		mediaFile.Status = "processing"
-		mediaFile.UpdatedAt = time.Now()
-		if err := p.db.UpdateMediaFile(mediaFile); err != nil {
-			log.Printf("Error updating media file status: %v", err)
+		// Stop between files when shutting down, the rest of the batch is resumed later
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Claim the file, it may have been picked up on its own in the meantime. Files left
+		// processing by an interrupted batch are claimed once their lease has expired.
+		if err := p.claim(mediaFile, "pending"); err != nil {
+			log.Printf("Skipping media file %s: %v", mediaFile.OriginalPath, err)
 			continue
 		}
 
 		// Get result for this file
 		result, ok := resultMap[mediaFile.OriginalName]
 		if !ok {
+			errorMessage := "No result found for this file in batch processing"
+			if llmErr != nil {
+				errorMessage = fmt.Sprintf("LLM processing error: %v", llmErr)
+			}
+
 			// Update status to failed
 			mediaFile.Status = "failed"
-			mediaFile.ErrorMessage = "No result found for this file in batch processing"
+			mediaFile.ErrorMessage = errorMessage
 			mediaFile.UpdatedAt = time.Now()
 			_ = p.db.UpdateMediaFile(mediaFile)
 
@@ -243,29 +368,26 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 			_ = p.db.UpdateBatchProcessFile(&batchFile)
 
 			// Create notification
-			_ = p.createErrorNotification(mediaFile, "No result found for this file in batch processing")
+			_ = p.createErrorNotification(mediaFile, errorMessage)
+			continue
+		}
+
+		// Uncertain identifications are held for manual review instead of organising the file
+		if p.needsReview(result) {
+			if err := p.holdForReview(ctx, mediaFile, result); err != nil {
+				log.Printf("Error holding media file for review: %v", err)
+			}
+
+			// Update batch file status
+			batchFile.Status = mediaFile.Status
+			batchFile.UpdatedAt = time.Now()
+			_ = p.db.UpdateBatchProcessFile(&batchFile)
 			continue
 		}
 
 		// Create media info record
-		mediaInfo := &models.MediaInfo{
-			MediaFileID:   mediaFile.ID,
-			Title:         result.Title,
-			OriginalTitle: result.OriginalTitle,
-			Year:          result.Year,
-			MediaType:     result.MediaType,
-			Season:        result.Season,
-			Episode:       result.Episode,
-			EpisodeTitle:  result.EpisodeTitle,
-			TMDBID:        result.TMDBID,
-			TVDBID:        result.TVDBID,
-			BangumiID:     result.BangumiID,
-			ImdbID:        result.ImdbID,
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
-		}
-
-		if err := p.db.CreateMediaInfo(mediaInfo); err != nil {
+		mediaInfo := newMediaInfo(mediaFile, result)
+		if err := p.storeMediaInfo(mediaInfo); err != nil {
 			// Update status to failed
 			mediaFile.Status = "failed"
 			mediaFile.ErrorMessage = fmt.Sprintf("Error creating media info record: %v", err)
@@ -282,13 +404,8 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 			continue
 		}
 
-		// Fetch additional metadata
-		if err := p.fetchAdditionalMetadata(ctx, mediaInfo); err != nil {
-			log.Printf("Warning: Error fetching additional metadata for %s: %v", mediaFile.OriginalPath, err)
-		}
-
-		// Generate destination path
-		destPath, err := p.generateDestinationPath(result)
+		// Fetch additional metadata and generate destination path
+		details, destPath, showDir, err := p.resolveDestination(ctx, result, mediaInfo, mediaFile.OriginalPath)
 		if err != nil {
 			// Update status to failed
 			mediaFile.Status = "failed"
@@ -306,8 +423,13 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 			continue
 		}
 
+		// Save the fetched metadata
+		if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
+			log.Printf("Warning: Error saving additional metadata for %s: %v", mediaFile.OriginalPath, err)
+		}
+
 		// Process the file
-		destFilePath, err := p.fileOps.ProcessFile(mediaFile.OriginalPath, destPath)
+		placed, err := p.placeFile(ctx, mediaFile, destPath)
 		if err != nil {
 			// Update status to failed
 			mediaFile.Status = "failed"
@@ -325,9 +447,27 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 			continue
 		}
 
+		if placed.Result == nil {
+			if err := p.skipFile(mediaFile, placed.Skipped); err != nil {
+				log.Printf("Error skipping media file: %v", err)
+			}
+
+			// Update batch file status
+			batchFile.Status = "skipped"
+			batchFile.UpdatedAt = time.Now()
+			_ = p.db.UpdateBatchProcessFile(&batchFile)
+			continue
+		}
+		fileResult := placed.Result
+
+		// Record the operation so that it can be undone, and organise the sidecar files with it
+		operation := p.recordOperation(mediaFile, batchProcess.ID, placed)
+		p.recordCompanions(operation, p.organiseCompanions(mediaInfo.MediaType, fileResult))
+
 		// Update media file record
-		mediaFile.DestinationPath = destFilePath
+		mediaFile.DestinationPath = fileResult.Destination
 		mediaFile.Status = "success"
+		mediaFile.ErrorMessage = ""
 		mediaFile.ProcessedAt = time.Now()
 		mediaFile.UpdatedAt = time.Now()
 		if err := p.db.UpdateMediaFile(mediaFile); err != nil {
@@ -342,9 +482,14 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 		}
 
 		// Create NFO files and download images
-		if err := p.createMetadataFiles(ctx, mediaFile, mediaInfo, result); err != nil {
+		sidecars, err := p.createMetadataFiles(ctx, mediaFile, mediaInfo, details, showDir)
+		if err != nil {
 			log.Printf("Warning: Error creating metadata files for %s: %v", mediaFile.OriginalPath, err)
 		}
+		p.recordSidecars(operation, sidecars)
+
+		// Clean up the download directory once everything in it has been moved
+		p.cleanupSource(mediaFile, fileResult)
 
 		// Create success notification
 		_ = p.createSuccessNotification(mediaFile, mediaInfo)
@@ -354,16 +499,31 @@ func (p *Processor) ProcessBatchFiles(ctx context.Context, batchProcess *models.
 
 	// Update batch process status
 	batchProcess.Status = "completed"
+	if llmErr != nil {
+		batchProcess.Status = "failed"
+	}
 	batchProcess.CompletedAt = time.Now()
 	batchProcess.UpdatedAt = time.Now()
 	if err := p.db.UpdateBatchProcess(batchProcess); err != nil {
 		return fmt.Errorf("error updating batch process status: %w", err)
 	}
+	if llmErr != nil {
+		return fmt.Errorf("error processing batch files with LLM: %w", llmErr)
+	}
 
 	log.Printf("Successfully processed batch: %s", batchProcess.Directory)
 	return nil
 }
 
+// batchFileDone reports whether a batch file has been processed
+func batchFileDone(status string) bool {
+	switch status {
+	case "success", "failed", "manual", "skipped":
+		return true
+	}
+	return false
+}
+
 // registerFunctionHandlers registers the function handlers for the LLM
 func (p *Processor) registerFunctionHandlers() {
 	// Register TMDB search function
@@ -427,14 +587,40 @@ func (p *Processor) registerFunctionHandlers() {
 	})
 }
 
-// fetchAdditionalMetadata fetches additional metadata for a media file
-func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *models.MediaInfo) error {
+// resolveDestination fetches the metadata of an identification and generates the destination path
+// and show directory. Nothing is saved or written, so it is shared by organising files and planning.
+func (p *Processor) resolveDestination(ctx context.Context, result *llm.MediaFileResult, mediaInfo *models.MediaInfo, sourcePath string) (details *api.MediaDetails, destPath, showDir string, err error) {
+	// Fetch additional metadata
+	details, err = p.fetchAdditionalMetadata(ctx, mediaInfo)
+	if err != nil {
+		log.Warn().Err(err).Str("file", sourcePath).Msg("Failed to fetch additional metadata")
+	}
+
+	// Identifications given by ID only take the title and category from the metadata
+	if err := p.completeIdentification(result, mediaInfo, details); err != nil {
+		return details, "", "", err
+	}
+
+	destPath, showDir, err = p.generateDestinationPath(result, mediaInfo, sourcePath)
+	if err != nil {
+		return details, "", "", err
+	}
+	return details, destPath, showDir, nil
+}
+
+// fetchAdditionalMetadata fetches additional metadata for a media file into its media info,
+// which is not saved. The returned details are never nil and hold whatever was fetched
+// before an error occurred.
+func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *models.MediaInfo) (*api.MediaDetails, error) {
+	details := &api.MediaDetails{}
+
 	if mediaInfo.MediaType == "movie" && mediaInfo.TMDBID > 0 {
 		// Fetch movie details from TMDB
 		movie, err := p.apiClient.TMDB.GetMovieDetails(ctx, int(mediaInfo.TMDBID))
 		if err != nil {
-			return fmt.Errorf("error fetching movie details from TMDB: %w", err)
+			return details, fmt.Errorf("error fetching movie details from TMDB: %w", err)
 		}
+		details.Movie = movie
 
 		// Update media info
 		mediaInfo.Overview = movie.Overview
@@ -444,18 +630,14 @@ func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *mode
 		mediaInfo.Countries = strings.Join(movie.Countries, ",")
 		mediaInfo.Languages = strings.Join(movie.Languages, ",")
 		mediaInfo.ImdbID = movie.ImdbID
-
-		// Save to database
-		if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-			return fmt.Errorf("error updating media info: %w", err)
-		}
 	} else if mediaInfo.MediaType == "tv" {
 		if mediaInfo.TMDBID > 0 {
 			// Fetch TV show details from TMDB
 			tv, err := p.apiClient.TMDB.GetTVDetails(ctx, int(mediaInfo.TMDBID))
 			if err != nil {
-				return fmt.Errorf("error fetching TV show details from TMDB: %w", err)
+				return details, fmt.Errorf("error fetching TV show details from TMDB: %w", err)
 			}
+			details.TVShow = tv
 
 			// Update media info
 			mediaInfo.Overview = tv.Overview
@@ -464,12 +646,11 @@ func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *mode
 			mediaInfo.Genres = strings.Join(tv.Genres, ",")
 			mediaInfo.Countries = strings.Join(tv.Countries, ",")
 			mediaInfo.Languages = strings.Join(tv.Languages, ",")
-			mediaInfo.ImdbID = tv.ImdbID
-			mediaInfo.TVDBID = int64(tv.TVDBID)
-
-			// Save to database
-			if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-				return fmt.Errorf("error updating media info: %w", err)
+			if tv.ImdbID != "" {
+				mediaInfo.ImdbID = tv.ImdbID
+			}
+			if tv.TVDBID > 0 {
+				mediaInfo.TVDBID = int64(tv.TVDBID)
 			}
 
 			// Fetch season details if available
@@ -478,25 +659,22 @@ func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *mode
 				if err != nil {
 					log.Printf("Warning: Error fetching season details from TMDB: %v", err)
 				} else {
-					// Find episode
+					details.Season = season
+					// Find the episodes of the file
+					titles := make(map[int]string)
 					for _, episode := range season.Episodes {
-						if episode.EpisodeNumber == mediaInfo.Episode {
-							mediaInfo.EpisodeTitle = episode.Name
-							// Save to database
-							if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-								log.Printf("Warning: Error updating media info with episode title: %v", err)
-							}
-							break
-						}
+						titles[episode.EpisodeNumber] = episode.Name
 					}
+					mediaInfo.EpisodeTitle = episodeTitle(mediaInfo, titles)
 				}
 			}
 		} else if mediaInfo.TVDBID > 0 {
 			// Fetch TV show details from TVDB
 			tv, err := p.apiClient.TVDB.GetSeriesDetails(ctx, int(mediaInfo.TVDBID))
 			if err != nil {
-				return fmt.Errorf("error fetching TV show details from TVDB: %w", err)
+				return details, fmt.Errorf("error fetching TV show details from TVDB: %w", err)
 			}
+			details.TVDBSeries = tv
 
 			// Update media info
 			mediaInfo.Overview = tv.Overview
@@ -505,11 +683,6 @@ func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *mode
 			mediaInfo.Languages = strings.Join(tv.Languages, ",")
 			mediaInfo.ImdbID = tv.ImdbID
 
-			// Save to database
-			if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-				return fmt.Errorf("error updating media info: %w", err)
-			}
-
 			// Find season
 			var seasonID int
 			for _, season := range tv.Seasons {
@@ -525,87 +698,313 @@ func (p *Processor) fetchAdditionalMetadata(ctx context.Context, mediaInfo *mode
 				if err != nil {
 					log.Printf("Warning: Error fetching season episodes from TVDB: %v", err)
 				} else {
-					// Find episode
+					details.TVDBSeason = seasonEpisodes
+					// Find the episodes of the file
+					titles := make(map[int]string)
 					for _, episode := range seasonEpisodes.Episodes {
-						if episode.EpisodeNumber == mediaInfo.Episode && episode.SeasonNumber == mediaInfo.Season {
-							mediaInfo.EpisodeTitle = episode.Name
-							// Save to database
-							if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-								log.Printf("Warning: Error updating media info with episode title: %v", err)
-							}
-							break
+						if episode.SeasonNumber == mediaInfo.Season {
+							titles[episode.EpisodeNumber] = episode.Name
 						}
 					}
+					mediaInfo.EpisodeTitle = episodeTitle(mediaInfo, titles)
 				}
 			}
 		} else if mediaInfo.BangumiID > 0 {
 			// Fetch anime details from Bangumi
 			anime, err := p.apiClient.Bangumi.GetAnimeDetails(ctx, int(mediaInfo.BangumiID))
 			if err != nil {
-				return fmt.Errorf("error fetching anime details from Bangumi: %w", err)
+				return details, fmt.Errorf("error fetching anime details from Bangumi: %w", err)
 			}
+			details.Bangumi = anime
 
 			// Update media info
 			mediaInfo.Overview = anime.Summary
 			mediaInfo.Genres = strings.Join(anime.Tags, ",")
 
-			// Save to database
-			if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-				return fmt.Errorf("error updating media info: %w", err)
-			}
-
-			// Find episode
+			// Find the episodes of the file
 			if mediaInfo.Episode > 0 && len(anime.Episodes) > 0 {
+				titles := make(map[int]string)
 				for _, episode := range anime.Episodes {
-					if episode.Sort == mediaInfo.Episode {
-						if episode.NameCN != "" {
-							mediaInfo.EpisodeTitle = episode.NameCN
-						} else {
-							mediaInfo.EpisodeTitle = episode.Name
-						}
-						// Save to database
-						if err := p.db.UpdateMediaInfo(mediaInfo); err != nil {
-							log.Printf("Warning: Error updating media info with episode title: %v", err)
-						}
-						break
+					if episode.NameCN != "" {
+						titles[episode.Sort] = episode.NameCN
+					} else {
+						titles[episode.Sort] = episode.Name
 					}
 				}
+				mediaInfo.EpisodeTitle = episodeTitle(mediaInfo, titles)
 			}
 		}
 	}
 
-	return nil
+	return details, nil
 }
 
-// generateDestinationPath generates the destination path for a media file
-func (p *Processor) generateDestinationPath(result *llm.MediaFileResult) (string, error) {
+// episodeNumbers returns the episodes held by a file, e.g. 1 and 2 for "S01E01-E02"
+func episodeNumbers(mediaInfo *models.MediaInfo) []int {
+	numbers := []int{mediaInfo.Episode}
+	for n := mediaInfo.Episode + 1; n <= mediaInfo.EndEpisode; n++ {
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// episodeTitle joins the titles of the episodes held by a file, keeping the current title
+// when none of them is known
+func episodeTitle(mediaInfo *models.MediaInfo, titles map[int]string) string {
+	var names []string
+	for _, n := range episodeNumbers(mediaInfo) {
+		if title := titles[n]; title != "" {
+			names = append(names, title)
+		}
+	}
+	if len(names) == 0 {
+		return mediaInfo.EpisodeTitle
+	}
+	return strings.Join(names, " + ")
+}
+
+// generateDestinationPath generates the destination file path for a media file from the naming templates,
+// and for TV shows the show directory, which is empty for movies. The media info is used for the
+// template fields as it holds the metadata fetched after identification.
+func (p *Processor) generateDestinationPath(result *llm.MediaFileResult, mediaInfo *models.MediaInfo, sourcePath string) (string, string, error) {
 	// Get destination root
 	destRoot := p.config.FileOps.DestinationRoot
 	if destRoot == "" {
-		return "", fmt.Errorf("destination root is not configured")
+		return "", "", fmt.Errorf("destination root is not configured")
+	}
+
+	fields := namingFields(result, mediaInfo, sourcePath)
+	base := []string{destRoot}
+	for _, dir := range []string{result.Category, result.Subcategory} {
+		if dir = naming.SanitizeComponent(dir); dir != "" {
+			base = append(base, dir)
+		}
 	}
 
 	// Build path based on media type
-	var destPath string
-	if result.MediaType == "movie" {
+	var components []string
+	var showDir string
+	switch mediaInfo.MediaType {
+	case "movie":
 		// Movie path: /DestinationRoot/Category/Subcategory/Title (Year)/Title (Year).ext
-		destPath = filepath.Join(destRoot, result.Category, result.Subcategory, fmt.Sprintf("%s (%d)", result.Title, result.Year))
-	} else if result.MediaType == "tv" {
+		tmpl := templateOrDefault(p.config.FileOps.MovieTemplate, "{title} ({year})")
+		movie, err := naming.RenderPath(tmpl, fields)
+		if err != nil {
+			return "", "", fmt.Errorf("error rendering movie template: %w", err)
+		}
+		if len(movie) == 1 {
+			// A single component names both the directory and the file
+			movie = append(movie, movie[0])
+		}
+		if fields.Part > 0 && !strings.Contains(tmpl, "{part") {
+			// Parts of a movie share its directory, e.g. "Title (Year) - part1.ext"
+			movie[len(movie)-1] += fmt.Sprintf(" - part%d", fields.Part)
+		}
+		components = movie
+	case "tv":
 		// TV show path: /DestinationRoot/Category/Subcategory/Title (Year)/Season X/Title - SXXEXX - Episode Title.ext
-		showDir := filepath.Join(destRoot, result.Category, result.Subcategory, fmt.Sprintf("%s (%d)", result.Title, result.Year))
-		seasonDir := filepath.Join(showDir, fmt.Sprintf("Season %d", result.Season))
-		destPath = seasonDir
-	} else {
-		return "", fmt.Errorf("unknown media type: %s", result.MediaType)
+		show, err := naming.RenderPath(templateOrDefault(p.config.FileOps.TVShowTemplate, "{title} ({year})"), fields)
+		if err != nil {
+			return "", "", fmt.Errorf("error rendering TV show template: %w", err)
+		}
+		// The season template may render to no directory, placing episodes in the show directory
+		season, err := naming.RenderDirs(templateOrDefault(p.config.FileOps.SeasonTemplate, "Season {season}"), fields)
+		if err != nil {
+			return "", "", fmt.Errorf("error rendering season template: %w", err)
+		}
+		episode, err := naming.RenderPath(templateOrDefault(p.config.FileOps.EpisodeTemplate, "{title} - S{season:02d}E{episode:02d} - {episode_title}"), fields)
+		if err != nil {
+			return "", "", fmt.Errorf("error rendering episode template: %w", err)
+		}
+		components = append(append(show, season...), episode...)
+		showDir = filepath.Join(append(base, show...)...)
+	default:
+		return "", "", fmt.Errorf("unknown media type: %s", mediaInfo.MediaType)
 	}
 
-	return destPath, nil
+	components[len(components)-1] += fields.Ext
+	destPath := filepath.Join(append(base, components...)...)
+
+	// Disc folders are organised into a directory: the movie directory, or a directory
+	// named like the episode file
+	if isDir(sourcePath) && mediaInfo.MediaType == "movie" && fields.Part == 0 {
+		return filepath.Dir(destPath), "", nil
+	}
+	return destPath, showDir, nil
 }
 
-// createMetadataFiles creates NFO files and downloads images for a media file
-func (p *Processor) createMetadataFiles(ctx context.Context, mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, result *llm.MediaFileResult) error {
-	// TODO: Implement NFO file generation and image downloading
-	return nil
+// isDir reports whether a path is a directory, such as a Blu-ray or DVD disc folder
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// namingFields returns the naming template fields for a media file
+func namingFields(result *llm.MediaFileResult, mediaInfo *models.MediaInfo, sourcePath string) *naming.Fields {
+	ext := filepath.Ext(sourcePath)
+	if isDir(sourcePath) {
+		// Disc folder names have no extension, "Movie.2020.BluRay" ends in a tag
+		ext = ""
+	}
+	return &naming.Fields{
+		Title:         mediaInfo.Title,
+		OriginalTitle: mediaInfo.OriginalTitle,
+		Year:          mediaInfo.Year,
+		MediaType:     mediaInfo.MediaType,
+		Season:        mediaInfo.Season,
+		Episode:       mediaInfo.Episode,
+		EndEpisode:    mediaInfo.EndEpisode,
+		Part:          mediaInfo.Part,
+		EpisodeTitle:  mediaInfo.EpisodeTitle,
+		TMDBID:        mediaInfo.TMDBID,
+		TVDBID:        mediaInfo.TVDBID,
+		BangumiID:     mediaInfo.BangumiID,
+		ImdbID:        mediaInfo.ImdbID,
+		Category:      result.Category,
+		Subcategory:   result.Subcategory,
+		Resolution:    naming.Resolution(sourcePath),
+		Ext:           ext,
+	}
+}
+
+// templateOrDefault returns the configured template, or the default when none is configured
+func templateOrDefault(tmpl, def string) string {
+	if strings.TrimSpace(tmpl) == "" {
+		return def
+	}
+	return tmpl
+}
+
+// createMetadataFiles creates NFO files and downloads images for a media file, the show files of
+// TV shows in showDir. It returns the files that did not exist before, also when an error occurs.
+func (p *Processor) createMetadataFiles(ctx context.Context, mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, details *api.MediaDetails, showDir string) ([]string, error) {
+	if mediaFile.DestinationPath == "" {
+		return nil, fmt.Errorf("media file has no destination path")
+	}
+
+	// A movie disc folder is the movie directory, its metadata is named movie.nfo inside it.
+	// An episode disc folder is named like an episode file, its metadata lies next to it.
+	if mediaInfo.MediaType == "movie" && isDir(mediaFile.DestinationPath) {
+		disc := *mediaFile
+		disc.DestinationPath = filepath.Join(mediaFile.DestinationPath, "movie")
+		mediaFile = &disc
+	}
+
+	var created []string
+	record := func(path string) {
+		if path != "" {
+			created = append(created, path)
+		}
+	}
+
+	switch mediaInfo.MediaType {
+	case "movie":
+		path, err := p.createMovieNFO(mediaFile, mediaInfo, details)
+		record(path)
+		if err != nil {
+			return created, err
+		}
+	case "tv":
+		path, err := p.createTVShowNFO(showDir, mediaInfo, details)
+		record(path)
+		if err != nil {
+			return created, err
+		}
+		path, err = p.createEpisodeNFO(mediaFile, mediaInfo, details)
+		record(path)
+		if err != nil {
+			return created, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown media type: %s", mediaInfo.MediaType)
+	}
+
+	downloaded, err := p.downloadArtwork(ctx, mediaFile, mediaInfo, details, showDir)
+	return append(created, downloaded...), err
+}
+
+// createMovieNFO writes the movie NFO next to the movie file and returns its path if it is new
+func (p *Processor) createMovieNFO(mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, details *api.MediaDetails) (string, error) {
+	content, err := nfo.Marshal(nfo.NewMovie(mediaInfo, details))
+	if err != nil {
+		return "", err
+	}
+
+	nfoPath := nfoPathFor(mediaFile.DestinationPath)
+	created, err := p.fileOps.CreateNFOFile(nfoPath, content)
+	if err != nil {
+		return "", fmt.Errorf("error writing movie NFO: %w", err)
+	}
+
+	log.Debug().Str("nfo", nfoPath).Msg("Movie NFO created")
+	return createdPath(nfoPath, created), nil
+}
+
+// createTVShowNFO writes tvshow.nfo in the show directory, merging it with an existing one.
+// It returns the path of the NFO if it is new.
+func (p *Processor) createTVShowNFO(showDir string, mediaInfo *models.MediaInfo, details *api.MediaDetails) (string, error) {
+	if showDir == "" {
+		return "", fmt.Errorf("TV show has no show directory")
+	}
+	nfoPath := filepath.Join(showDir, "tvshow.nfo")
+
+	// Episodes of the same show may be processed concurrently
+	p.nfoMu.Lock()
+	defer p.nfoMu.Unlock()
+
+	show := nfo.NewTVShow(mediaInfo, details)
+	if data, err := os.ReadFile(nfoPath); err == nil {
+		existing, err := nfo.ParseTVShow(data)
+		if err != nil {
+			log.Warn().Err(err).Str("nfo", nfoPath).Msg("Existing tvshow.nfo is invalid, replacing it")
+		} else {
+			existing.Merge(show)
+			show = existing
+		}
+	}
+
+	content, err := nfo.Marshal(show)
+	if err != nil {
+		return "", err
+	}
+
+	created, err := p.fileOps.CreateNFOFile(nfoPath, content)
+	if err != nil {
+		return "", fmt.Errorf("error writing tvshow NFO: %w", err)
+	}
+
+	log.Debug().Str("nfo", nfoPath).Msg("TV show NFO created")
+	return createdPath(nfoPath, created), nil
+}
+
+// createEpisodeNFO writes the episode NFO next to the episode file and returns its path if it is new
+func (p *Processor) createEpisodeNFO(mediaFile *models.MediaFile, mediaInfo *models.MediaInfo, details *api.MediaDetails) (string, error) {
+	content, err := nfo.Marshal(nfo.NewEpisodes(mediaInfo, details))
+	if err != nil {
+		return "", err
+	}
+
+	nfoPath := nfoPathFor(mediaFile.DestinationPath)
+	created, err := p.fileOps.CreateNFOFile(nfoPath, content)
+	if err != nil {
+		return "", fmt.Errorf("error writing episode NFO: %w", err)
+	}
+
+	log.Debug().Str("nfo", nfoPath).Msg("Episode NFO created")
+	return createdPath(nfoPath, created), nil
+}
+
+// createdPath returns the path of a written file if it was created, or an empty string
+func createdPath(path string, created bool) string {
+	if created {
+		return path
+	}
+	return ""
+}
+
+// nfoPathFor returns the NFO path that belongs to a video file
+func nfoPathFor(videoPath string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + ".nfo"
 }
 
 // createSuccessNotification creates a success notification
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/llm"
 	"github.com/sleepstars/mediascanner/internal/models"
 )
 
@@ -90,3 +92,88 @@ func TestMediaFileStatusUpdate(t *testing.T) {
 		t.Error("Expected UpdatedAt to be after CreatedAt")
 	}
 }
+
+// TestGenerateDestinationPath tests the destination paths built from the naming templates
+func TestGenerateDestinationPath(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.FileOps.DestinationRoot = "/library"
+	cfg.FileOps.MovieTemplate = "{title} ({year})"
+	cfg.FileOps.TVShowTemplate = "{title} ({year})"
+	cfg.FileOps.EpisodeTemplate = "{title} - S{season:02d}E{episode:02d} - {episode_title}"
+	p := &Processor{config: cfg}
+
+	testCases := []struct {
+		name           string
+		seasonTemplate string
+		result         *llm.MediaFileResult
+		mediaInfo      *models.MediaInfo
+		sourcePath     string
+		expected       string
+		showDir        string
+	}{
+		{
+			name:       "Movie",
+			result:     &llm.MediaFileResult{Category: "Movies", Subcategory: "Foreign"},
+			mediaInfo:  &models.MediaInfo{Title: "Parasite", Year: 2019, MediaType: "movie"},
+			sourcePath: "/downloads/Parasite.2019.1080p.BluRay.x264-GRP.mkv",
+			expected:   "/library/Movies/Foreign/Parasite (2019)/Parasite (2019).mkv",
+		},
+		{
+			name:       "Episode",
+			result:     &llm.MediaFileResult{Category: "TV Shows"},
+			mediaInfo:  &models.MediaInfo{Title: "Breaking Bad", Year: 2008, MediaType: "tv", Season: 1, Episode: 2, EpisodeTitle: "Cat's in the Bag..."},
+			sourcePath: "/downloads/Breaking.Bad.S01E02.720p.mp4",
+			expected:   "/library/TV Shows/Breaking Bad (2008)/Season 1/Breaking Bad - S01E02 - Cat's in the Bag.mp4",
+			showDir:    "/library/TV Shows/Breaking Bad (2008)",
+		},
+		{
+			name:           "Episode without season directory",
+			seasonTemplate: ".",
+			result:         &llm.MediaFileResult{Category: "TV Shows"},
+			mediaInfo:      &models.MediaInfo{Title: "Breaking Bad", Year: 2008, MediaType: "tv", Season: 1, Episode: 2},
+			sourcePath:     "/downloads/Breaking.Bad.S01E02.720p.mp4",
+			expected:       "/library/TV Shows/Breaking Bad (2008)/Breaking Bad - S01E02.mp4",
+			showDir:        "/library/TV Shows/Breaking Bad (2008)",
+		},
+		{
+			name:           "Episode in nested season directories",
+			seasonTemplate: "Seasons/Season {season:02d}",
+			result:         &llm.MediaFileResult{Category: "TV Shows"},
+			mediaInfo:      &models.MediaInfo{Title: "Breaking Bad", Year: 2008, MediaType: "tv", Season: 1, Episode: 2, EpisodeTitle: "Cat's in the Bag..."},
+			sourcePath:     "/downloads/Breaking.Bad.S01E02.720p.mp4",
+			expected:       "/library/TV Shows/Breaking Bad (2008)/Seasons/Season 01/Breaking Bad - S01E02 - Cat's in the Bag.mp4",
+			showDir:        "/library/TV Shows/Breaking Bad (2008)",
+		},
+		{
+			name:       "Multi-episode",
+			result:     &llm.MediaFileResult{Category: "TV Shows"},
+			mediaInfo:  &models.MediaInfo{Title: "The Expanse", Year: 2015, MediaType: "tv", Season: 1, Episode: 1, EndEpisode: 2, EpisodeTitle: "Dulcinea + The Big Empty"},
+			sourcePath: "/downloads/The.Expanse.S01E01-E02.mkv",
+			expected:   "/library/TV Shows/The Expanse (2015)/Season 1/The Expanse - S01E01-E02 - Dulcinea + The Big Empty.mkv",
+			showDir:    "/library/TV Shows/The Expanse (2015)",
+		},
+		{
+			name:       "Movie part",
+			result:     &llm.MediaFileResult{Category: "Movies"},
+			mediaInfo:  &models.MediaInfo{Title: "Heat", Year: 1995, MediaType: "movie", Part: 2},
+			sourcePath: "/downloads/Heat.1995.DVDRip.CD2.avi",
+			expected:   "/library/Movies/Heat (1995)/Heat (1995) - part2.avi",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.FileOps.SeasonTemplate = tc.seasonTemplate
+			result, showDir, err := p.generateDestinationPath(tc.result, tc.mediaInfo, tc.sourcePath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, result)
+			}
+			if showDir != tc.showDir {
+				t.Errorf("Expected show directory '%s', got '%s'", tc.showDir, showDir)
+			}
+		})
+	}
+}
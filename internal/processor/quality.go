@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/parser"
+)
+
+// probeTimeout bounds a single ffprobe run
+const probeTimeout = 30 * time.Second
+
+// sourceRanks orders the sources recognised by the parser, higher is better
+var sourceRanks = map[string]int{
+	"CAM":        1,
+	"HDCAM":      1,
+	"HDTC":       1,
+	"DVD":        2,
+	"HDTV":       3,
+	"HDRip":      3,
+	"WEBRip":     4,
+	"WEB-DL":     5,
+	"BluRay":     6,
+	"UHD BluRay": 7,
+	"Remux":      8,
+}
+
+// codecRanks orders the video codecs recognised by the parser, higher is better
+var codecRanks = map[string]int{
+	"MPEG-2": 1,
+	"XviD":   1,
+	"DivX":   1,
+	"VC-1":   2,
+	"H.264":  3,
+	"H.265":  4,
+	"AV1":    5,
+}
+
+// probedCodecs maps ffprobe codec names to the names used by the parser
+var probedCodecs = map[string]string{
+	"mpeg2video": "MPEG-2",
+	"mpeg4":      "XviD",
+	"vc1":        "VC-1",
+	"h264":       "H.264",
+	"hevc":       "H.265",
+	"av1":        "AV1",
+}
+
+// quality describes a video file for comparing duplicates
+type quality struct {
+	Resolution int // Vertical resolution, e.g. 1080
+	Source     string
+	VideoCodec string
+	Size       int64
+}
+
+// qualityFromName returns the quality given by a release name, without the size
+func qualityFromName(name string) quality {
+	parsed := parser.Parse(name)
+	return quality{
+		Resolution: parseResolution(parsed.Resolution),
+		Source:     parsed.Source,
+		VideoCodec: parsed.VideoCodec,
+	}
+}
+
+// parseResolution converts a resolution such as "1080p" to its number of lines
+func parseResolution(resolution string) int {
+	lines, _ := strconv.Atoi(strings.TrimRight(strings.ToLower(resolution), "pi"))
+	return lines
+}
+
+// compareQuality returns a positive number if a is better than b, negative if it is worse
+// and 0 if they are equal. Resolution weighs most, then source, codec and finally size.
+func compareQuality(a, b quality) int {
+	if a.Resolution != b.Resolution {
+		return a.Resolution - b.Resolution
+	}
+	if d := sourceRanks[a.Source] - sourceRanks[b.Source]; d != 0 {
+		return d
+	}
+	if d := codecRanks[a.VideoCodec] - codecRanks[b.VideoCodec]; d != 0 {
+		return d
+	}
+	switch {
+	case a.Size > b.Size:
+		return 1
+	case a.Size < b.Size:
+		return -1
+	}
+	return 0
+}
+
+// fileQuality returns the quality of a file from its release name, probing the container
+// for the resolution and codec when the name does not give them
+func (p *Processor) fileQuality(ctx context.Context, name, path string) quality {
+	q := qualityFromName(name)
+	if info, err := os.Stat(path); err == nil {
+		q.Size = info.Size()
+	}
+	if q.Resolution == 0 || q.VideoCodec == "" {
+		p.probeQuality(ctx, path, &q)
+	}
+	return q
+}
+
+// probeQuality fills the missing resolution and codec of a quality with ffprobe
+func (p *Processor) probeQuality(ctx context.Context, path string, q *quality) {
+	if p.config.FileOps.FFprobePath == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, p.config.FileOps.FFprobePath,
+		"-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,height", "-of", "json", path).Output()
+	if err != nil {
+		log.Debug().Err(err).Str("file", path).Msg("Failed to probe video quality")
+		return
+	}
+
+	var probe struct {
+		Streams []struct {
+			CodecName string `json:"codec_name"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil || len(probe.Streams) == 0 {
+		return
+	}
+
+	if q.Resolution == 0 {
+		q.Resolution = probe.Streams[0].Height
+	}
+	if q.VideoCodec == "" {
+		q.VideoCodec = probedCodecs[probe.Streams[0].CodecName]
+	}
+}
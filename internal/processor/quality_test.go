@@ -0,0 +1,43 @@
+package processor
+
+import "testing"
+
+// TestCompareQuality tests the ordering of release qualities
+func TestCompareQuality(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		aSize    int64
+		bSize    int64
+		expected int // sign of the comparison
+	}{
+		{"Movie.2020.2160p.WEB-DL.x265", "Movie.2020.1080p.BluRay.x264", 0, 0, 1},
+		{"Movie.2020.1080p.WEB-DL.x264", "Movie.2020.1080p.BluRay.x264", 0, 0, -1},
+		{"Movie.2020.1080p.BluRay.x265", "Movie.2020.1080p.BluRay.x264", 0, 0, 1},
+		{"Movie.2020.1080p.BluRay.x264", "Movie.2020.1080p.BluRay.x264", 200, 100, 1},
+		{"Movie.2020.1080p.BluRay.x264", "Movie.2020.1080p.BluRay.x264", 100, 100, 0},
+		{"Movie.2020.720p.BluRay.Remux", "Movie.2020.1080i.HDTV", 0, 0, -1},
+		{"Movie (2020)", "Movie.2020.480p.DVD", 0, 0, -1},
+	}
+
+	for _, tc := range testCases {
+		a := qualityFromName(tc.a)
+		a.Size = tc.aSize
+		b := qualityFromName(tc.b)
+		b.Size = tc.bSize
+
+		result := compareQuality(a, b)
+		if sign(result) != tc.expected {
+			t.Errorf("Expected %s vs %s to compare %d, got %d", tc.a, tc.b, tc.expected, result)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
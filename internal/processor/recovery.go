@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// defaultLeaseDuration is used when no lease duration is configured
+const defaultLeaseDuration = 5 * time.Minute
+
+// errClaimed is returned when a media file is already being processed elsewhere
+var errClaimed = errors.New("media file is being processed by another worker")
+
+// Recovery is the work left behind by crashed or stopped instances
+type Recovery struct {
+	// Number of media files returned to the pending state
+	Released int64
+
+	// Batches to resume, claimed by this instance
+	Batches []models.BatchProcess
+}
+
+// newInstanceID returns an ID identifying this process as the owner of leases
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d/%x", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// leaseDuration returns how long a claim stays valid without a heartbeat
+func (p *Processor) leaseDuration() time.Duration {
+	if p.config.WorkerPool.LeaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return time.Duration(p.config.WorkerPool.LeaseDuration) * time.Second
+}
+
+// claim sets a media file to processing under a lease held by this instance. The file must be
+// in one of the given statuses, or processing under an expired lease.
+func (p *Processor) claim(mediaFile *models.MediaFile, statuses ...string) error {
+	claimed, err := p.db.ClaimMediaFile(mediaFile, p.instanceID, time.Now().Add(p.leaseDuration()), statuses...)
+	if err != nil {
+		return fmt.Errorf("error updating media file status: %w", err)
+	}
+	if !claimed {
+		return errClaimed
+	}
+	return nil
+}
+
+// claimBatch sets a batch process to processing under a lease held by this instance
+func (p *Processor) claimBatch(batchProcess *models.BatchProcess) (bool, error) {
+	claimed, err := p.db.ClaimBatchProcess(batchProcess, p.instanceID, time.Now().Add(p.leaseDuration()))
+	if err != nil {
+		return false, fmt.Errorf("error updating batch process status: %w", err)
+	}
+	return claimed, nil
+}
+
+// RunHeartbeat renews the leases held by this instance until the context is cancelled
+func (p *Processor) RunHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(p.leaseDuration() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.db.RenewLeases(p.instanceID, time.Now().Add(p.leaseDuration())); err != nil {
+				log.Error().Err(err).Msg("Failed to renew leases")
+			}
+		}
+	}
+}
+
+// Recover takes over work whose lease has expired: media files are returned to the pending
+// state and interrupted batches are claimed to be resumed. With resumePending, batches that
+// were created but never started are claimed as well, which is only safe at startup when no
+// batch of this instance is waiting in the queue.
+func (p *Processor) Recover(resumePending bool) (*Recovery, error) {
+	released, err := p.db.ReleaseExpiredMediaFiles()
+	if err != nil {
+		return nil, fmt.Errorf("error releasing media files: %w", err)
+	}
+	recovery := &Recovery{Released: released}
+	if released > 0 {
+		log.Warn().Int64("count", released).Msg("Media files abandoned while processing returned to pending")
+	}
+
+	// Batches wait for the LLM budget to reset
+	if !p.LLMDeferredUntil().IsZero() {
+		return recovery, nil
+	}
+
+	batches, err := p.db.GetExpiredBatchProcesses()
+	if err != nil {
+		return recovery, fmt.Errorf("error getting interrupted batch processes: %w", err)
+	}
+	if resumePending {
+		pending, err := p.db.GetPendingBatchProcesses()
+		if err != nil {
+			return recovery, fmt.Errorf("error getting pending batch processes: %w", err)
+		}
+		batches = append(batches, pending...)
+	}
+
+	for _, batch := range batches {
+		claimed, err := p.claimBatch(&batch)
+		if err != nil {
+			return recovery, err
+		}
+		if !claimed {
+			continue
+		}
+		log.Info().Int64("batch_id", batch.ID).Str("directory", batch.Directory).Msg("Resuming batch process")
+		recovery.Batches = append(recovery.Batches, batch)
+	}
+	return recovery, nil
+}
+
+// ReleaseBatch gives up the claim on a batch process that could not be queued, so that it
+// is resumed by a later recovery
+func (p *Processor) ReleaseBatch(batchProcess *models.BatchProcess) error {
+	return p.db.ReleaseBatchProcess(batchProcess)
+}
@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/database/dbtest"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestLeaseDuration tests the configured lease duration and its fallback
+func TestLeaseDuration(t *testing.T) {
+	tests := []struct {
+		seconds  int
+		expected time.Duration
+	}{
+		{300, 5 * time.Minute},
+		{30, 30 * time.Second},
+		{0, defaultLeaseDuration},
+		{-1, defaultLeaseDuration},
+	}
+
+	for _, test := range tests {
+		cfg := config.DefaultConfig()
+		cfg.WorkerPool.LeaseDuration = test.seconds
+		p := &Processor{config: cfg}
+		if actual := p.leaseDuration(); actual != test.expected {
+			t.Errorf("leaseDuration() with %d seconds = %v, expected %v", test.seconds, actual, test.expected)
+		}
+	}
+}
+
+// TestBatchFileDone tests which batch files are left out when a batch is resumed
+func TestBatchFileDone(t *testing.T) {
+	tests := map[string]bool{
+		"pending":    false,
+		"processing": false,
+		"success":    true,
+		"failed":     true,
+		"manual":     true,
+		"skipped":    true,
+	}
+
+	for status, expected := range tests {
+		if actual := batchFileDone(status); actual != expected {
+			t.Errorf("batchFileDone(%q) = %v, expected %v", status, actual, expected)
+		}
+	}
+}
+
+// TestBatchLeavesOutLeasedFiles tests that a batch leaves out files processing under a live
+// lease, and takes over those whose lease has expired
+func TestBatchLeavesOutLeasedFiles(t *testing.T) {
+	files := map[int64]*models.MediaFile{
+		1: {ID: 1, OriginalName: "Show.S01E01.mkv", Status: "processing", LeaseExpiresAt: time.Now().Add(time.Hour)},
+		2: {ID: 2, OriginalName: "Show.S01E02.mkv", Status: "processing", LeaseExpiresAt: time.Now().Add(-time.Hour)},
+	}
+	var asked []string
+	p, db := newPlanTestProcessor(t, t.TempDir(), func(query string, args []driver.Value) *dbtest.Rows {
+		switch {
+		case strings.HasPrefix(query, `SELECT * FROM "batch_process_files"`):
+			return dbtest.RowsOf(
+				&models.BatchProcessFile{ID: 1, BatchProcessID: 1, MediaFileID: 1, Status: "pending"},
+				&models.BatchProcessFile{ID: 2, BatchProcessID: 1, MediaFileID: 2, Status: "pending"},
+			)
+		case strings.HasPrefix(query, `SELECT * FROM "media_files"`):
+			if file, ok := files[args[0].(int64)]; ok {
+				return dbtest.RowsOf(file)
+			}
+		}
+		return nil
+	}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for _, file := range files {
+			if strings.Contains(string(body), file.OriginalName) {
+				asked = append(asked, file.OriginalName)
+			}
+		}
+		http.Error(w, "unavailable", http.StatusBadRequest)
+	})
+
+	err := p.ProcessBatchFiles(context.Background(), &models.BatchProcess{ID: 1, Status: "pending", FileCount: 2})
+	if err == nil {
+		t.Error("Expected the LLM error")
+	}
+	if len(asked) != 1 || asked[0] != "Show.S01E02.mkv" {
+		t.Errorf("LLM asked about %v, expected only the file with an expired lease", asked)
+	}
+	for _, statement := range db.Writes() {
+		if strings.HasPrefix(statement.Query, `UPDATE "media_files"`) && statement.Args[len(statement.Args)-1] == int64(1) {
+			t.Errorf("File under a live lease was updated: %s %v", statement.Query, statement.Args)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// maxCandidates is the number of candidates stored for a file awaiting review
+const maxCandidates = 5
+
+// notifiedCandidates is the number of candidates listed in a needs-attention notification
+const notifiedCandidates = 3
+
+// needsReview reports whether an identification is too uncertain to organise the file
+func (p *Processor) needsReview(result *llm.MediaFileResult) bool {
+	threshold := p.config.LLM.ConfidenceThreshold
+	return threshold > 0 && result.Confidence < threshold
+}
+
+// holdForReview stores an uncertain identification and its candidates, marks the file
+// as manual and raises a needs-attention notification. The file itself is not touched.
+func (p *Processor) holdForReview(ctx context.Context, mediaFile *models.MediaFile, result *llm.MediaFileResult) error {
+	// Store the best guess so that it can be accepted during review
+	mediaInfo := newMediaInfo(mediaFile, result)
+	if err := p.storeMediaInfo(mediaInfo); err != nil {
+		return p.handleProcessingError(mediaFile, err, "Storing candidate identification")
+	}
+
+	candidates := p.reviewCandidates(ctx, mediaFile, result)
+	if err := p.db.ReplaceCandidates(mediaFile.ID, candidates); err != nil {
+		log.Warn().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to store review candidates")
+	}
+
+	mediaFile.Status = "manual"
+	mediaFile.MediaType = result.MediaType
+	mediaFile.ErrorMessage = fmt.Sprintf("Identification confidence %.2f is below threshold %.2f",
+		result.Confidence, p.config.LLM.ConfidenceThreshold)
+	mediaFile.UpdatedAt = time.Now()
+	if err := p.db.UpdateMediaFile(mediaFile); err != nil {
+		return fmt.Errorf("error updating media file status: %w", err)
+	}
+
+	if err := p.createAttentionNotification(mediaFile, candidates); err != nil {
+		log.Warn().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to create attention notification")
+	}
+
+	log.Warn().
+		Str("file", mediaFile.OriginalPath).
+		Str("title", result.Title).
+		Float64("confidence", result.Confidence).
+		Int("candidates", len(candidates)).
+		Msg("Identification uncertain, file held for manual review")
+	return nil
+}
+
+// reviewCandidates collects the candidates of an uncertain identification: the result itself,
+// the alternatives suggested by the LLM and, if there are few of them, TMDB search results
+func (p *Processor) reviewCandidates(ctx context.Context, mediaFile *models.MediaFile, result *llm.MediaFileResult) []models.Candidate {
+	candidates := make([]models.Candidate, 0, maxCandidates)
+	seen := make(map[string]bool)
+
+	add := func(c models.Candidate) {
+		if len(candidates) >= maxCandidates {
+			return
+		}
+		key := candidateKey(&c)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		c.MediaFileID = mediaFile.ID
+		c.Rank = len(candidates) + 1
+		if c.MediaType == "tv" {
+			c.Season = result.Season
+			c.Episode = result.Episode
+			c.EndEpisode = result.EndEpisode
+		} else {
+			c.Part = result.Part
+		}
+		candidates = append(candidates, c)
+	}
+
+	add(models.Candidate{
+		Source:        "result",
+		Title:         result.Title,
+		OriginalTitle: result.OriginalTitle,
+		Year:          result.Year,
+		MediaType:     result.MediaType,
+		TMDBID:        result.TMDBID,
+		TVDBID:        result.TVDBID,
+		BangumiID:     result.BangumiID,
+		ImdbID:        result.ImdbID,
+		Category:      result.Category,
+		Subcategory:   result.Subcategory,
+		Confidence:    result.Confidence,
+	})
+
+	for _, alt := range result.Candidates {
+		add(models.Candidate{
+			Source:        "llm",
+			Title:         alt.Title,
+			OriginalTitle: alt.OriginalTitle,
+			Year:          alt.Year,
+			MediaType:     alt.MediaType,
+			TMDBID:        alt.TMDBID,
+			TVDBID:        alt.TVDBID,
+			BangumiID:     alt.BangumiID,
+			Category:      result.Category,
+			Subcategory:   result.Subcategory,
+			Confidence:    alt.Confidence,
+		})
+	}
+
+	// Suggest TMDB search results when the LLM offered no alternatives
+	if len(candidates) < notifiedCandidates && result.Title != "" {
+		if result.MediaType != "tv" {
+			search, err := p.apiClient.TMDB.SearchMovie(ctx, result.Title, result.Year)
+			if err != nil {
+				log.Debug().Err(err).Str("title", result.Title).Msg("TMDB movie search for candidates failed")
+			} else {
+				for _, movie := range search.Movies {
+					add(models.Candidate{
+						Source:        "tmdb",
+						Title:         movie.Title,
+						OriginalTitle: movie.OriginalTitle,
+						Year:          movie.ReleaseYear,
+						MediaType:     "movie",
+						TMDBID:        movie.ID,
+						Category:      result.Category,
+						Subcategory:   result.Subcategory,
+					})
+				}
+			}
+		}
+		if result.MediaType != "movie" {
+			search, err := p.apiClient.TMDB.SearchTV(ctx, result.Title, 0)
+			if err != nil {
+				log.Debug().Err(err).Str("title", result.Title).Msg("TMDB TV search for candidates failed")
+			} else {
+				for _, show := range search.Shows {
+					add(models.Candidate{
+						Source:        "tmdb",
+						Title:         show.Name,
+						OriginalTitle: show.OriginalName,
+						Year:          show.FirstAirYear,
+						MediaType:     "tv",
+						TMDBID:        show.ID,
+						Category:      result.Category,
+						Subcategory:   result.Subcategory,
+					})
+				}
+			}
+		}
+	}
+
+	return candidates
+}
+
+// candidateKey identifies duplicate candidates
+func candidateKey(c *models.Candidate) string {
+	switch {
+	case c.TMDBID > 0:
+		return fmt.Sprintf("%s:tmdb:%d", c.MediaType, c.TMDBID)
+	case c.TVDBID > 0:
+		return fmt.Sprintf("%s:tvdb:%d", c.MediaType, c.TVDBID)
+	case c.BangumiID > 0:
+		return fmt.Sprintf("%s:bangumi:%d", c.MediaType, c.BangumiID)
+	default:
+		return fmt.Sprintf("%s:%s:%d", c.MediaType, normalizeTitle(c.Title), c.Year)
+	}
+}
+
+// createAttentionNotification creates a needs-attention notification listing the top candidates
+func (p *Processor) createAttentionNotification(mediaFile *models.MediaFile, candidates []models.Candidate) error {
+	if !p.config.Notification.Enabled {
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Needs attention: %s\n%s", mediaFile.OriginalName, mediaFile.ErrorMessage)
+	if len(candidates) > 0 {
+		sb.WriteString("\nCandidates:")
+		for i, c := range candidates {
+			if i >= notifiedCandidates {
+				break
+			}
+			fmt.Fprintf(&sb, "\n%d. %s", c.Rank, formatCandidate(&c))
+		}
+	}
+
+	// Create notification record
+	notification := &models.Notification{
+		MediaFileID: mediaFile.ID,
+		Type:        "attention",
+		Message:     sb.String(),
+		Sent:        false,
+		CreatedAt:   time.Now(),
+	}
+
+	// Save to database
+	return p.db.CreateNotification(notification)
+}
+
+// formatCandidate formats a candidate as a single line
+func formatCandidate(c *models.Candidate) string {
+	var sb strings.Builder
+	sb.WriteString(c.Title)
+	if c.Year > 0 {
+		fmt.Fprintf(&sb, " (%d)", c.Year)
+	}
+	if c.MediaType != "" {
+		fmt.Fprintf(&sb, " [%s]", c.MediaType)
+	}
+	if c.MediaType == "tv" && (c.Season > 0 || c.Episode > 0) {
+		fmt.Fprintf(&sb, " S%02dE%02d", c.Season, c.Episode)
+	}
+	if c.TMDBID > 0 {
+		fmt.Fprintf(&sb, " tmdb:%d", c.TMDBID)
+	}
+	if c.TVDBID > 0 {
+		fmt.Fprintf(&sb, " tvdb:%d", c.TVDBID)
+	}
+	if c.BangumiID > 0 {
+		fmt.Fprintf(&sb, " bangumi:%d", c.BangumiID)
+	}
+	if c.Confidence > 0 {
+		fmt.Fprintf(&sb, " confidence %.2f", c.Confidence)
+	}
+	return sb.String()
+}
+
+// newMediaInfo creates the media info record of an identification result
+func newMediaInfo(mediaFile *models.MediaFile, result *llm.MediaFileResult) *models.MediaInfo {
+	return &models.MediaInfo{
+		MediaFileID:   mediaFile.ID,
+		Title:         result.Title,
+		OriginalTitle: result.OriginalTitle,
+		Year:          result.Year,
+		MediaType:     result.MediaType,
+		Season:        result.Season,
+		Episode:       result.Episode,
+		EndEpisode:    result.EndEpisode,
+		Part:          result.Part,
+		EpisodeTitle:  result.EpisodeTitle,
+		TMDBID:        result.TMDBID,
+		TVDBID:        result.TVDBID,
+		BangumiID:     result.BangumiID,
+		ImdbID:        result.ImdbID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// storeMediaInfo creates the media info record, replacing an existing record of the
+// same media file, e.g. when a file is processed again after a failure or review
+func (p *Processor) storeMediaInfo(mediaInfo *models.MediaInfo) error {
+	existing, err := p.db.GetMediaInfoByMediaFileID(mediaInfo.MediaFileID)
+	if err != nil {
+		return p.db.CreateMediaInfo(mediaInfo)
+	}
+
+	mediaInfo.ID = existing.ID
+	mediaInfo.CreatedAt = existing.CreatedAt
+	return p.db.UpdateMediaInfo(mediaInfo)
+}
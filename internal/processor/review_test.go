@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestNeedsReview tests the confidence threshold
+func TestNeedsReview(t *testing.T) {
+	testCases := []struct {
+		name       string
+		threshold  float64
+		confidence float64
+		expected   bool
+	}{
+		{"Below threshold", 0.7, 0.5, true},
+		{"At threshold", 0.7, 0.7, false},
+		{"Above threshold", 0.7, 0.95, false},
+		{"Missing confidence", 0.7, 0, true},
+		{"Check disabled", 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.LLM.ConfidenceThreshold = tc.threshold
+			p := &Processor{config: cfg}
+
+			if result := p.needsReview(&llm.MediaFileResult{Confidence: tc.confidence}); result != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+// TestFormatCandidate tests the candidate lines of needs-attention notifications
+func TestFormatCandidate(t *testing.T) {
+	testCases := []struct {
+		candidate models.Candidate
+		expected  string
+	}{
+		{
+			candidate: models.Candidate{Title: "Parasite", Year: 2019, MediaType: "movie", TMDBID: 496243, Confidence: 0.55},
+			expected:  "Parasite (2019) [movie] tmdb:496243 confidence 0.55",
+		},
+		{
+			candidate: models.Candidate{Title: "Shameless", MediaType: "tv", Season: 2, Episode: 3, TVDBID: 161511},
+			expected:  "Shameless [tv] S02E03 tvdb:161511",
+		},
+	}
+
+	for _, tc := range testCases {
+		if result := formatCandidate(&tc.candidate); result != tc.expected {
+			t.Errorf("Expected '%s', got '%s'", tc.expected, result)
+		}
+	}
+}
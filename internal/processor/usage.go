@@ -0,0 +1,226 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// Groupings of the LLM usage report
+const (
+	UsageByDay      = "day"
+	UsageByProvider = "provider"
+	UsageByModel    = "model"
+	UsageByFile     = "file"
+)
+
+// UsageRow is the LLM usage of a day, provider, model, or file or batch
+type UsageRow struct {
+	Key              string
+	Requests         int
+	Failed           int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Latency          time.Duration // average time spent waiting for the LLM
+}
+
+// llmSubjectKey is the context key of the file or batch an LLM exchange is about
+type llmSubjectKey struct{}
+
+// llmSubject is the file or batch an LLM exchange is about
+type llmSubject struct {
+	mediaFileID    int64
+	batchProcessID int64
+}
+
+// withLLMSubject returns a context recording LLM exchanges for a media file or batch
+func withLLMSubject(ctx context.Context, mediaFileID, batchProcessID int64) context.Context {
+	return context.WithValue(ctx, llmSubjectKey{}, llmSubject{mediaFileID: mediaFileID, batchProcessID: batchProcessID})
+}
+
+// recordExchange stores an LLM exchange with its token usage and cost
+func (p *Processor) recordExchange(ctx context.Context, exchange *llm.Exchange) {
+	subject, _ := ctx.Value(llmSubjectKey{}).(llmSubject)
+
+	for _, request := range exchangeRequests(exchange, subject, p.config.LLM.Prices) {
+		if err := p.db.CreateLLMRequest(request); err != nil {
+			log.Warn().Err(err).Int64("media_file_id", subject.mediaFileID).Msg("Failed to record LLM request")
+		}
+	}
+}
+
+// exchangeRequests returns the LLM request records of an exchange, one for every endpoint and
+// model it used so that each is priced at its own rate. The record of the model that gave
+// the final answer holds the conversation.
+func exchangeRequests(exchange *llm.Exchange, subject llmSubject, prices map[string]config.ModelPrice) []*models.LLMRequest {
+	usages := exchange.Usage
+	if len(usages) == 0 {
+		// No response was received
+		usages = []llm.Usage{{Provider: exchange.Provider, Model: exchange.Model, Latency: exchange.Latency}}
+	}
+
+	now := time.Now()
+	requests := make([]*models.LLMRequest, 0, len(usages))
+	for _, usage := range usages {
+		request := &models.LLMRequest{
+			MediaFileID:      subject.mediaFileID,
+			BatchProcessID:   subject.batchProcessID,
+			Provider:         usage.Provider,
+			Model:            usage.Model,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			Tokens:           usage.PromptTokens + usage.CompletionTokens,
+			LatencyMs:        usage.Latency.Milliseconds(),
+			Cost:             llmCost(prices, usage.Model, usage.PromptTokens, usage.CompletionTokens),
+			Success:          exchange.Err == nil,
+			CreatedAt:        now,
+		}
+		if exchange.Err != nil {
+			request.ErrorMessage = exchange.Err.Error()
+		}
+		requests = append(requests, request)
+	}
+
+	last := requests[len(requests)-1]
+	for i := len(usages) - 1; i >= 0; i-- {
+		if usages[i].Provider == exchange.Provider && usages[i].Model == exchange.Model {
+			last = requests[i]
+			break
+		}
+	}
+	last.Prompt = firstUserMessage(exchange.Messages)
+	last.Response = exchange.Response
+	if messages, err := json.Marshal(exchange.Messages); err == nil {
+		last.Messages = string(messages)
+	}
+	return requests
+}
+
+// firstUserMessage returns the content of the first user message of a conversation
+func firstUserMessage(messages []openai.ChatCompletionMessage) string {
+	for _, message := range messages {
+		if message.Role == openai.ChatMessageRoleUser {
+			return message.Content
+		}
+	}
+	return ""
+}
+
+// llmCost computes the cost of tokens from the price of the model. Models are priced by the
+// longest price key they start with; models without a price cost nothing.
+func llmCost(prices map[string]config.ModelPrice, model string, promptTokens, completionTokens int) float64 {
+	var price config.ModelPrice
+	matched := ""
+	for key, p := range prices {
+		if strings.HasPrefix(model, key) && len(key) > len(matched) {
+			price, matched = p, key
+		}
+	}
+	if matched == "" {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+// LLMUsage reports the LLM usage since a point in time grouped by day, provider, model or file
+func (p *Processor) LLMUsage(since time.Time, by string) ([]UsageRow, error) {
+	var label func(request *models.LLMRequest) string
+	switch by {
+	case UsageByDay:
+		label = func(request *models.LLMRequest) string { return request.CreatedAt.Local().Format("2006-01-02") }
+	case UsageByProvider:
+		label = func(request *models.LLMRequest) string { return request.Provider }
+	case UsageByModel:
+		label = func(request *models.LLMRequest) string { return request.Model }
+	case UsageByFile:
+		label = p.usageSubjects()
+	default:
+		return nil, fmt.Errorf("unknown grouping: %s", by)
+	}
+
+	requests, err := p.db.GetLLMRequestsSince(since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting LLM requests: %w", err)
+	}
+	return aggregateUsage(requests, label, by == UsageByDay), nil
+}
+
+// usageSubjects returns a function naming the file or batch of an LLM request, looking
+// each of them up once
+func (p *Processor) usageSubjects() func(request *models.LLMRequest) string {
+	files := make(map[int64]string)
+	batches := make(map[int64]string)
+	return func(request *models.LLMRequest) string {
+		switch {
+		case request.MediaFileID != 0:
+			name, ok := files[request.MediaFileID]
+			if !ok {
+				name = fmt.Sprintf("#%d", request.MediaFileID)
+				if mediaFile, err := p.db.GetMediaFileByID(request.MediaFileID); err == nil {
+					name += " " + mediaFile.OriginalName
+				}
+				files[request.MediaFileID] = name
+			}
+			return name
+		case request.BatchProcessID != 0:
+			name, ok := batches[request.BatchProcessID]
+			if !ok {
+				name = fmt.Sprintf("batch %d", request.BatchProcessID)
+				if batch, err := p.db.GetBatchProcessByID(request.BatchProcessID); err == nil {
+					name += " " + batch.Directory
+				}
+				batches[request.BatchProcessID] = name
+			}
+			return name
+		default:
+			return "(plan)"
+		}
+	}
+}
+
+// aggregateUsage groups LLM requests by label. Rows are sorted by label when chronological,
+// by cost otherwise.
+func aggregateUsage(requests []models.LLMRequest, label func(request *models.LLMRequest) string, chronological bool) []UsageRow {
+	rows := make(map[string]*UsageRow)
+	latency := make(map[string]int64)
+	for i := range requests {
+		request := &requests[i]
+		key := label(request)
+		row, ok := rows[key]
+		if !ok {
+			row = &UsageRow{Key: key}
+			rows[key] = row
+		}
+		row.Requests++
+		if !request.Success {
+			row.Failed++
+		}
+		row.PromptTokens += request.PromptTokens
+		row.CompletionTokens += request.CompletionTokens
+		row.Cost += request.Cost
+		latency[key] += request.LatencyMs
+	}
+
+	result := make([]UsageRow, 0, len(rows))
+	for key, row := range rows {
+		row.Latency = time.Duration(latency[key]/int64(row.Requests)) * time.Millisecond
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if chronological || result[i].Cost == result[j].Cost {
+			return result[i].Key < result[j].Key
+		}
+		return result[i].Cost > result[j].Cost
+	})
+	return result
+}
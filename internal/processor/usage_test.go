@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/mediascanner/internal/config"
+	"github.com/sleepstars/mediascanner/internal/llm"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestLLMCost tests pricing tokens by the longest matching model prefix
+func TestLLMCost(t *testing.T) {
+	prices := map[string]config.ModelPrice{
+		"gpt-4o":      {Input: 2.5, Output: 10},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+	}
+
+	tests := []struct {
+		model    string
+		expected float64
+	}{
+		{"gpt-4o", 2.5 + 10},
+		{"gpt-4o-2024-08-06", 2.5 + 10},
+		{"gpt-4o-mini-2024-07-18", 0.15 + 0.6},
+		{"claude-3-haiku", 0},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		actual := llmCost(prices, test.model, 1000000, 1000000)
+		if math.Abs(actual-test.expected) > 1e-9 {
+			t.Errorf("llmCost(%q) = %f, expected %f", test.model, actual, test.expected)
+		}
+	}
+}
+
+// TestAggregateUsage tests grouping LLM requests into usage rows
+func TestAggregateUsage(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	requests := []models.LLMRequest{
+		{Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5, LatencyMs: 1000, Success: true, CreatedAt: day},
+		{Model: "gpt-4o", PromptTokens: 200, CompletionTokens: 20, Cost: 0.5, LatencyMs: 3000, CreatedAt: day},
+		{Model: "gpt-4o-mini", PromptTokens: 50, CompletionTokens: 5, Cost: 0.01, LatencyMs: 500, Success: true, CreatedAt: day.AddDate(0, 0, 1)},
+		{Model: "gpt-3.5-turbo", PromptTokens: 10, CompletionTokens: 1, Cost: 2, LatencyMs: 200, Success: true, CreatedAt: day.AddDate(0, 0, -1)},
+	}
+
+	byModel := aggregateUsage(requests, func(request *models.LLMRequest) string { return request.Model }, false)
+	expected := []UsageRow{
+		{Key: "gpt-3.5-turbo", Requests: 1, PromptTokens: 10, CompletionTokens: 1, Cost: 2, Latency: 200 * time.Millisecond},
+		{Key: "gpt-4o", Requests: 2, Failed: 1, PromptTokens: 300, CompletionTokens: 30, Cost: 1, Latency: 2 * time.Second},
+		{Key: "gpt-4o-mini", Requests: 1, PromptTokens: 50, CompletionTokens: 5, Cost: 0.01, Latency: 500 * time.Millisecond},
+	}
+	if len(byModel) != len(expected) {
+		t.Fatalf("aggregateUsage() returned %d rows, expected %d", len(byModel), len(expected))
+	}
+	for i := range expected {
+		if byModel[i] != expected[i] {
+			t.Errorf("row %d = %+v, expected %+v", i, byModel[i], expected[i])
+		}
+	}
+
+	byDay := aggregateUsage(requests, func(request *models.LLMRequest) string {
+		return request.CreatedAt.Format("2006-01-02")
+	}, true)
+	days := []string{"2024-04-30", "2024-05-01", "2024-05-02"}
+	if len(byDay) != len(days) {
+		t.Fatalf("aggregateUsage() by day returned %d rows, expected %d", len(byDay), len(days))
+	}
+	for i, day := range days {
+		if byDay[i].Key != day {
+			t.Errorf("row %d is %s, expected %s", i, byDay[i].Key, day)
+		}
+	}
+}
+
+// TestExchangeRequests tests that an exchange failing over between models is recorded and
+// priced per model
+func TestExchangeRequests(t *testing.T) {
+	prices := map[string]config.ModelPrice{
+		"gpt-4o":      {Input: 2.5, Output: 10},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+	}
+	exchange := &llm.Exchange{
+		Provider: "backup",
+		Model:    "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Heat.1995.mkv"}},
+		Response: `{"title":"Heat"}`,
+		Usage: []llm.Usage{
+			{Provider: "primary", Model: "gpt-4o", PromptTokens: 1000000, Latency: time.Second},
+			{Provider: "backup", Model: "gpt-4o-mini", PromptTokens: 1000000, CompletionTokens: 1000000, Latency: 2 * time.Second},
+		},
+	}
+
+	requests := exchangeRequests(exchange, llmSubject{mediaFileID: 7}, prices)
+	if len(requests) != 2 {
+		t.Fatalf("exchangeRequests() returned %d requests, expected 2", len(requests))
+	}
+	expected := []struct {
+		provider, model string
+		tokens          int
+		cost            float64
+		latencyMs       int64
+		conversation    bool
+	}{
+		{"primary", "gpt-4o", 1000000, 2.5, 1000, false},
+		{"backup", "gpt-4o-mini", 2000000, 0.75, 2000, true},
+	}
+	for i, e := range expected {
+		r := requests[i]
+		if r.Provider != e.provider || r.Model != e.model || r.Tokens != e.tokens || r.LatencyMs != e.latencyMs || r.MediaFileID != 7 || !r.Success {
+			t.Errorf("request %d = %+v, expected %s %s with %d tokens", i, r, e.provider, e.model, e.tokens)
+		}
+		if math.Abs(r.Cost-e.cost) > 1e-9 {
+			t.Errorf("request %d costs %f, expected %f", i, r.Cost, e.cost)
+		}
+		if (r.Messages != "") != e.conversation || (r.Response != "") != e.conversation {
+			t.Errorf("request %d holds the conversation = %v, expected %v", i, r.Messages != "", e.conversation)
+		}
+	}
+
+	// An exchange without any response is recorded once
+	failed := &llm.Exchange{Provider: "primary", Model: "gpt-4o", Err: errors.New("unavailable")}
+	requests = exchangeRequests(failed, llmSubject{}, prices)
+	if len(requests) != 1 || requests[0].Success || requests[0].ErrorMessage != "unavailable" || requests[0].Cost != 0 {
+		t.Errorf("exchangeRequests() for a failed exchange = %+v, expected one failed request", requests)
+	}
+}
@@ -39,6 +39,12 @@ func (p *Processor) QueueBatchProcess(batchProcess *models.BatchProcess) error {
 	return p.workerPool.AddBatchProcessTask(batchProcess)
 }
 
+// SetBatchDoneHandler sets the function called with the ID of a batch process once it has
+// been processed, whether it succeeded or failed. Deferred batches have not ended.
+func (p *Processor) SetBatchDoneHandler(handler func(batchID int64)) {
+	p.batchDone = handler
+}
+
 // processTask processes a task from the worker pool
 func (p *Processor) processTask(ctx context.Context, task *worker.Task) error {
 	switch task.Type {
@@ -49,31 +49,40 @@ func (tb *TokenBucketRateLimiter) refill() {
 
 // Wait blocks until the rate limiter allows an event to happen
 func (tb *TokenBucketRateLimiter) Wait(ctx context.Context) error {
+	return tb.WaitN(ctx, 1)
+}
+
+// WaitN blocks until the rate limiter allows n events to happen. More events than the
+// bucket holds wait for a full bucket.
+func (tb *TokenBucketRateLimiter) WaitN(ctx context.Context, n float64) error {
 	tb.mu.Lock()
 	
 	// Refill the bucket
 	tb.refill()
 	
-	// If we have at least one token, consume it and return immediately
-	if tb.tokens >= 1.0 {
-		tb.tokens -= 1.0
+	// If we have enough tokens, consume them and return immediately
+	if n > tb.bucketSize {
+		n = tb.bucketSize
+	}
+	if tb.tokens >= n {
+		tb.tokens -= n
 		tb.mu.Unlock()
 		return nil
 	}
 	
-	// Calculate how long to wait for the next token
-	waitTime := time.Duration((1.0 - tb.tokens) / tb.rate * float64(time.Second))
+	// Calculate how long to wait for the missing tokens
+	waitTime := time.Duration((n - tb.tokens) / tb.rate * float64(time.Second))
 	
 	// Unlock while waiting
 	tb.mu.Unlock()
 	
-	// Wait for the token or context cancellation
+	// Wait for the tokens or context cancellation
 	select {
 	case <-time.After(waitTime):
-		// Lock again to consume the token
+		// Lock again to consume the tokens
 		tb.mu.Lock()
 		tb.refill()
-		tb.tokens -= 1.0
+		tb.tokens -= n
 		tb.mu.Unlock()
 		return nil
 	case <-ctx.Done():
@@ -81,6 +90,17 @@ func (tb *TokenBucketRateLimiter) Wait(ctx context.Context) error {
 	}
 }
 
+// Adjust takes n more tokens from the bucket, or returns them when n is negative. It corrects
+// a WaitN made with an estimate once the actual amount is known, so the bucket may go into
+// debt which later waits pay off.
+func (tb *TokenBucketRateLimiter) Adjust(n float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	
+	tb.refill()
+	tb.tokens = min(tb.tokens-n, tb.bucketSize)
+}
+
 // TryWait returns true if the rate limiter allows an event to happen immediately
 func (tb *TokenBucketRateLimiter) TryWait(ctx context.Context) bool {
 	tb.mu.Lock()
@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// discStructures are the directories holding the content of Blu-ray and DVD discs
+var discStructures = []string{"BDMV", "VIDEO_TS"}
+
+// IsDiscRoot reports whether a directory holds a Blu-ray (BDMV) or DVD (VIDEO_TS) structure
+func IsDiscRoot(dir string) bool {
+	for _, structure := range discStructures {
+		if info, err := os.Stat(filepath.Join(dir, structure)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDiscImage reports whether a file is a disc image
+func IsDiscImage(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".iso")
+}
+
+// isDiscStructure reports whether a directory name is part of a disc structure
+func isDiscStructure(name string) bool {
+	for _, structure := range discStructures {
+		if strings.EqualFold(name, structure) {
+			return true
+		}
+	}
+	return false
+}
+
+// discRootOf returns the disc root of a path inside a disc structure, e.g. "/downloads/Movie"
+// for "/downloads/Movie/BDMV/STREAM/00000.m2ts", or an empty string
+func discRootOf(path string) string {
+	dir := filepath.Dir(path)
+	for {
+		if isDiscStructure(filepath.Base(dir)) {
+			return filepath.Dir(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// MediaName returns the name a media file is identified by. Discs are named after their
+// folder and disc images after the enclosing folder, which carries the full release name
+// where the image is often abbreviated, unless the image lies directly in a media directory.
+func MediaName(path string, mediaDirs []string) string {
+	if !IsDiscImage(path) {
+		return filepath.Base(path)
+	}
+
+	dir := filepath.Dir(path)
+	if isMediaDir(dir, mediaDirs) {
+		return filepath.Base(path)
+	}
+	return filepath.Base(dir) + filepath.Ext(path)
+}
+
+// mediaName returns the name a media file is identified by, see MediaName
+func (s *Scanner) mediaName(path string) string {
+	return MediaName(path, s.config.MediaDirs)
+}
+
+// isMediaDir reports whether a directory is one of the media directories
+func isMediaDir(dir string, mediaDirs []string) bool {
+	for _, mediaDir := range mediaDirs {
+		if filepath.Clean(mediaDir) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// treeState returns the total size and latest modification time of a file or of all files
+// in a directory, and whether the directory holds temporary or partially downloaded files
+func treeState(path string, partial func(name string) bool) (int64, time.Time, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, time.Time{}, false, err
+	}
+	if !info.IsDir() {
+		return info.Size(), info.ModTime(), false, nil
+	}
+
+	var size int64
+	modTime := info.ModTime()
+	incomplete := false
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		if !d.IsDir() {
+			size += info.Size()
+			if partial(d.Name()) {
+				incomplete = true
+			}
+		}
+		return nil
+	})
+	return size, modTime, incomplete, err
+}
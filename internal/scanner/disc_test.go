@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDiscRootOf tests finding the disc folder of files inside disc structures
+func TestDiscRootOf(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/downloads/Movie.2020/BDMV/STREAM/00000.m2ts", "/downloads/Movie.2020"},
+		{"/downloads/Movie.2020/BDMV/index.bdmv", "/downloads/Movie.2020"},
+		{"/downloads/Movie.2020/VIDEO_TS/VTS_01_1.VOB", "/downloads/Movie.2020"},
+		{"/downloads/Movie.2020/video_ts/VTS_01_1.VOB", "/downloads/Movie.2020"},
+		{"/downloads/Movie.2020/Movie.2020.mkv", ""},
+		{"/downloads/BDMV.Collection/Movie.mkv", ""},
+	}
+
+	for _, test := range tests {
+		if actual := discRootOf(test.path); actual != test.expected {
+			t.Errorf("discRootOf(%q) = %q, expected %q", test.path, actual, test.expected)
+		}
+	}
+}
+
+// TestMediaName tests that discs are named after their folder
+func TestMediaName(t *testing.T) {
+	mediaDirs := []string{"/downloads"}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/downloads/Movie.2020.1080p.mkv", "Movie.2020.1080p.mkv"},
+		{"/downloads/Movie.2020.1080p.BluRay", "Movie.2020.1080p.BluRay"},
+		{"/downloads/Movie.2020.1080p.BluRay/MOVIE.iso", "Movie.2020.1080p.BluRay.iso"},
+		{"/downloads/Movie.2020.1080p.iso", "Movie.2020.1080p.iso"},
+	}
+
+	for _, test := range tests {
+		if actual := MediaName(test.path, mediaDirs); actual != test.expected {
+			t.Errorf("MediaName(%q) = %q, expected %q", test.path, actual, test.expected)
+		}
+	}
+}
+
+// TestTreeState tests that discs are observed as a whole
+func TestTreeState(t *testing.T) {
+	root := t.TempDir()
+	stream := filepath.Join(root, "BDMV", "STREAM")
+	if err := os.MkdirAll(stream, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stream, "00000.m2ts"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stream, "00001.m2ts"), []byte("more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsDiscRoot(root) {
+		t.Errorf("Expected %s to be a disc folder", root)
+	}
+
+	size, _, incomplete, err := treeState(root, isTemporaryName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if size != 9 || incomplete {
+		t.Errorf("Expected size 9 and complete, got %d, %v", size, incomplete)
+	}
+
+	if err := os.WriteFile(filepath.Join(stream, ".00002.m2ts.XXXXXX"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, incomplete, _ := treeState(root, isTemporaryName); !incomplete {
+		t.Error("Expected disc with a temporary file to be incomplete")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isFileOpen reports whether any process has the file, or a file in the directory,
+// open by inspecting /proc/<pid>/fd
+func isFileOpen(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	fdDirs, err := filepath.Glob("/proc/[0-9]*/fd")
+	if err != nil {
+		return false
+	}
+
+	for _, fdDir := range fdDirs {
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			// Processes owned by other users cannot be inspected
+			continue
+		}
+		for _, entry := range entries {
+			target, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+			if err == nil && (target == absPath || strings.HasPrefix(target, absPath+string(filepath.Separator))) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package scanner
+
+// isFileOpen is not supported on this platform and always reports false
+func isFileOpen(path string) bool {
+	return false
+}
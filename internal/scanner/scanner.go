@@ -18,19 +18,26 @@ import (
 
 // Scanner represents the media scanner
 type Scanner struct {
-	config   *config.ScannerConfig
-	db       *database.Database
-	watcher  *fsnotify.Watcher
-	watching bool
-	mu       sync.RWMutex
+	config    *config.ScannerConfig
+	db        *database.Database
+	watcher   *fsnotify.Watcher
+	watching  bool
+	stability *StabilityChecker
+	mu        sync.RWMutex
+
+	// Renamed paths waiting for their new name, see handleRename
+	renames  map[string]*pendingRename
+	renameMu sync.Mutex
 }
 
 // New creates a new scanner
 func New(cfg *config.ScannerConfig, db *database.Database) *Scanner {
 	return &Scanner{
-		config:   cfg,
-		db:       db,
-		watching: false,
+		config:    cfg,
+		db:        db,
+		watching:  false,
+		stability: NewStabilityChecker(&cfg.Stability),
+		renames:   make(map[string]*pendingRename),
 	}
 }
 
@@ -39,6 +46,7 @@ type ScanResult struct {
 	NewFiles      []string
 	BatchDirs     map[string][]string
 	ExcludedFiles []string
+	UnstableFiles []string
 }
 
 // Scan scans the media directories for new files
@@ -47,8 +55,12 @@ func (s *Scanner) Scan() (*ScanResult, error) {
 		NewFiles:      make([]string, 0),
 		BatchDirs:     make(map[string][]string),
 		ExcludedFiles: make([]string, 0),
+		UnstableFiles: make([]string, 0),
 	}
 
+	// Drop observations of files that have disappeared
+	s.stability.Prune()
+
 	// Compile exclude patterns
 	excludePatterns := make([]*regexp.Regexp, 0, len(s.config.ExcludePatterns))
 	for _, pattern := range s.config.ExcludePatterns {
@@ -72,6 +84,37 @@ func (s *Scanner) Scan() (*ScanResult, error) {
 		excludeDirMap[strings.ToLower(dir)] = true
 	}
 
+	// addFile checks a video file or disc and adds it to the result if it is new
+	addFile := func(path string) {
+		// Check if the file matches any exclude patterns
+		fileName := s.mediaName(path)
+		for _, pattern := range excludePatterns {
+			if pattern.MatchString(fileName) {
+				result.ExcludedFiles = append(result.ExcludedFiles, path)
+				return
+			}
+		}
+
+		// Check if the file is already in the database
+		if _, err := s.db.GetMediaFileByPath(path); err == nil {
+			return
+		}
+
+		// Hold back files that are still being downloaded
+		if stable, reason := s.stability.Check(path); !stable {
+			log.Debug().Str("file", path).Str("reason", reason).Msg("File is not stable yet")
+			result.UnstableFiles = append(result.UnstableFiles, path)
+			return
+		}
+
+		// Add the file to the result
+		result.NewFiles = append(result.NewFiles, path)
+
+		// Add the file to the batch directory map
+		dir := filepath.Dir(path)
+		result.BatchDirs[dir] = append(result.BatchDirs[dir], path)
+	}
+
 	// Scan each media directory
 	for _, mediaDir := range s.config.MediaDirs {
 		err := filepath.Walk(mediaDir, func(path string, info os.FileInfo, err error) error {
@@ -80,44 +123,35 @@ func (s *Scanner) Scan() (*ScanResult, error) {
 				return nil
 			}
 
-			// Skip directories that match exclude patterns
 			if info.IsDir() {
+				// Skip directories that match exclude patterns
 				dirName := strings.ToLower(filepath.Base(path))
 				if excludeDirMap[dirName] {
 					return filepath.SkipDir
 				}
-				return nil
-			}
 
-			// Check if the file is a video file
-			ext := strings.ToLower(filepath.Ext(path))
-			if !videoExtMap[ext] {
-				return nil
-			}
-
-			// Check if the file matches any exclude patterns
-			fileName := filepath.Base(path)
-			for _, pattern := range excludePatterns {
-				if pattern.MatchString(fileName) {
-					result.ExcludedFiles = append(result.ExcludedFiles, path)
-					return nil
+				// A Blu-ray or DVD structure is a single movie or episode named after its folder
+				if isDiscStructure(filepath.Base(path)) {
+					return filepath.SkipDir
 				}
+				if IsDiscRoot(path) {
+					if isMediaDir(path, s.config.MediaDirs) {
+						log.Warn().Str("directory", path).Msg("Media directory holds a disc structure, put the disc in a folder of its own")
+						return nil
+					}
+					addFile(path)
+					return filepath.SkipDir
+				}
+				return nil
 			}
 
-			// Check if the file is already in the database
-			_, err = s.db.GetMediaFileByPath(path)
-			if err == nil {
-				// File is already in the database
+			// Check if the file is a video file or a disc image
+			ext := strings.ToLower(filepath.Ext(path))
+			if !videoExtMap[ext] && !IsDiscImage(path) {
 				return nil
 			}
 
-			// Add the file to the result
-			result.NewFiles = append(result.NewFiles, path)
-
-			// Add the file to the batch directory map
-			dir := filepath.Dir(path)
-			result.BatchDirs[dir] = append(result.BatchDirs[dir], path)
-
+			addFile(path)
 			return nil
 		})
 
@@ -199,36 +233,56 @@ func (s *Scanner) IsWatching() bool {
 
 // handleFileEvent handles a file system event
 func (s *Scanner) handleFileEvent(event fsnotify.Event) {
-	// Only process create and modify events
-	if event.Type != fsnotify.EventCreate && event.Type != fsnotify.EventModify {
+	switch event.Type {
+	case fsnotify.EventRemove:
+		s.handleRemove(event.Path)
+		return
+	case fsnotify.EventRename:
+		s.handleRename(event.Path)
+		return
+	case fsnotify.EventCreate:
+		// A renamed file is not picked up again under its new name
+		if s.correlateRename(event.Path) {
+			return
+		}
+	case fsnotify.EventModify:
+	default:
 		return
 	}
 
+	// Files of a Blu-ray or DVD structure belong to the disc
+	path := event.Path
+	if root := discRootOf(path); root != "" {
+		path = root
+	}
+
 	// Check if the file is a directory
-	info, err := os.Stat(event.Path)
+	info, err := os.Stat(path)
 	if err != nil {
-		log.Printf("Error getting file info for %q: %v", event.Path, err)
+		log.Printf("Error getting file info for %q: %v", path, err)
 		return
 	}
 	if info.IsDir() {
-		return
-	}
-
-	// Check if the file is a video file
-	ext := strings.ToLower(filepath.Ext(event.Path))
-	isVideoFile := false
-	for _, videoExt := range s.config.VideoExtensions {
-		if ext == strings.ToLower(videoExt) {
-			isVideoFile = true
-			break
+		if !IsDiscRoot(path) || isMediaDir(path, s.config.MediaDirs) {
+			return
+		}
+	} else {
+		// Check if the file is a video file or a disc image
+		ext := strings.ToLower(filepath.Ext(path))
+		isVideoFile := IsDiscImage(path)
+		for _, videoExt := range s.config.VideoExtensions {
+			if ext == strings.ToLower(videoExt) {
+				isVideoFile = true
+				break
+			}
+		}
+		if !isVideoFile {
+			return
 		}
-	}
-	if !isVideoFile {
-		return
 	}
 
 	// Check if the file matches any exclude patterns
-	fileName := filepath.Base(event.Path)
+	fileName := s.mediaName(path)
 	for _, pattern := range s.config.ExcludePatterns {
 		re, err := regexp.Compile("(?i)" + pattern)
 		if err != nil {
@@ -240,26 +294,49 @@ func (s *Scanner) handleFileEvent(event fsnotify.Event) {
 	}
 
 	// Check if the file is already in the database
-	_, err = s.db.GetMediaFileByPath(event.Path)
+	existing, err := s.db.GetMediaFileByPath(path)
 	if err == nil {
-		// File is already in the database
+		// A file that disappeared and came back is processed again
+		if existing.Status == "missing" {
+			existing.Status = "pending"
+			existing.ErrorMessage = ""
+			log.Info().Str("file", path).Msg("Missing file is back")
+		}
+
+		// A pending file that is still being written restarts its process delay
+		if existing.Status == "pending" {
+			existing.FileSize, _, _, _ = treeState(path, isTemporaryName)
+			existing.UpdatedAt = time.Now()
+			if err := s.db.UpdateMediaFile(existing); err != nil {
+				log.Error().Err(err).Str("file", path).Msg("Failed to update pending media file")
+			}
+		}
 		return
 	}
 
 	// Create a media file record
-	_, err = s.CreateMediaFile(event.Path)
+	_, err = s.CreateMediaFile(path)
 	if err != nil {
-		log.Error().Err(err).Str("file", event.Path).Msg("Failed to create media file record")
+		log.Error().Err(err).Str("file", path).Msg("Failed to create media file record")
 		return
 	}
 
-	log.Info().Str("file", event.Path).Msg("New file detected and added")
+	log.Info().Str("file", path).Msg("New file detected and added")
+}
+
+// IsStable reports whether a file has finished downloading and may be processed
+func (s *Scanner) IsStable(path string) bool {
+	stable, reason := s.stability.Check(path)
+	if !stable {
+		log.Debug().Str("file", path).Str("reason", reason).Msg("File is not stable yet")
+	}
+	return stable
 }
 
 // CreateMediaFile creates a new media file record in the database
 func (s *Scanner) CreateMediaFile(path string) (*models.MediaFile, error) {
-	// Get file info
-	info, err := os.Stat(path)
+	// Get the size of the file, or of all files of a disc
+	size, _, _, err := treeState(path, isTemporaryName)
 	if err != nil {
 		return nil, fmt.Errorf("error getting file info: %w", err)
 	}
@@ -267,8 +344,8 @@ func (s *Scanner) CreateMediaFile(path string) (*models.MediaFile, error) {
 	// Create media file record
 	mediaFile := &models.MediaFile{
 		OriginalPath: path,
-		OriginalName: filepath.Base(path),
-		FileSize:     info.Size(),
+		OriginalName: s.mediaName(path),
+		FileSize:     size,
 		Status:       "pending",
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
@@ -326,3 +403,37 @@ func (s *Scanner) CreateBatchProcess(dir string, files []string) (*models.BatchP
 
 	return batchProcess, nil
 }
+
+// CreateBatchProcessFromMediaFiles creates a batch process record for media files that already exist in the database
+func (s *Scanner) CreateBatchProcessFromMediaFiles(dir string, mediaFiles []*models.MediaFile) (*models.BatchProcess, error) {
+	// Create batch process record
+	batchProcess := &models.BatchProcess{
+		Directory: dir,
+		FileCount: len(mediaFiles),
+		Status:    "pending",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	// Save to database
+	if err := s.db.CreateBatchProcess(batchProcess); err != nil {
+		return nil, fmt.Errorf("error creating batch process record: %w", err)
+	}
+
+	// Link each media file to the batch
+	for _, mediaFile := range mediaFiles {
+		batchProcessFile := &models.BatchProcessFile{
+			BatchProcessID: batchProcess.ID,
+			MediaFileID:    mediaFile.ID,
+			Status:         "pending",
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+
+		if err := s.db.CreateBatchProcessFile(batchProcessFile); err != nil {
+			log.Error().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to create batch process file record")
+		}
+	}
+
+	return batchProcess, nil
+}
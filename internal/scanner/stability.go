@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+// staleObservationAge is how long an observation is kept for a file that is no longer checked
+const staleObservationAge = 24 * time.Hour
+
+// fileObservation records the state of a file when it was last checked
+type fileObservation struct {
+	size    int64
+	modTime time.Time
+	seenAt  time.Time
+}
+
+// StabilityChecker decides whether a file has finished downloading
+type StabilityChecker struct {
+	config       *config.StabilitySettings
+	observations map[string]fileObservation
+	mu           sync.Mutex
+}
+
+// NewStabilityChecker creates a new stability checker
+func NewStabilityChecker(cfg *config.StabilitySettings) *StabilityChecker {
+	return &StabilityChecker{
+		config:       cfg,
+		observations: make(map[string]fileObservation),
+	}
+}
+
+// Check reports whether the file is stable. When it is not, the returned
+// reason describes why the file is being held back.
+func (c *StabilityChecker) Check(path string) (bool, string) {
+	if c.config == nil || !c.config.Enabled {
+		return true, ""
+	}
+
+	// Skip temporary and partially downloaded files
+	name := filepath.Base(path)
+	if isTemporaryName(name) {
+		return false, "temporary file"
+	}
+	if c.hasPartialSuffix(name) {
+		return false, "partial download"
+	}
+
+	// Skip files that still have a download side file next to them (movie.mkv.aria2, movie.mkv.part)
+	for _, suffix := range c.config.PartialSuffixes {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return false, "download side file present"
+		}
+	}
+
+	// Discs are directories, they are observed as a whole
+	size, modTime, incomplete, err := treeState(path, func(name string) bool {
+		return isTemporaryName(name) || c.hasPartialSuffix(name)
+	})
+	if err != nil {
+		c.forget(path)
+		return false, "file is not accessible"
+	}
+	if incomplete {
+		return false, "partial download"
+	}
+
+	quietPeriod := time.Duration(c.config.QuietPeriod) * time.Second
+
+	c.mu.Lock()
+	previous, seen := c.observations[path]
+	c.observations[path] = fileObservation{
+		size:    size,
+		modTime: modTime,
+		seenAt:  time.Now(),
+	}
+	c.mu.Unlock()
+
+	// The file must not have been modified during the quiet period
+	if time.Since(modTime) < quietPeriod {
+		return false, "recently modified"
+	}
+
+	// The file must not have changed since it was last observed
+	if seen && (previous.size != size || !previous.modTime.Equal(modTime)) {
+		return false, "changed since last observation"
+	}
+
+	// Optionally make sure no other process is writing to the file
+	if c.config.CheckOpenFiles && isFileOpen(path) {
+		return false, "open by another process"
+	}
+
+	c.forget(path)
+	return true, ""
+}
+
+// Prune drops observations of files that have not been checked for a long time
+func (c *StabilityChecker) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path, observation := range c.observations {
+		if time.Since(observation.seenAt) > staleObservationAge {
+			delete(c.observations, path)
+		}
+	}
+}
+
+// forget drops the observation of a file
+func (c *StabilityChecker) forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.observations, path)
+}
+
+// hasPartialSuffix reports whether the file name ends with a partial download suffix
+func (c *StabilityChecker) hasPartialSuffix(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, suffix := range c.config.PartialSuffixes {
+		if strings.HasSuffix(lowerName, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTemporaryName reports whether the file name looks like a temporary file
+// (rsync writes ".name.XXXXXX", editors and office tools use "~" prefixes)
+func isTemporaryName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~")
+}
@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/mediascanner/internal/config"
+)
+
+func newTestStabilityChecker() *StabilityChecker {
+	return NewStabilityChecker(&config.StabilitySettings{
+		Enabled:         true,
+		QuietPeriod:     60,
+		PartialSuffixes: []string{".part", ".!qb", ".aria2"},
+	})
+}
+
+// writeTestFile creates a file with the given content and modification time
+func writeTestFile(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set file times: %v", err)
+	}
+}
+
+func TestStabilityCheckerQuietFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Movie.2019.1080p.mkv")
+	writeTestFile(t, path, "data", time.Now().Add(-time.Hour))
+
+	checker := newTestStabilityChecker()
+	if stable, reason := checker.Check(path); !stable {
+		t.Errorf("Expected quiet file to be stable, got reason '%s'", reason)
+	}
+}
+
+func TestStabilityCheckerRecentlyModified(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Movie.2019.1080p.mkv")
+	writeTestFile(t, path, "data", time.Now())
+
+	checker := newTestStabilityChecker()
+	if stable, _ := checker.Check(path); stable {
+		t.Error("Expected recently modified file to be unstable")
+	}
+}
+
+func TestStabilityCheckerChangedBetweenObservations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Movie.2019.1080p.mkv")
+	modTime := time.Now().Add(-time.Hour)
+
+	checker := newTestStabilityChecker()
+
+	// First observation while the file is still being written
+	writeTestFile(t, path, "data", time.Now())
+	if stable, _ := checker.Check(path); stable {
+		t.Fatal("Expected recently modified file to be unstable")
+	}
+
+	// The file grew but its modification time was reset by the downloader
+	writeTestFile(t, path, "more data", modTime)
+	if stable, _ := checker.Check(path); stable {
+		t.Error("Expected file that changed since the last observation to be unstable")
+	}
+
+	// Nothing changed since the previous observation
+	if stable, reason := checker.Check(path); !stable {
+		t.Errorf("Expected unchanged file to be stable, got reason '%s'", reason)
+	}
+}
+
+func TestStabilityCheckerPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name      string
+		files     []string
+		checkPath string
+	}{
+		{"qBittorrent incomplete suffix", []string{"Movie.mkv.!qB"}, "Movie.mkv.!qB"},
+		{"part suffix", []string{"Movie.mkv.part"}, "Movie.mkv.part"},
+		{"aria2 side file", []string{"Show.S01E01.mkv", "Show.S01E01.mkv.aria2"}, "Show.S01E01.mkv"},
+		{"rsync temporary file", []string{".Movie.mkv.Ab12Cd"}, ".Movie.mkv.Ab12Cd"},
+	}
+
+	checker := newTestStabilityChecker()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, file := range tc.files {
+				writeTestFile(t, filepath.Join(dir, file), "data", old)
+			}
+			if stable, _ := checker.Check(filepath.Join(dir, tc.checkPath)); stable {
+				t.Errorf("Expected %s to be unstable", tc.checkPath)
+			}
+		})
+	}
+}
+
+func TestStabilityCheckerDisabled(t *testing.T) {
+	checker := NewStabilityChecker(&config.StabilitySettings{Enabled: false})
+	if stable, _ := checker.Check("/nonexistent/Movie.mkv.part"); !stable {
+		t.Error("Expected disabled checker to report every file as stable")
+	}
+}
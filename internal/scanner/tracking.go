@@ -0,0 +1,267 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sleepstars/mediascanner/internal/fileops"
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// renameWindow is how long a renamed path waits for the create event of its new name.
+// The watcher reports a rename as a rename of the old path followed by a create of the new one.
+const renameWindow = 2 * time.Second
+
+// pendingRename is a renamed path whose new name has not been seen yet
+type pendingRename struct {
+	path  string
+	files []models.MediaFile
+	timer *time.Timer
+}
+
+// trackedFiles returns the media files at or below a path that no longer exists there
+func (s *Scanner) trackedFiles(path string) []models.MediaFile {
+	mediaFiles, err := s.db.GetMediaFilesByDirectory(path)
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("Failed to get media files")
+		return nil
+	}
+
+	var tracked []models.MediaFile
+	for _, mediaFile := range mediaFiles {
+		if !underPath(mediaFile.OriginalPath, path) {
+			continue
+		}
+		if _, err := os.Lstat(mediaFile.OriginalPath); err == nil {
+			continue
+		}
+		tracked = append(tracked, mediaFile)
+	}
+	return tracked
+}
+
+// underPath reports whether a path is the given directory or lies below it
+func underPath(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// handleRemove retires the media files of a removed file or directory
+func (s *Scanner) handleRemove(path string) {
+	for _, mediaFile := range s.trackedFiles(path) {
+		s.retireFile(&mediaFile, "Source file was removed")
+	}
+}
+
+// handleRename holds the media files of a renamed file or directory until the new name shows
+// up. Files whose new name is not seen in time were moved out of the watched directories.
+func (s *Scanner) handleRename(path string) {
+	files := s.trackedFiles(path)
+	if len(files) == 0 {
+		return
+	}
+
+	s.renameMu.Lock()
+	defer s.renameMu.Unlock()
+	if previous, ok := s.renames[path]; ok {
+		previous.timer.Stop()
+	}
+	s.renames[path] = &pendingRename{
+		path:  path,
+		files: files,
+		timer: time.AfterFunc(renameWindow, func() { s.expireRename(path) }),
+	}
+}
+
+// expireRename retires the media files of a rename whose new name was never seen
+func (s *Scanner) expireRename(path string) {
+	s.renameMu.Lock()
+	pending, ok := s.renames[path]
+	delete(s.renames, path)
+	s.renameMu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, mediaFile := range pending.files {
+		s.retireFile(&mediaFile, "Source file was moved out of the watched directories")
+	}
+}
+
+// correlateRename matches a created path with a pending rename and moves the media files
+// of the old name over, so that a renamed file is not picked up as a new one. It reports
+// whether the path was the new name of a pending rename.
+func (s *Scanner) correlateRename(path string) bool {
+	s.renameMu.Lock()
+	var match *pendingRename
+	for _, pending := range s.renames {
+		if s.renamedFileCount(pending, path) > 0 {
+			match = pending
+			break
+		}
+	}
+	if match != nil {
+		match.timer.Stop()
+		delete(s.renames, match.path)
+	}
+	s.renameMu.Unlock()
+	if match == nil {
+		return false
+	}
+
+	for _, mediaFile := range match.files {
+		newPath := path + strings.TrimPrefix(mediaFile.OriginalPath, match.path)
+		if !s.isSameFile(newPath, &mediaFile) {
+			s.retireFile(&mediaFile, "Source file was removed")
+			continue
+		}
+		s.renameFile(&mediaFile, match.path, path)
+	}
+	return true
+}
+
+// renamedFileCount returns how many media files of a pending rename are found below a new path
+func (s *Scanner) renamedFileCount(pending *pendingRename, path string) int {
+	count := 0
+	for _, mediaFile := range pending.files {
+		if s.isSameFile(path+strings.TrimPrefix(mediaFile.OriginalPath, pending.path), &mediaFile) {
+			count++
+		}
+	}
+	return count
+}
+
+// isSameFile reports whether a path holds the video or disc of a media file, judged by its size
+func (s *Scanner) isSameFile(path string, mediaFile *models.MediaFile) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		if !IsDiscRoot(path) {
+			return false
+		}
+	} else if !s.isVideo(path) {
+		return false
+	}
+
+	size, _, _, err := treeState(path, isTemporaryName)
+	return err == nil && size == mediaFile.FileSize
+}
+
+// isVideo reports whether a file is a video file or a disc image
+func (s *Scanner) isVideo(path string) bool {
+	if IsDiscImage(path) {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, videoExt := range s.config.VideoExtensions {
+		if ext == strings.ToLower(videoExt) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameFile moves a media file over to its new path. Library symlinks pointing at the old
+// path are pointed at the new one.
+func (s *Scanner) renameFile(mediaFile *models.MediaFile, oldPrefix, newPrefix string) {
+	oldPath := mediaFile.OriginalPath
+	mediaFile.OriginalPath = newPrefix + strings.TrimPrefix(oldPath, oldPrefix)
+	mediaFile.OriginalName = s.mediaName(mediaFile.OriginalPath)
+	mediaFile.UpdatedAt = time.Now()
+	if err := s.db.UpdateMediaFile(mediaFile); err != nil {
+		log.Error().Err(err).Str("file", oldPath).Msg("Failed to update renamed media file")
+		return
+	}
+	log.Info().Str("file", oldPath).Str("new_path", mediaFile.OriginalPath).Msg("Source file renamed")
+
+	if operation := s.symlinkOperation(mediaFile); operation != nil {
+		if err := relinkOperation(operation, oldPrefix, newPrefix); err != nil {
+			log.Error().Err(err).Str("destination", operation.DestinationPath).Msg("Failed to update library symlink")
+			s.flagBroken(mediaFile, fmt.Sprintf("Library symlink %s could not be updated after the source was renamed: %v", operation.DestinationPath, err))
+			return
+		}
+		if err := s.db.UpdateOperation(operation); err != nil {
+			log.Error().Err(err).Str("destination", operation.DestinationPath).Msg("Failed to update operation")
+		}
+		log.Info().Str("destination", operation.DestinationPath).Msg("Library symlink updated")
+	}
+}
+
+// retireFile records that the source of a media file is gone. Files that were not organised
+// are retired; organised files whose library entry is a symlink are flagged as broken.
+func (s *Scanner) retireFile(mediaFile *models.MediaFile, reason string) {
+	switch mediaFile.Status {
+	case "pending", "failed", "manual", "skipped":
+		mediaFile.Status = "missing"
+		mediaFile.ErrorMessage = reason
+		mediaFile.UpdatedAt = time.Now()
+		if err := s.db.UpdateMediaFile(mediaFile); err != nil {
+			log.Error().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to retire media file")
+			return
+		}
+		log.Info().Str("file", mediaFile.OriginalPath).Str("reason", reason).Msg("Media file retired")
+	case "success":
+		if operation := s.symlinkOperation(mediaFile); operation != nil {
+			s.flagBroken(mediaFile, fmt.Sprintf("%s, library symlink %s is broken", reason, operation.DestinationPath))
+		}
+	}
+}
+
+// flagBroken flags an organised media file whose library entry no longer works
+func (s *Scanner) flagBroken(mediaFile *models.MediaFile, reason string) {
+	mediaFile.Status = "broken"
+	mediaFile.ErrorMessage = reason
+	mediaFile.UpdatedAt = time.Now()
+	if err := s.db.UpdateMediaFile(mediaFile); err != nil {
+		log.Error().Err(err).Str("file", mediaFile.OriginalPath).Msg("Failed to flag media file")
+		return
+	}
+	log.Warn().Str("file", mediaFile.OriginalPath).Str("reason", reason).Msg("Library entry is broken")
+}
+
+// symlinkOperation returns the operation that organised a media file as a symlink, or nil
+func (s *Scanner) symlinkOperation(mediaFile *models.MediaFile) *models.Operation {
+	if mediaFile.Status != "success" {
+		return nil
+	}
+	operations, err := s.db.GetOperationsByMediaFileID(mediaFile.ID)
+	if err != nil || len(operations) == 0 || operations[0].Mode != "symlink" {
+		return nil
+	}
+	return &operations[0]
+}
+
+// relinkOperation points the symlinks created by an operation, including those of its
+// sidecar files, from an old source path to a new one
+func relinkOperation(operation *models.Operation, oldPrefix, newPrefix string) error {
+	newSource := newPrefix + strings.TrimPrefix(operation.SourcePath, oldPrefix)
+	if len(operation.Entries) > 0 {
+		for _, entry := range operation.Entries {
+			if err := fileops.Relink(filepath.Join(operation.DestinationPath, entry), filepath.Join(newSource, entry)); err != nil {
+				return err
+			}
+		}
+	} else if err := fileops.Relink(operation.DestinationPath, newSource); err != nil {
+		return err
+	}
+	operation.SourcePath = newSource
+
+	for i := range operation.Companions {
+		companion := &operation.Companions[i]
+		if companion.Mode != "symlink" || !underPath(companion.Source, oldPrefix) {
+			continue
+		}
+		source := newPrefix + strings.TrimPrefix(companion.Source, oldPrefix)
+		if err := fileops.Relink(companion.Destination, source); err != nil {
+			log.Warn().Err(err).Str("file", companion.Destination).Msg("Failed to update sidecar symlink")
+			continue
+		}
+		companion.Source = source
+	}
+	return nil
+}
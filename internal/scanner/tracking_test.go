@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sleepstars/mediascanner/internal/models"
+)
+
+// TestRelinkOperation tests that library symlinks follow a renamed download directory
+func TestRelinkOperation(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "downloads", "Movie.2020")
+	newDir := filepath.Join(root, "downloads", "Movie (2020)")
+	library := filepath.Join(root, "library", "Movie (2020)")
+	for _, dir := range []string{oldDir, library} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"Movie.2020.mkv", "Movie.2020.srt"} {
+		if err := os.WriteFile(filepath.Join(oldDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	operation := &models.Operation{
+		SourcePath:      filepath.Join(oldDir, "Movie.2020.mkv"),
+		DestinationPath: filepath.Join(library, "Movie (2020).mkv"),
+		Mode:            "symlink",
+		Companions: []models.Companion{{
+			Source:      filepath.Join(oldDir, "Movie.2020.srt"),
+			Destination: filepath.Join(library, "Movie (2020).srt"),
+			Mode:        "symlink",
+		}},
+	}
+	if err := os.Symlink(operation.SourcePath, operation.DestinationPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(operation.Companions[0].Source, operation.Companions[0].Destination); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := relinkOperation(operation, oldDir, newDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if expected := filepath.Join(newDir, "Movie.2020.mkv"); operation.SourcePath != expected {
+		t.Errorf("Expected source %s, got %s", expected, operation.SourcePath)
+	}
+	for _, link := range []string{operation.DestinationPath, operation.Companions[0].Destination} {
+		if _, err := os.ReadFile(link); err != nil {
+			t.Errorf("Expected %s to resolve, got %v", link, err)
+		}
+	}
+	if expected := filepath.Join(newDir, "Movie.2020.srt"); operation.Companions[0].Source != expected {
+		t.Errorf("Expected sidecar source %s, got %s", expected, operation.Companions[0].Source)
+	}
+}
+
+// TestUnderPath tests matching paths below a directory
+func TestUnderPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		dir      string
+		expected bool
+	}{
+		{"/downloads/Movie/Movie.mkv", "/downloads/Movie", true},
+		{"/downloads/Movie", "/downloads/Movie", true},
+		{"/downloads/Movie2/Movie.mkv", "/downloads/Movie", false},
+		{"/downloads", "/downloads/Movie", false},
+	}
+
+	for _, test := range tests {
+		if actual := underPath(test.path, test.dir); actual != test.expected {
+			t.Errorf("underPath(%q, %q) = %v, expected %v", test.path, test.dir, actual, test.expected)
+		}
+	}
+}